@@ -0,0 +1,5 @@
+package velocitylimitsv1
+
+// Regenerates the Go code of the protobuf definition, which needs protoc with the
+// protoc-gen-go and protoc-gen-go-grpc plugins.
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative velocitylimits/v1/velocity_limits.proto
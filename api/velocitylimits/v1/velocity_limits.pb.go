@@ -0,0 +1,441 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        (unknown)
+// source: velocitylimits/v1/velocity_limits.proto
+
+// Package velocitylimits.v1 exposes the velocity limits engine over gRPC with the same
+// transactions and responses as the input and output files and the HTTP API.
+
+package velocitylimitsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Transaction is a load, withdrawal, transfer or reversal like a line of the input file.
+type Transaction struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id         string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CustomerId string `protobuf:"bytes,2,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	// Amount with an optional currency symbol or code, e.g. "$3318.47" or "100.00 CAD".
+	LoadAmount string                 `protobuf:"bytes,3,opt,name=load_amount,json=loadAmount,proto3" json:"load_amount,omitempty"`
+	Time       *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+	// load (default), withdrawal, transfer or reversal.
+	Type string `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	// Receiving customer of a transfer.
+	ToCustomerId string `protobuf:"bytes,6,opt,name=to_customer_id,json=toCustomerId,proto3" json:"to_customer_id,omitempty"`
+	// Load ID undone by a reversal.
+	OriginalId string `protobuf:"bytes,7,opt,name=original_id,json=originalId,proto3" json:"original_id,omitempty"`
+}
+
+func (x *Transaction) Reset() {
+	*x = Transaction{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_velocitylimits_v1_velocity_limits_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Transaction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transaction) ProtoMessage() {}
+
+func (x *Transaction) ProtoReflect() protoreflect.Message {
+	mi := &file_velocitylimits_v1_velocity_limits_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transaction.ProtoReflect.Descriptor instead.
+func (*Transaction) Descriptor() ([]byte, []int) {
+	return file_velocitylimits_v1_velocity_limits_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Transaction) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Transaction) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *Transaction) GetLoadAmount() string {
+	if x != nil {
+		return x.LoadAmount
+	}
+	return ""
+}
+
+func (x *Transaction) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Transaction) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Transaction) GetToCustomerId() string {
+	if x != nil {
+		return x.ToCustomerId
+	}
+	return ""
+}
+
+func (x *Transaction) GetOriginalId() string {
+	if x != nil {
+		return x.OriginalId
+	}
+	return ""
+}
+
+// Response is the decision of a transaction like a line of the detailed output format.
+type Response struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id         string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CustomerId string `protobuf:"bytes,2,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	Accepted   bool   `protobuf:"varint,3,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	// Decline reason, e.g. DAILY_AMOUNT_EXCEEDED, empty for accepted transactions.
+	Reason   string           `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	Headroom []*LimitHeadroom `protobuf:"bytes,5,rep,name=headroom,proto3" json:"headroom,omitempty"`
+	// Set on the original response returned again for a retried transaction.
+	Replay bool `protobuf:"varint,6,opt,name=replay,proto3" json:"replay,omitempty"`
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_velocitylimits_v1_velocity_limits_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_velocitylimits_v1_velocity_limits_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_velocitylimits_v1_velocity_limits_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Response) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Response) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *Response) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *Response) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Response) GetHeadroom() []*LimitHeadroom {
+	if x != nil {
+		return x.Headroom
+	}
+	return nil
+}
+
+func (x *Response) GetReplay() bool {
+	if x != nil {
+		return x.Replay
+	}
+	return false
+}
+
+// LimitHeadroom is what's left of a limit rule, only the remaining value of the rule metric is set.
+type LimitHeadroom struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Limit           string  `protobuf:"bytes,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	RemainingAmount *string `protobuf:"bytes,2,opt,name=remaining_amount,json=remainingAmount,proto3,oneof" json:"remaining_amount,omitempty"`
+	RemainingCount  *int64  `protobuf:"varint,3,opt,name=remaining_count,json=remainingCount,proto3,oneof" json:"remaining_count,omitempty"`
+}
+
+func (x *LimitHeadroom) Reset() {
+	*x = LimitHeadroom{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_velocitylimits_v1_velocity_limits_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LimitHeadroom) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LimitHeadroom) ProtoMessage() {}
+
+func (x *LimitHeadroom) ProtoReflect() protoreflect.Message {
+	mi := &file_velocitylimits_v1_velocity_limits_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LimitHeadroom.ProtoReflect.Descriptor instead.
+func (*LimitHeadroom) Descriptor() ([]byte, []int) {
+	return file_velocitylimits_v1_velocity_limits_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LimitHeadroom) GetLimit() string {
+	if x != nil {
+		return x.Limit
+	}
+	return ""
+}
+
+func (x *LimitHeadroom) GetRemainingAmount() string {
+	if x != nil && x.RemainingAmount != nil {
+		return *x.RemainingAmount
+	}
+	return ""
+}
+
+func (x *LimitHeadroom) GetRemainingCount() int64 {
+	if x != nil && x.RemainingCount != nil {
+		return *x.RemainingCount
+	}
+	return 0
+}
+
+var File_velocitylimits_v1_velocity_limits_proto protoreflect.FileDescriptor
+
+var file_velocitylimits_v1_velocity_limits_proto_rawDesc = []byte{
+	0x0a, 0x27, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73,
+	0x2f, 0x76, 0x31, 0x2f, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x5f, 0x6c, 0x69, 0x6d,
+	0x69, 0x74, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x11, 0x76, 0x65, 0x6c, 0x6f, 0x63,
+	0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xea, 0x01,
+	0x0a, 0x0b, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1f, 0x0a,
+	0x0b, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1f,
+	0x0a, 0x0b, 0x6c, 0x6f, 0x61, 0x64, 0x5f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0a, 0x6c, 0x6f, 0x61, 0x64, 0x41, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x12,
+	0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12,
+	0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x12, 0x24, 0x0a, 0x0e, 0x74, 0x6f, 0x5f, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d,
+	0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x74, 0x6f, 0x43,
+	0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x6f, 0x72, 0x69,
+	0x67, 0x69, 0x6e, 0x61, 0x6c, 0x5f, 0x69, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a,
+	0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c, 0x49, 0x64, 0x22, 0xc5, 0x01, 0x0a, 0x08, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x63, 0x75, 0x73, 0x74, 0x6f,
+	0x6d, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x63, 0x75,
+	0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x63, 0x63, 0x65,
+	0x70, 0x74, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x61, 0x63, 0x63, 0x65,
+	0x70, 0x74, 0x65, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x3c, 0x0a, 0x08,
+	0x68, 0x65, 0x61, 0x64, 0x72, 0x6f, 0x6f, 0x6d, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x20,
+	0x2e, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x2e,
+	0x76, 0x31, 0x2e, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x48, 0x65, 0x61, 0x64, 0x72, 0x6f, 0x6f, 0x6d,
+	0x52, 0x08, 0x68, 0x65, 0x61, 0x64, 0x72, 0x6f, 0x6f, 0x6d, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65,
+	0x70, 0x6c, 0x61, 0x79, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x72, 0x65, 0x70, 0x6c,
+	0x61, 0x79, 0x22, 0xac, 0x01, 0x0a, 0x0d, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x48, 0x65, 0x61, 0x64,
+	0x72, 0x6f, 0x6f, 0x6d, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x2e, 0x0a, 0x10, 0x72, 0x65,
+	0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0f, 0x72, 0x65, 0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e,
+	0x67, 0x41, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x88, 0x01, 0x01, 0x12, 0x2c, 0x0a, 0x0f, 0x72, 0x65,
+	0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x03, 0x48, 0x01, 0x52, 0x0e, 0x72, 0x65, 0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67,
+	0x43, 0x6f, 0x75, 0x6e, 0x74, 0x88, 0x01, 0x01, 0x42, 0x13, 0x0a, 0x11, 0x5f, 0x72, 0x65, 0x6d,
+	0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x42, 0x12, 0x0a,
+	0x10, 0x5f, 0x72, 0x65, 0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x63, 0x6f, 0x75, 0x6e,
+	0x74, 0x32, 0xae, 0x01, 0x0a, 0x0e, 0x56, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x4c, 0x69,
+	0x6d, 0x69, 0x74, 0x73, 0x12, 0x48, 0x0a, 0x09, 0x4c, 0x6f, 0x61, 0x64, 0x46, 0x75, 0x6e, 0x64,
+	0x73, 0x12, 0x1e, 0x2e, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x1a, 0x1b, 0x2e, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x52,
+	0x0a, 0x0f, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4c, 0x6f, 0x61, 0x64, 0x46, 0x75, 0x6e, 0x64,
+	0x73, 0x12, 0x1e, 0x2e, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x1a, 0x1b, 0x2e, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01,
+	0x30, 0x01, 0x42, 0x38, 0x5a, 0x36, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69, 0x74, 0x79, 0x2d, 0x6c,
+	0x69, 0x6d, 0x69, 0x74, 0x73, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x76, 0x65, 0x6c, 0x6f, 0x63, 0x69,
+	0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x2f, 0x76, 0x31, 0x3b, 0x76, 0x65, 0x6c, 0x6f,
+	0x63, 0x69, 0x74, 0x79, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_velocitylimits_v1_velocity_limits_proto_rawDescOnce sync.Once
+	file_velocitylimits_v1_velocity_limits_proto_rawDescData = file_velocitylimits_v1_velocity_limits_proto_rawDesc
+)
+
+func file_velocitylimits_v1_velocity_limits_proto_rawDescGZIP() []byte {
+	file_velocitylimits_v1_velocity_limits_proto_rawDescOnce.Do(func() {
+		file_velocitylimits_v1_velocity_limits_proto_rawDescData = protoimpl.X.CompressGZIP(file_velocitylimits_v1_velocity_limits_proto_rawDescData)
+	})
+	return file_velocitylimits_v1_velocity_limits_proto_rawDescData
+}
+
+var file_velocitylimits_v1_velocity_limits_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_velocitylimits_v1_velocity_limits_proto_goTypes = []interface{}{
+	(*Transaction)(nil),           // 0: velocitylimits.v1.Transaction
+	(*Response)(nil),              // 1: velocitylimits.v1.Response
+	(*LimitHeadroom)(nil),         // 2: velocitylimits.v1.LimitHeadroom
+	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
+}
+var file_velocitylimits_v1_velocity_limits_proto_depIdxs = []int32{
+	3, // 0: velocitylimits.v1.Transaction.time:type_name -> google.protobuf.Timestamp
+	2, // 1: velocitylimits.v1.Response.headroom:type_name -> velocitylimits.v1.LimitHeadroom
+	0, // 2: velocitylimits.v1.VelocityLimits.LoadFunds:input_type -> velocitylimits.v1.Transaction
+	0, // 3: velocitylimits.v1.VelocityLimits.StreamLoadFunds:input_type -> velocitylimits.v1.Transaction
+	1, // 4: velocitylimits.v1.VelocityLimits.LoadFunds:output_type -> velocitylimits.v1.Response
+	1, // 5: velocitylimits.v1.VelocityLimits.StreamLoadFunds:output_type -> velocitylimits.v1.Response
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_velocitylimits_v1_velocity_limits_proto_init() }
+func file_velocitylimits_v1_velocity_limits_proto_init() {
+	if File_velocitylimits_v1_velocity_limits_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_velocitylimits_v1_velocity_limits_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Transaction); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_velocitylimits_v1_velocity_limits_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Response); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_velocitylimits_v1_velocity_limits_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LimitHeadroom); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_velocitylimits_v1_velocity_limits_proto_msgTypes[2].OneofWrappers = []interface{}{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_velocitylimits_v1_velocity_limits_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_velocitylimits_v1_velocity_limits_proto_goTypes,
+		DependencyIndexes: file_velocitylimits_v1_velocity_limits_proto_depIdxs,
+		MessageInfos:      file_velocitylimits_v1_velocity_limits_proto_msgTypes,
+	}.Build()
+	File_velocitylimits_v1_velocity_limits_proto = out.File
+	file_velocitylimits_v1_velocity_limits_proto_rawDesc = nil
+	file_velocitylimits_v1_velocity_limits_proto_goTypes = nil
+	file_velocitylimits_v1_velocity_limits_proto_depIdxs = nil
+}
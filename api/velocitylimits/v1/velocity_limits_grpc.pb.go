@@ -0,0 +1,186 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: velocitylimits/v1/velocity_limits.proto
+
+package velocitylimitsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// VelocityLimitsClient is the client API for VelocityLimits service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type VelocityLimitsClient interface {
+	// LoadFunds decides a single load. Other types and invalid loads return INVALID_ARGUMENT
+	// and other payloads with the ID of a processed transaction return ALREADY_EXISTS,
+	// while a retry of a processed transaction returns the original response as a replay.
+	LoadFunds(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Response, error)
+	// StreamLoadFunds decides a stream of transactions and returns one response for every
+	// transaction in the order they were sent. Invalid and repeated transactions are
+	// declined with their reason instead of ending the stream.
+	StreamLoadFunds(ctx context.Context, opts ...grpc.CallOption) (VelocityLimits_StreamLoadFundsClient, error)
+}
+
+type velocityLimitsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVelocityLimitsClient(cc grpc.ClientConnInterface) VelocityLimitsClient {
+	return &velocityLimitsClient{cc}
+}
+
+func (c *velocityLimitsClient) LoadFunds(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/velocitylimits.v1.VelocityLimits/LoadFunds", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *velocityLimitsClient) StreamLoadFunds(ctx context.Context, opts ...grpc.CallOption) (VelocityLimits_StreamLoadFundsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &VelocityLimits_ServiceDesc.Streams[0], "/velocitylimits.v1.VelocityLimits/StreamLoadFunds", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &velocityLimitsStreamLoadFundsClient{stream}
+	return x, nil
+}
+
+type VelocityLimits_StreamLoadFundsClient interface {
+	Send(*Transaction) error
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type velocityLimitsStreamLoadFundsClient struct {
+	grpc.ClientStream
+}
+
+func (x *velocityLimitsStreamLoadFundsClient) Send(m *Transaction) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *velocityLimitsStreamLoadFundsClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// VelocityLimitsServer is the server API for VelocityLimits service.
+// All implementations must embed UnimplementedVelocityLimitsServer
+// for forward compatibility
+type VelocityLimitsServer interface {
+	// LoadFunds decides a single load. Other types and invalid loads return INVALID_ARGUMENT
+	// and other payloads with the ID of a processed transaction return ALREADY_EXISTS,
+	// while a retry of a processed transaction returns the original response as a replay.
+	LoadFunds(context.Context, *Transaction) (*Response, error)
+	// StreamLoadFunds decides a stream of transactions and returns one response for every
+	// transaction in the order they were sent. Invalid and repeated transactions are
+	// declined with their reason instead of ending the stream.
+	StreamLoadFunds(VelocityLimits_StreamLoadFundsServer) error
+	mustEmbedUnimplementedVelocityLimitsServer()
+}
+
+// UnimplementedVelocityLimitsServer must be embedded to have forward compatible implementations.
+type UnimplementedVelocityLimitsServer struct {
+}
+
+func (UnimplementedVelocityLimitsServer) LoadFunds(context.Context, *Transaction) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoadFunds not implemented")
+}
+func (UnimplementedVelocityLimitsServer) StreamLoadFunds(VelocityLimits_StreamLoadFundsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLoadFunds not implemented")
+}
+func (UnimplementedVelocityLimitsServer) mustEmbedUnimplementedVelocityLimitsServer() {}
+
+// UnsafeVelocityLimitsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VelocityLimitsServer will
+// result in compilation errors.
+type UnsafeVelocityLimitsServer interface {
+	mustEmbedUnimplementedVelocityLimitsServer()
+}
+
+func RegisterVelocityLimitsServer(s grpc.ServiceRegistrar, srv VelocityLimitsServer) {
+	s.RegisterService(&VelocityLimits_ServiceDesc, srv)
+}
+
+func _VelocityLimits_LoadFunds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VelocityLimitsServer).LoadFunds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/velocitylimits.v1.VelocityLimits/LoadFunds",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VelocityLimitsServer).LoadFunds(ctx, req.(*Transaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VelocityLimits_StreamLoadFunds_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VelocityLimitsServer).StreamLoadFunds(&velocityLimitsStreamLoadFundsServer{stream})
+}
+
+type VelocityLimits_StreamLoadFundsServer interface {
+	Send(*Response) error
+	Recv() (*Transaction, error)
+	grpc.ServerStream
+}
+
+type velocityLimitsStreamLoadFundsServer struct {
+	grpc.ServerStream
+}
+
+func (x *velocityLimitsStreamLoadFundsServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *velocityLimitsStreamLoadFundsServer) Recv() (*Transaction, error) {
+	m := new(Transaction)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// VelocityLimits_ServiceDesc is the grpc.ServiceDesc for VelocityLimits service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VelocityLimits_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "velocitylimits.v1.VelocityLimits",
+	HandlerType: (*VelocityLimitsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LoadFunds",
+			Handler:    _VelocityLimits_LoadFunds_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLoadFunds",
+			Handler:       _VelocityLimits_StreamLoadFunds_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "velocitylimits/v1/velocity_limits.proto",
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/internal/metrics"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/server"
+	"velocity-limits/internal/service"
+	"velocity-limits/internal/storage"
+	"velocity-limits/pkg/util"
+)
+
+// runProcess streams transactions from the input, loads funds on the configured number of
+// workers and writes each response to the output in input order. At the end the metrics
+// of the run and a snapshot of the state are written to their files if there are ones.
+func runProcess(args []string) error {
+	flags, o := newFlagSet("process", "")
+	flags.Int("workers", 0, "number of goroutines transactions are processed on, sharded by customer")
+	flags.String("metrics-file", "", "file the metrics are written to at the end of the run, \"-\" writes stderr")
+	flags.String("snapshot", "", "snapshot file the state is written to at the end of the run")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+	configuration, root, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStorage(configuration, root)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// Open the input and output files, "-" selects stdin and stdout.
+	input, err := util.OpenInput(configuration, root)
+	if err != nil {
+		return fmt.Errorf("opening input file: %w", err)
+	}
+	defer input.Close()
+	output, err := util.CreateOutput(configuration, root)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer output.Close()
+	deadLetters, err := util.CreateDeadLetters(configuration, root)
+	if err != nil {
+		return fmt.Errorf("creating dead-letter file: %w", err)
+	}
+	if deadLetters != nil {
+		defer deadLetters.Close()
+	}
+	if err = service.NewProcessor(configuration, store, configuration.Workers).ProcessStream(input, output, deadLetters); err != nil {
+		return err
+	}
+	if err = writeMetrics(configuration, root, store); err != nil {
+		return err
+	}
+	return writeSnapshot(configuration, root, store)
+}
+
+// openStorage opens the configured storage and restores the snapshot of the restore file
+// into it if there's one.
+func openStorage(configuration *config.Configuration, root string) (storage.Storage, error) {
+	store, err := storage.Open(configuration, root)
+	if err != nil {
+		return nil, fmt.Errorf("opening storage: %w", err)
+	}
+	if configuration.RestoreFile == "" {
+		return store, nil
+	}
+	file, err := os.Open(util.ResolvePath(root, configuration.RestoreFile))
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("opening restore file: %w", err)
+	}
+	defer file.Close()
+	if err = service.RestoreSnapshot(configuration, store, file); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("restoring snapshot %s: %w", configuration.RestoreFile, err)
+	}
+	return store, nil
+}
+
+// writeSnapshot writes a snapshot of the storage to the snapshot file if there's one. It's
+// written to a temporary file which replaces the snapshot file, so a failed write keeps the
+// previous snapshot and the restore file may be the same file.
+func writeSnapshot(configuration *config.Configuration, root string, store storage.Storage) error {
+	if configuration.SnapshotFile == "" {
+		return nil
+	}
+	path := util.ResolvePath(root, configuration.SnapshotFile)
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating snapshot file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if err = service.WriteSnapshot(configuration, store, file); err != nil {
+		file.Close()
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// writeMetrics writes the metrics with the accounts of the storage to the metrics file.
+func writeMetrics(configuration *config.Configuration, root string, store storage.Storage) error {
+	file, err := util.CreateMetricsFile(configuration, root)
+	if err != nil || file == nil {
+		return err
+	}
+	defer file.Close()
+	if err = metrics.Write(metrics.NewRegistry(store), file); err != nil {
+		return fmt.Errorf("writing metrics file: %w", err)
+	}
+	return nil
+}
+
+// runServe serves the HTTP API and the gRPC service on one storage until the process
+// receives an interrupt or terminate signal, then writes a snapshot to the snapshot file.
+func runServe(args []string) error {
+	flags, o := newFlagSet("serve", "")
+	flags.String("addr", "", "address to listen on, e.g. :8080")
+	flags.String("grpc-addr", "", "address the gRPC service listens on, e.g. :9090")
+	flags.String("snapshot", "", "snapshot file the state is written to when the server stops")
+	flags.Parse(args)
+	configuration, root, err := o.load()
+	if err != nil {
+		return err
+	}
+	// Transactions sent to the server are checked against the wall clock.
+	configuration.Clock = time.Now
+	store, err := openStorage(configuration, root)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	engine := server.NewServer(configuration, store)
+	httpServer := &http.Server{
+		Addr:    configuration.ServerAddress,
+		Handler: engine.Handler(),
+	}
+	grpcServer := engine.GRPCServer()
+	if configuration.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", configuration.GRPCAddress)
+		if err != nil {
+			return fmt.Errorf("listening for gRPC: %w", err)
+		}
+		log.Printf("Listening for gRPC on %s\n", configuration.GRPCAddress)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("Error - Serving gRPC: %v\n", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Wait for in-flight requests to finish before returning.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error - Shutting down server: %v\n", err)
+		}
+		// Open streams are cancelled when they don't end before the timeout.
+		grpcStopped := make(chan struct{})
+		go func() {
+			defer close(grpcStopped)
+			grpcServer.GracefulStop()
+		}()
+		select {
+		case <-grpcStopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}()
+
+	log.Printf("Listening on %s\n", configuration.ServerAddress)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	return writeSnapshot(configuration, root, store)
+}
+
+// runSimulate replays the input file with the limit overrides and the config file given as
+// argument, which defaults to the config, and prints the differences to the baseline
+// responses, which default to the output file.
+func runSimulate(args []string) error {
+	flags, o := newFlagSet("simulate", "[CONFIG]")
+	baselineFile := flags.String("baseline", "", "responses to compare with, by default the output file")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments %q", flags.Args()[1:])
+	}
+
+	// Limit overrides only apply to the simulated config.
+	limits := o.limits
+	o.limits = nil
+	baseConfig, root, err := o.load()
+	if err != nil {
+		return err
+	}
+	simulationFile, err := o.configPath()
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 1 {
+		simulationFile = flags.Arg(0)
+		if info, err := os.Stat(simulationFile); err == nil && info.IsDir() {
+			simulationFile = filepath.Join(simulationFile, config.FileName)
+		}
+	}
+	simulationConfig, err := config.LoadConfigFile(simulationFile, config.Options{Limits: limits})
+	if err != nil {
+		return fmt.Errorf("loading simulated config %s: %w", simulationFile, err)
+	}
+
+	transactions, err := service.GetTransactionsFromInputFile(baseConfig, root)
+	if err != nil {
+		return fmt.Errorf("reading input file: %w", err)
+	}
+	if *baselineFile == "" {
+		*baselineFile = util.ResolvePath(root, baseConfig.OutputFile)
+	}
+	file, err := os.Open(*baselineFile)
+	if err != nil {
+		return fmt.Errorf("opening baseline file: %w", err)
+	}
+	defer file.Close()
+	baseline, err := service.ReadResponses(file)
+	if err != nil {
+		return fmt.Errorf("reading baseline file: %w", err)
+	}
+
+	report, err := service.Simulate(&simulationConfig, transactions, baseline)
+	if err != nil {
+		return fmt.Errorf("simulating: %w", err)
+	}
+	return service.WriteSimulationReport(report, os.Stdout)
+}
+
+// runVerify processes the input file on a new in-memory storage and prints the lines which
+// differ from the expected file given as argument, which defaults to the output file.
+// Returns errVerificationFailed when any line differs.
+func runVerify(args []string) error {
+	flags, o := newFlagSet("verify", "[EXPECTED]")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments %q", flags.Args()[1:])
+	}
+	configuration, root, err := o.load()
+	if err != nil {
+		return err
+	}
+	expectedFile := flags.Arg(0)
+	if expectedFile == "" {
+		expectedFile = util.ResolvePath(root, configuration.OutputFile)
+	}
+
+	input, err := util.OpenInput(configuration, root)
+	if err != nil {
+		return fmt.Errorf("opening input file: %w", err)
+	}
+	defer input.Close()
+	expected, err := os.Open(expectedFile)
+	if err != nil {
+		return fmt.Errorf("opening expected file: %w", err)
+	}
+	defer expected.Close()
+
+	mismatches, err := service.Verify(configuration, input, expected)
+	if err != nil {
+		return fmt.Errorf("verifying: %w", err)
+	}
+	if err = service.WriteMismatches(mismatches, os.Stdout); err != nil {
+		return err
+	}
+	if len(mismatches) > 0 {
+		return errVerificationFailed
+	}
+	return nil
+}
+
+// runInspect prints the limits, the ledger or the audit log of a customer. The in-memory
+// storage starts empty, so the input file is processed into it first.
+func runInspect(args []string) error {
+	flags, o := newFlagSet("inspect", "")
+	customerID := flags.String("customer", "", "customer ID to inspect (required)")
+	at := flags.String("at", "", "evaluate the limits at this RFC 3339 time instead of now")
+	ledger := flags.Bool("ledger", false, "print the ledger entries and balances instead of the limits")
+	audit := flags.Bool("audit", false, "print the audit log as JSON lines instead of the limits")
+	from := flags.String("from", "", "with -audit, only print transactions at or after this RFC 3339 time")
+	to := flags.String("to", "", "with -audit, only print transactions before this RFC 3339 time")
+	flags.Parse(args)
+	if *customerID == "" {
+		return errors.New("missing -customer")
+	}
+	configuration, root, err := o.load()
+	if err != nil {
+		return err
+	}
+	memory := configuration.Storage == "" || configuration.Storage == storage.TypeMemory
+	if memory {
+		// The input is processed again, so its records go to a temporary audit file
+		// instead of being appended to the AUDIT_FILE twice.
+		dir, err := os.MkdirTemp("", "velocity-limits")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		configuration.AuditFile = filepath.Join(dir, "audit.jsonl")
+	}
+	store, err := openStorage(configuration, root)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if memory {
+		input, err := util.OpenInput(configuration, root)
+		if err != nil {
+			return fmt.Errorf("opening input file: %w", err)
+		}
+		defer input.Close()
+		if err = service.ProcessStream(configuration, store, input, io.Discard, nil); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case *audit:
+		fromTime, err := parseTimeFlag(*from)
+		if err != nil {
+			return fmt.Errorf("invalid -from time: %w", err)
+		}
+		toTime, err := parseTimeFlag(*to)
+		if err != nil {
+			return fmt.Errorf("invalid -to time: %w", err)
+		}
+		return service.WriteAudit(store, *customerID, fromTime, toTime, os.Stdout)
+	case *ledger:
+		entries, err := store.GetLedger(*customerID)
+		if err != nil {
+			return err
+		}
+		return writeIndented(&server.LedgerResponse{CustomerID: *customerID, Balances: models.LedgerBalance(entries), Entries: entries})
+	}
+
+	atTime := time.Now().UTC()
+	if *at != "" {
+		if atTime, err = parseTimeFlag(*at); err != nil {
+			return fmt.Errorf("invalid -at time: %w", err)
+		}
+	}
+	limits, err := server.NewServer(configuration, store).CustomerLimits(*customerID, atTime)
+	if err != nil {
+		return err
+	}
+	if limits == nil {
+		return fmt.Errorf("customer %q not found", *customerID)
+	}
+	return writeIndented(limits)
+}
+
+// writeIndented writes the value as indented JSON to stdout.
+func writeIndented(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// parseTimeFlag parses an RFC 3339 time flag, an empty flag is the zero time.
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
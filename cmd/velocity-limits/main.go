@@ -1,31 +1,212 @@
-// Package main is an entrypoint for our application. It reads the file, loads transactions
-// and write to output file.
+// Package main is the command-line entrypoint of our application. The process command reads
+// the input file, loads transactions and writes the output file, serve runs an HTTP server for
+// real-time loads, simulate replays the input with other limits, verify compares the responses
+// with an expected file and inspect prints the state of a customer.
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	// Embeds the time zone database for images without zoneinfo files.
+	_ "time/tzdata"
 	"velocity-limits/config"
-	"velocity-limits/internal/service"
-	"velocity-limits/internal/storage"
 )
 
+// command struct represents a subcommand with its one-line summary.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+// commands are the subcommands by name, process runs when no subcommand is given.
+var commands map[string]command
+
+// Registers the commands in init since their flag usage refers to the commands.
+func init() {
+	commands = map[string]command{
+		"process":  {"process the input file and write the responses to the output file", runProcess},
+		"serve":    {"run an HTTP server for real-time decisions", runServe},
+		"simulate": {"replay the input file with other limits and report the changed decisions", runSimulate},
+		"verify":   {"process the input file and compare the responses with an expected file", runVerify},
+		"inspect":  {"print the limits, ledger or audit log of a customer", runInspect},
+	}
+}
+
+// errVerificationFailed is returned by verify when responses differ, after printing them.
+var errVerificationFailed = errors.New("responses differ from the expected file")
+
+// helpArgs are the first arguments which print the subcommands instead of running process.
+var helpArgs = map[string]bool{"help": true, "-h": true, "-help": true, "--help": true}
+
 func main() {
-	// Define project root path and get config, storage structs.
-	projectRootPath := "../../"
-	config := config.LoadConfig(projectRootPath + "config/")
-	storage := storage.NewStorage()
+	name, args := "process", os.Args[1:]
+	if len(args) > 0 && helpArgs[args[0]] {
+		// help <command> prints the flags of the command.
+		if len(args) > 1 && args[0] == "help" && commands[args[1]].run != nil {
+			commands[args[1]].run([]string{"-h"})
+		}
+		usage(os.Stdout)
+		return
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	err := command.run(args)
+	if errors.Is(err, errVerificationFailed) {
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal("Error - ", err)
+	}
+}
+
+// usage prints the subcommands to the writer.
+func usage(writer io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(writer, "Usage: velocity-limits [command] [flags]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(writer, "  %-9s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(writer, "\nThe default command is process. Run velocity-limits <command> -h for its flags.\n")
+}
+
+// settingFlags maps the flags which override a config to the config name.
+var settingFlags = map[string]string{
+	"input":        "INPUT_FILE",
+	"output":       "OUTPUT_FILE",
+	"format":       "OUTPUT_FORMAT",
+	"dead-letters": "DEAD_LETTER_FILE",
+	"metrics-file": "METRICS_FILE",
+	"storage":      "STORAGE",
+	"sqlite-file":  "SQLITE_FILE",
+	"restore":      "RESTORE_FILE",
+	"snapshot":     "SNAPSHOT_FILE",
+	"addr":         "SERVER_ADDRESS",
+	"grpc-addr":    "GRPC_ADDRESS",
+	"workers":      "WORKERS",
+}
 
-	// Try reading an input file and get transactions array.
-	transactions, err := service.GetTransactionsFromInputFile(&config, projectRootPath)
+// fileFlags are the setting flags with file paths, which are relative to the working directory.
+var fileFlags = map[string]bool{"input": true, "output": true, "dead-letters": true, "metrics-file": true, "sqlite-file": true, "restore": true, "snapshot": true}
+
+// options struct represents the flags shared by all commands: the config file, the config
+// overrides and the limit overrides.
+type options struct {
+	flags      *flag.FlagSet
+	configFile string
+	limits     limitFlags
+}
+
+// newFlagSet returns the flag set of a command with the shared flags registered.
+func newFlagSet(name, arguments string) (*flag.FlagSet, *options) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: velocity-limits %s [flags] %s\n\n%s.\n\nFlags:\n", name, arguments, commands[name].summary)
+		flags.PrintDefaults()
+	}
+	o := &options{flags: flags}
+	flags.StringVar(&o.configFile, "config", "", "config file, by default $"+config.EnvPrefix+"_CONFIG or config/"+config.FileName+" of the working directory or its closest parent with one")
+	flags.Var(&o.limits, "limit", "override the threshold of a limit rule as NAME=THRESHOLD, e.g. weekly_amount=$15,000 (repeatable)")
+	flags.String("input", "", "input file, \"-\" reads stdin")
+	flags.String("output", "", "output file, \"-\" writes stdout")
+	flags.String("format", "", "output format, legacy or detailed")
+	flags.String("dead-letters", "", "dead-letter file for input lines which can't be processed, \"-\" writes stderr")
+	flags.String("storage", "", "storage type, memory or sqlite")
+	flags.String("sqlite-file", "", "SQLite database file")
+	flags.String("restore", "", "snapshot file the storage is restored from on start")
+	return flags, o
+}
+
+// load returns the config with the flags and VELOCITY_ environment variables applied, and
+// the project root the file names of the config file are relative to, which is the parent
+// of the config directory. File flags are relative to the working directory instead.
+func (o *options) load() (*config.Configuration, string, error) {
+	file, err := o.configPath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	settings := make(map[string]string)
+	var flagErr error
+	o.flags.Visit(func(f *flag.Flag) {
+		name, ok := settingFlags[f.Name]
+		if !ok {
+			return
+		}
+		value := f.Value.String()
+		if fileFlags[f.Name] && value != "" && value != "-" {
+			if value, err = filepath.Abs(value); err != nil {
+				flagErr = err
+			}
+		}
+		settings[name] = value
+	})
+	if flagErr != nil {
+		return nil, "", flagErr
+	}
+
+	configuration, err := config.LoadConfigFile(file, config.Options{Settings: settings, Limits: o.limits})
 	if err != nil {
-		log.Fatal("Error - from GetTransaction function: ", err)
+		return nil, "", fmt.Errorf("loading config %s: %w", file, err)
 	}
+	return &configuration, filepath.Dir(filepath.Dir(file)), nil
+}
+
+// configPath returns the absolute path of the config file given by the -config flag, the
+// VELOCITY_CONFIG environment variable or found from the working directory.
+func (o *options) configPath() (string, error) {
+	file := o.configFile
+	if file == "" {
+		file = os.Getenv(config.EnvPrefix + "_CONFIG")
+	}
+	if file == "" {
+		return config.FindConfigFile(".")
+	}
+	return filepath.Abs(file)
+}
+
+// limitFlags collects repeated -limit NAME=THRESHOLD flags.
+type limitFlags []config.LimitOverride
 
-	// Load funds from transactions and create responses array to store result from each transaction.
-	responses := service.LoadFunds(&config, transactions, storage)
+func (l *limitFlags) String() string {
+	values := make([]string, len(*l))
+	for i, limit := range *l {
+		values[i] = limit.Name + "=" + limit.Threshold
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *limitFlags) Set(value string) error {
+	name, threshold, ok := cut(value, "=")
+	if !ok || name == "" || threshold == "" {
+		return fmt.Errorf("%q isn't NAME=THRESHOLD", value)
+	}
+	*l = append(*l, config.LimitOverride{Name: name, Threshold: threshold})
+	return nil
+}
 
-	// Write responses to the output file.
-	if err = service.WriteResponsesToOutputFile(&config, responses, projectRootPath); err != nil {
-		log.Fatal("Error -  from WriteResponsesToOutputFile function: ", err)
+// cut slices s around the first separator, like strings.Cut of newer Go versions.
+func cut(s, separator string) (before, after string, found bool) {
+	if i := strings.Index(s, separator); i >= 0 {
+		return s[:i], s[i+len(separator):], true
 	}
+	return s, "", false
 }
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Calendar struct defines calendar windows of a customer: the time zone days start
+// in and the first day of the week.
+type Calendar struct {
+	Location  *time.Location
+	WeekStart time.Weekday
+}
+
+// DefaultCalendar is used by rules without a calendar.
+var DefaultCalendar = Calendar{Location: time.UTC, WeekStart: time.Monday}
+
+// locations caches loaded time zones by name, since loading reads the zoneinfo database.
+var locations sync.Map
+
+// LoadLocation returns the time zone with the given IANA name, e.g. "Asia/Tokyo".
+// An empty name returns UTC.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// ParseWeekday parses a weekday name such as "monday" or "Sun".
+func ParseWeekday(name string) (time.Weekday, error) {
+	value := strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		dayName := strings.ToLower(day.String())
+		if value == dayName || (len(value) == 3 && strings.HasPrefix(dayName, value)) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday %q", name)
+}
+
+// String returns the time zone and the first day of the week of the calendar, such as
+// "America/Toronto monday", which ParseCalendar parses.
+func (c Calendar) String() string {
+	return c.Location.String() + " " + strings.ToLower(c.WeekStart.String())
+}
+
+// ParseCalendar parses a calendar written by Calendar.String.
+func ParseCalendar(value string) (Calendar, error) {
+	separator := strings.LastIndex(value, " ")
+	if separator < 0 {
+		return Calendar{}, fmt.Errorf("invalid calendar %q", value)
+	}
+	location, err := LoadLocation(value[:separator])
+	if err != nil {
+		return Calendar{}, err
+	}
+	weekStart, err := ParseWeekday(value[separator+1:])
+	if err != nil {
+		return Calendar{}, err
+	}
+	return Calendar{Location: location, WeekStart: weekStart}, nil
+}
+
+// parseCalendar validates the default time zone and parses the first day of the week.
+func (c *Config) parseCalendar() error {
+	if _, err := LoadLocation(c.TimeZone); err != nil {
+		return fmt.Errorf("time zone: %w", err)
+	}
+	c.weekStart = time.Monday
+	if c.WeekStart != "" {
+		weekStart, err := ParseWeekday(c.WeekStart)
+		if err != nil {
+			return fmt.Errorf("week start: %w", err)
+		}
+		c.weekStart = weekStart
+	}
+	return nil
+}
@@ -2,41 +2,275 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
 
+	"velocity-limits/pkg/fx"
+	"velocity-limits/pkg/money"
+
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
+// Output formats for responses written to the output file. The legacy format is
+// byte-for-byte compatible with the original output, while the detailed format
+// also contains decline reasons and remaining velocity limits.
+const (
+	OutputFormatLegacy   = "legacy"
+	OutputFormatDetailed = "detailed"
+)
+
 // Config struct contains all velocity limits and input, output file names.
+// Limits declares the velocity limit rules, built from the MAX_LOAD_* configs when it's empty.
+// Tiers and Customers override limit thresholds for groups of customers and single customers.
+// TimeZone and WeekStart define calendar windows of customers without their own time zone.
+// LateTolerance is how much older than the latest load of a customer a load may be.
+// FutureTolerance is how much later than the Clock a transaction may be, there's no check without one.
+// DuplicateRetention and DuplicateMaxIDs bound the processed IDs, zero values keep all of them.
+// DuplicateMaxResponses bounds the responses and AuditFile is the audit log of the in-memory storage.
+// Workers is the number of goroutines input files are processed on, sharded by customer.
+// Version identifies the content of the config files the configuration was loaded from.
+// Amount limits are evaluated in BaseCurrency, other currencies are converted with Rates.
 type Config struct {
-	MaxLoadLimitPerDay  float64 `mapstructure:"MAX_LOAD_LIMIT_PER_DAY"`
-	MaxLoadLimitPerWeek float64 `mapstructure:"MAX_LOAD_LIMIT_PER_WEEK"`
-	MaxLoadPerDay       int     `mapstructure:"MAX_LOAD_PER_DAY"`
-	InputFile           string  `mapstructure:"INPUT_FILE"`
-	OutputFile          string  `mapstructure:"OUTPUT_FILE"`
+	Limits                []LimitRule        `mapstructure:"LIMITS"`
+	Tiers                 []Tier             `mapstructure:"TIERS"`
+	Customers             []CustomerOverride `mapstructure:"CUSTOMERS"`
+	OverridesFile         string             `mapstructure:"OVERRIDES_FILE"`
+	TimeZone              string             `mapstructure:"TIME_ZONE"`
+	WeekStart             string             `mapstructure:"WEEK_START"`
+	LateTolerance         time.Duration      `mapstructure:"LATE_TOLERANCE"`
+	FutureTolerance       time.Duration      `mapstructure:"FUTURE_TOLERANCE"`
+	Clock                 func() time.Time   `mapstructure:"-"`
+	BaseCurrency          string             `mapstructure:"BASE_CURRENCY"`
+	FXRatesFile           string             `mapstructure:"FX_RATES_FILE"`
+	Rates                 fx.Provider        `mapstructure:"-"`
+	MaxLoadLimitPerDay    money.Money        `mapstructure:"MAX_LOAD_LIMIT_PER_DAY"`
+	MaxLoadLimitPerWeek   money.Money        `mapstructure:"MAX_LOAD_LIMIT_PER_WEEK"`
+	MaxLoadPerDay         int                `mapstructure:"MAX_LOAD_PER_DAY"`
+	InputFile             string             `mapstructure:"INPUT_FILE"`
+	OutputFile            string             `mapstructure:"OUTPUT_FILE"`
+	OutputFormat          string             `mapstructure:"OUTPUT_FORMAT"`
+	DeadLetterFile        string             `mapstructure:"DEAD_LETTER_FILE"`
+	MetricsFile           string             `mapstructure:"METRICS_FILE"`
+	ServerAddress         string             `mapstructure:"SERVER_ADDRESS"`
+	GRPCAddress           string             `mapstructure:"GRPC_ADDRESS"`
+	Workers               int                `mapstructure:"WORKERS"`
+	Storage               string             `mapstructure:"STORAGE"`
+	SQLiteFile            string             `mapstructure:"SQLITE_FILE"`
+	RestoreFile           string             `mapstructure:"RESTORE_FILE"`
+	SnapshotFile          string             `mapstructure:"SNAPSHOT_FILE"`
+	DuplicateRetention    time.Duration      `mapstructure:"DUPLICATE_RETENTION"`
+	DuplicateMaxIDs       int                `mapstructure:"DUPLICATE_MAX_IDS"`
+	DuplicateMaxResponses int                `mapstructure:"DUPLICATE_MAX_RESPONSES"`
+	AuditFile             string             `mapstructure:"AUDIT_FILE"`
+	Version               string             `mapstructure:"-"`
+
+	// Indexes of tiers and customer overrides by name and customer ID.
+	tiers     map[string]Tier
+	customers map[string]CustomerOverride
+	// Parsed WeekStart, Monday when it isn't set.
+	weekStart time.Weekday
 }
 
 type Configuration struct {
 	Config `mapstructure:"config"`
 }
 
-// LoadConfig loads velocity configs and filenames from config.toml file.
-func LoadConfig(path string) (config Configuration) {
-	viper.SetConfigName("config")
-	viper.AddConfigPath(path)
-	viper.SetConfigType("toml")
+// EnvPrefix is the prefix of environment variables which override configs, e.g.
+// VELOCITY_INPUT_FILE overrides INPUT_FILE. Lists such as LIMITS can't be overridden.
+const EnvPrefix = "VELOCITY"
+
+// FileName is the name of the config file in a config directory.
+const FileName = "config.toml"
+
+// Options struct represents overrides which take precedence over the config file and the
+// environment, such as command-line flags. Settings are keyed by config name, e.g.
+// INPUT_FILE, and Limits replace the thresholds of the global limit rules by name.
+type Options struct {
+	Settings map[string]string
+	Limits   []LimitOverride
+}
 
-	// Try reading a config.toml file.
-	err := viper.ReadInConfig()
+// LoadConfig loads velocity configs and filenames from the config.toml file of the directory.
+func LoadConfig(path string) Configuration {
+	config, err := LoadConfigFile(filepath.Join(path, FileName), Options{})
 	if err != nil {
-		log.Fatal("Error - Reading config file: ", err)
+		log.Fatal("Error - Loading config: ", err)
+	}
+	return config
+}
+
+// LoadConfigFile loads configs from the config file, overridden by VELOCITY_ environment
+// variables and then by the options. Overrides and rates files are resolved relative to
+// the directory of the config file.
+func LoadConfigFile(file string, options Options) (config Configuration, err error) {
+	// Use a new viper instance so that configs from different paths can be loaded.
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("toml")
+	if err = bindEnv(v); err != nil {
+		return config, err
+	}
+	for key, value := range options.Settings {
+		v.Set("config."+key, value)
+	}
+	path := filepath.Dir(file)
+
+	// Try reading the config.toml file.
+	if err = v.ReadInConfig(); err != nil {
+		return config, fmt.Errorf("reading config file: %w", err)
 	}
 
 	// Unmarshal configs into a configuration struct.
-	err = viper.Unmarshal(&config)
+	err = v.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		moneyHookFunc(),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)))
+	if err != nil {
+		return config, fmt.Errorf("unmarshal config file content: %w", err)
+	}
+
+	if len(config.Limits) == 0 {
+		config.Limits = defaultLimitRules(config.Config)
+	}
+	if err = config.parseCalendar(); err != nil {
+		return config, fmt.Errorf("invalid calendar: %w", err)
+	}
+	if config.LateTolerance < 0 {
+		return config, fmt.Errorf("negative late tolerance %s", config.LateTolerance)
+	}
+	if config.FutureTolerance < 0 {
+		return config, fmt.Errorf("negative future tolerance %s", config.FutureTolerance)
+	}
+	if config.DuplicateRetention < 0 || config.DuplicateMaxIDs < 0 {
+		return config, fmt.Errorf("negative duplicate retention %s or maximum %d", config.DuplicateRetention, config.DuplicateMaxIDs)
+	}
+	if config.DuplicateMaxResponses < 0 {
+		return config, fmt.Errorf("negative maximum responses %d", config.DuplicateMaxResponses)
+	}
+	if err = config.loadExchange(path); err != nil {
+		return config, fmt.Errorf("invalid exchange rates: %w", err)
+	}
+	if config.Limits, err = parseLimitRules(config.Limits); err != nil {
+		return config, fmt.Errorf("invalid limit rules: %w", err)
+	}
+	if config.Limits, err = ApplyLimitOverrides(config.Limits, options.Limits); err != nil {
+		return config, fmt.Errorf("invalid limit overrides: %w", err)
+	}
+	if err = config.loadOverrides(path); err != nil {
+		return config, fmt.Errorf("invalid limit overrides: %w", err)
+	}
+
+	files := []string{v.ConfigFileUsed()}
+	for _, file := range []string{config.OverridesFile, config.FXRatesFile} {
+		if file != "" {
+			files = append(files, resolvePath(path, file))
+		}
+	}
+	if config.Version, err = fileVersion(options.Limits, files...); err != nil {
+		return config, fmt.Errorf("reading config files: %w", err)
+	}
+
+	switch config.OutputFormat {
+	case "":
+		config.OutputFormat = OutputFormatLegacy
+	case OutputFormatLegacy, OutputFormatDetailed:
+	default:
+		return config, fmt.Errorf("unknown output format %q", config.OutputFormat)
+	}
+	return config, nil
+}
+
+// FindConfigFile returns the config/config.toml file of the directory or of its closest
+// parent directory which has one, so that the application runs from any project directory.
+func FindConfigFile(dir string) (string, error) {
+	start, err := filepath.Abs(dir)
 	if err != nil {
-		log.Fatal("Error - Unmarshal config file content: ", err)
+		return "", err
+	}
+	for dir = start; ; {
+		file := filepath.Join(dir, "config", FileName)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no config/%s found in %s or its parent directories", FileName, start)
+		}
+		dir = parent
+	}
+}
+
+// IsLegacyOutput reports whether responses are written in the original output format.
+func (c *Config) IsLegacyOutput() bool {
+	return c.OutputFormat != OutputFormatDetailed
+}
+
+// resolvePath returns the file path relative to the config directory unless it's absolute.
+func resolvePath(path, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(path, file)
+}
+
+// fileVersion returns the first 12 hex digits of the SHA-256 of the files content and
+// of the limit overrides, which don't change the version when there are none.
+func fileVersion(limits []LimitOverride, files ...string) (string, error) {
+	hash := sha256.New()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(content)
 	}
+	for _, limit := range limits {
+		fmt.Fprintf(hash, "%s=%s\n", limit.Name, limit.Threshold)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// bindEnv binds every config which isn't a list to the environment variable of its name
+// with the VELOCITY_ prefix.
+func bindEnv(v *viper.Viper) error {
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" || field.Type.Kind() == reflect.Slice {
+			continue
+		}
+		if err := v.BindEnv("config."+name, EnvPrefix+"_"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return
+// moneyHookFunc decodes limits written either as numbers (5000)
+// or as strings ("$5,000.00") into the money.Money type.
+func moneyHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != reflect.TypeOf(money.Money{}) {
+			return data, nil
+		}
+		switch value := data.(type) {
+		case string:
+			return money.Parse(value)
+		case int, int32, int64:
+			return money.Parse(strconv.FormatInt(reflect.ValueOf(value).Int(), 10))
+		case float32, float64:
+			return money.Parse(strconv.FormatFloat(reflect.ValueOf(value).Float(), 'f', -1, 64))
+		}
+		return data, nil
+	}
 }
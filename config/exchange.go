@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"velocity-limits/pkg/fx"
+	"velocity-limits/pkg/money"
+
+	"github.com/spf13/viper"
+)
+
+// Exchange struct converts transaction amounts into the base currency limits are evaluated in.
+type Exchange struct {
+	Base  string
+	Rates fx.Provider
+}
+
+// DefaultExchange is used by rules without an exchange, it evaluates limits in the
+// default currency and has no rates for other currencies.
+var DefaultExchange = Exchange{Base: money.DefaultCurrency}
+
+// Convert returns the amount in the base currency.
+// Returns an error when there's no exchange rate for the amount currency.
+func (e Exchange) Convert(amount money.Money) (money.Money, error) {
+	return fx.Convert(e.Rates, amount, e.Base)
+}
+
+// ratesFile struct represents the content of the FX_RATES_FILE: the value of one unit
+// of every currency in the BASE currency of the table.
+type ratesFile struct {
+	Base  string            `mapstructure:"BASE"`
+	Rates map[string]string `mapstructure:"RATES"`
+}
+
+// loadExchange validates the base currency and loads the static exchange rates of the
+// FX_RATES_FILE, which is resolved relative to the config directory.
+func (c *Config) loadExchange(path string) error {
+	c.BaseCurrency = strings.ToUpper(c.BaseCurrency)
+	if c.BaseCurrency == "" {
+		c.BaseCurrency = money.DefaultCurrency
+	}
+	if !money.IsCurrency(c.BaseCurrency) {
+		return fmt.Errorf("%w: %q", money.ErrUnknownCurrency, c.BaseCurrency)
+	}
+	if c.FXRatesFile == "" {
+		return nil
+	}
+
+	file := resolvePath(path, c.FXRatesFile)
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading exchange rates file: %w", err)
+	}
+	var rates ratesFile
+	if err := v.Unmarshal(&rates); err != nil {
+		return fmt.Errorf("unmarshal exchange rates file: %w", err)
+	}
+	provider, err := fx.NewStaticProvider(rates.Base, rates.Rates)
+	if err != nil {
+		return fmt.Errorf("exchange rates file: %w", err)
+	}
+	c.Rates = provider
+	return nil
+}
+
+// exchange returns the exchange of the config, the default currency is the base currency
+// of configs which weren't loaded from a file.
+func (c *Config) exchange() *Exchange {
+	if c.BaseCurrency == "" {
+		return &Exchange{Base: money.DefaultCurrency, Rates: c.Rates}
+	}
+	return &Exchange{Base: c.BaseCurrency, Rates: c.Rates}
+}
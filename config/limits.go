@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"velocity-limits/pkg/money"
+)
+
+// Windows a limit rule aggregates loads over. Calendar windows start at the
+// beginning of the hour, day, week or month of the load in the customer time
+// zone, rolling windows cover the last N hours before the load.
+const (
+	WindowHour    = "hour"
+	WindowDay     = "day"
+	WindowWeek    = "week"
+	WindowMonth   = "month"
+	WindowRolling = "rolling"
+)
+
+// Metrics a limit rule aggregates: the sum of loaded amounts or the number of loads.
+const (
+	MetricAmount = "amount"
+	MetricCount  = "count"
+)
+
+// Transaction types a limit rule applies to. Rules without a type apply to loads.
+// Reversals give back the usage of the reversed load and have no rules of their own.
+const (
+	TypeLoad       = "load"
+	TypeWithdrawal = "withdrawal"
+	TypeTransfer   = "transfer"
+	TypeReversal   = "reversal"
+)
+
+// LimitRule struct declares a velocity limit as a metric aggregated over a window and its threshold.
+// The threshold is parsed into MaxAmount or MaxCount depending on the metric.
+// Calendar and Exchange are set when the rules of a customer are resolved, a nil calendar
+// means UTC with weeks starting on Monday and a nil exchange evaluates limits in USD.
+type LimitRule struct {
+	Name      string      `mapstructure:"NAME"`
+	Type      string      `mapstructure:"TYPE"`
+	Window    string      `mapstructure:"WINDOW"`
+	Hours     int         `mapstructure:"HOURS"`
+	Metric    string      `mapstructure:"METRIC"`
+	Threshold string      `mapstructure:"THRESHOLD"`
+	MaxAmount money.Money `mapstructure:"-"`
+	MaxCount  int         `mapstructure:"-"`
+	Calendar  *Calendar   `mapstructure:"-"`
+	Exchange  *Exchange   `mapstructure:"-"`
+}
+
+// IsRolling reports whether the rule uses a rolling window instead of a calendar window.
+func (r LimitRule) IsRolling() bool {
+	return r.Window == WindowRolling
+}
+
+// AppliesTo reports whether the rule limits transactions of the given type,
+// an empty type is a load.
+func (r LimitRule) AppliesTo(transactionType string) bool {
+	return NormalizeType(r.Type) == NormalizeType(transactionType)
+}
+
+// NormalizeType returns the transaction type with an empty type as a load.
+func NormalizeType(transactionType string) string {
+	if transactionType == "" {
+		return TypeLoad
+	}
+	return transactionType
+}
+
+// ParseLimitRule validates a limit rule and parses its threshold for the rule metric.
+func ParseLimitRule(rule LimitRule) (LimitRule, error) {
+	if rule.Name == "" {
+		return rule, fmt.Errorf("limit rule without a name")
+	}
+
+	switch NormalizeType(rule.Type) {
+	case TypeLoad, TypeWithdrawal, TypeTransfer:
+	default:
+		return rule, fmt.Errorf("limit rule %q: unknown transaction type %q", rule.Name, rule.Type)
+	}
+
+	switch rule.Window {
+	case WindowHour, WindowDay, WindowWeek, WindowMonth:
+	case WindowRolling:
+		if rule.Hours <= 0 {
+			return rule, fmt.Errorf("limit rule %q: rolling window needs a positive number of hours", rule.Name)
+		}
+	default:
+		return rule, fmt.Errorf("limit rule %q: unknown window %q", rule.Name, rule.Window)
+	}
+
+	threshold := strings.TrimSpace(rule.Threshold)
+	switch rule.Metric {
+	case MetricAmount:
+		amount, err := money.Parse(threshold)
+		if err != nil {
+			return rule, fmt.Errorf("limit rule %q: %w", rule.Name, err)
+		}
+		if amount.IsNegative() {
+			return rule, fmt.Errorf("limit rule %q: negative threshold %s", rule.Name, amount)
+		}
+		rule.MaxAmount = amount
+	case MetricCount:
+		count, err := strconv.Atoi(threshold)
+		if err != nil || count < 0 {
+			return rule, fmt.Errorf("limit rule %q: invalid count threshold %q", rule.Name, rule.Threshold)
+		}
+		rule.MaxCount = count
+	default:
+		return rule, fmt.Errorf("limit rule %q: unknown metric %q", rule.Name, rule.Metric)
+	}
+	return rule, nil
+}
+
+// parseLimitRules validates all limit rules and checks that rule names are unique.
+func parseLimitRules(rules []LimitRule) ([]LimitRule, error) {
+	names := make(map[string]struct{}, len(rules))
+	parsed := make([]LimitRule, 0, len(rules))
+	for _, rule := range rules {
+		rule, err := ParseLimitRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("duplicate limit rule %q", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// defaultLimitRules returns the original three velocity limits built from the
+// MAX_LOAD_LIMIT_PER_DAY, MAX_LOAD_PER_DAY and MAX_LOAD_LIMIT_PER_WEEK configs.
+func defaultLimitRules(c Config) []LimitRule {
+	return []LimitRule{
+		{Name: "daily_amount", Window: WindowDay, Metric: MetricAmount, Threshold: c.MaxLoadLimitPerDay.String()},
+		{Name: "daily_count", Window: WindowDay, Metric: MetricCount, Threshold: strconv.Itoa(c.MaxLoadPerDay)},
+		{Name: "weekly_amount", Window: WindowWeek, Metric: MetricAmount, Threshold: c.MaxLoadLimitPerWeek.String()},
+	}
+}
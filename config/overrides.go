@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// LimitOverride struct replaces the threshold of a limit rule with the same name.
+type LimitOverride struct {
+	Name      string `mapstructure:"NAME" json:"name"`
+	Threshold string `mapstructure:"THRESHOLD" json:"threshold"`
+}
+
+// Tier struct declares limit overrides shared by a group of customers, e.g. VIP or business.
+type Tier struct {
+	Name   string          `mapstructure:"NAME"`
+	Limits []LimitOverride `mapstructure:"LIMITS"`
+}
+
+// CustomerOverride struct assigns a tier, limit overrides and a time zone to a single customer.
+// Customer limit overrides take precedence over the tier ones.
+type CustomerOverride struct {
+	CustomerID string          `mapstructure:"CUSTOMER_ID"`
+	Tier       string          `mapstructure:"TIER"`
+	Limits     []LimitOverride `mapstructure:"LIMITS"`
+	TimeZone   string          `mapstructure:"TIME_ZONE"`
+}
+
+// Profile struct represents the settings of a customer changed at runtime.
+// A non-empty tier or time zone takes precedence over the config one, limit
+// overrides are applied after the config ones.
+type Profile struct {
+	Tier           string          `json:"tier,omitempty"`
+	LimitOverrides []LimitOverride `json:"limit_overrides,omitempty"`
+	TimeZone       string          `json:"time_zone,omitempty"`
+}
+
+// overridesFile struct represents the content of the OVERRIDES_FILE.
+type overridesFile struct {
+	Customers []CustomerOverride `mapstructure:"CUSTOMERS"`
+}
+
+// ApplyLimitOverrides returns a copy of the rules with the thresholds of the overridden rules replaced.
+// Returns an error when an override references an unknown rule or has an invalid threshold.
+func ApplyLimitOverrides(rules []LimitRule, overrides []LimitOverride) ([]LimitRule, error) {
+	if len(overrides) == 0 {
+		return rules, nil
+	}
+	overridden := append([]LimitRule(nil), rules...)
+	for _, override := range overrides {
+		found := false
+		for i, rule := range overridden {
+			if rule.Name != override.Name {
+				continue
+			}
+			rule.Threshold = override.Threshold
+			parsed, err := ParseLimitRule(rule)
+			if err != nil {
+				return nil, err
+			}
+			overridden[i], found = parsed, true
+		}
+		if !found {
+			return nil, fmt.Errorf("override of unknown limit rule %q", override.Name)
+		}
+	}
+	return overridden, nil
+}
+
+// LimitRulesFor returns the limit rules of a customer: the global rules overridden by
+// the tier, then by the config overrides and at last by the profile overrides.
+func (c *Config) LimitRulesFor(customerID string, profile Profile) ([]LimitRule, error) {
+	customer := c.customers[customerID]
+	tier := profile.Tier
+	if tier == "" {
+		tier = customer.Tier
+	}
+
+	rules := c.Limits
+	if tier != "" {
+		tierConfig, ok := c.tiers[tier]
+		if !ok {
+			return nil, fmt.Errorf("unknown tier %q", tier)
+		}
+		var err error
+		if rules, err = ApplyLimitOverrides(rules, tierConfig.Limits); err != nil {
+			return nil, fmt.Errorf("tier %q: %w", tier, err)
+		}
+	}
+
+	rules, err := ApplyLimitOverrides(rules, append(append([]LimitOverride(nil), customer.Limits...), profile.LimitOverrides...))
+	if err != nil {
+		return nil, fmt.Errorf("customer %q: %w", customerID, err)
+	}
+
+	timeZone := profile.TimeZone
+	if timeZone == "" {
+		timeZone = customer.TimeZone
+	}
+	if timeZone == "" {
+		timeZone = c.TimeZone
+	}
+	location, err := LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("customer %q: invalid time zone: %w", customerID, err)
+	}
+
+	calendar := &Calendar{Location: location, WeekStart: c.weekStart}
+	exchange := c.exchange()
+	resolved := make([]LimitRule, len(rules))
+	for i, rule := range rules {
+		if rule.Metric == MetricAmount && rule.MaxAmount.Currency != exchange.Base {
+			return nil, fmt.Errorf("limit rule %q: threshold %s isn't in the base currency %s", rule.Name, rule.MaxAmount, exchange.Base)
+		}
+		rule.Calendar, rule.Exchange = calendar, exchange
+		resolved[i] = rule
+	}
+	return resolved, nil
+}
+
+// HasTier reports whether a tier is declared in the config.
+func (c *Config) HasTier(tier string) bool {
+	_, ok := c.tiers[tier]
+	return ok
+}
+
+// loadOverrides indexes tiers and customer overrides from the config and the
+// OVERRIDES_FILE, which is resolved relative to the config directory, and validates them.
+func (c *Config) loadOverrides(path string) error {
+	customers := c.Customers
+	if c.OverridesFile != "" {
+		file := resolvePath(path, c.OverridesFile)
+		v := viper.New()
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading overrides file: %w", err)
+		}
+		var overrides overridesFile
+		if err := v.Unmarshal(&overrides); err != nil {
+			return fmt.Errorf("unmarshal overrides file: %w", err)
+		}
+		customers = append(append([]CustomerOverride(nil), customers...), overrides.Customers...)
+	}
+
+	c.tiers = make(map[string]Tier, len(c.Tiers))
+	for _, tier := range c.Tiers {
+		if _, ok := c.tiers[tier.Name]; ok || tier.Name == "" {
+			return fmt.Errorf("invalid or duplicate tier %q", tier.Name)
+		}
+		c.tiers[tier.Name] = tier
+	}
+
+	c.customers = make(map[string]CustomerOverride, len(customers))
+	for _, customer := range customers {
+		if _, ok := c.customers[customer.CustomerID]; ok || customer.CustomerID == "" {
+			return fmt.Errorf("invalid or duplicate customer override %q", customer.CustomerID)
+		}
+		c.customers[customer.CustomerID] = customer
+	}
+
+	// Resolve the global rules, every tier and customer once so that invalid overrides fail at start-up.
+	if _, err := c.LimitRulesFor("", Profile{}); err != nil {
+		return err
+	}
+	for name := range c.tiers {
+		if _, err := c.LimitRulesFor("", Profile{Tier: name}); err != nil {
+			return err
+		}
+	}
+	for customerID := range c.customers {
+		if _, err := c.LimitRulesFor(customerID, Profile{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
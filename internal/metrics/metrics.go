@@ -0,0 +1,123 @@
+// Package metrics collects Prometheus metrics of the decisions of the velocity limits
+// engine and exposes them over HTTP or writes them in the text exposition format.
+package metrics
+
+import (
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// namespace prefixes the names of all metrics.
+const namespace = "velocity"
+
+// Metrics of the processed transactions, which are shared by all registries. Transactions are
+// labeled with their normalized type, so loads are the transactions with type="load".
+var (
+	decisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decisions_total",
+		Help:      "Accepted and declined transactions by type and decline reason.",
+	}, []string{"type", "decision", "reason"})
+	duplicates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_total",
+		Help:      "Transactions with the ID of a processed one which weren't processed again, by reason.",
+	}, []string{"type", "reason"})
+	parseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_errors_total",
+		Help:      "Input lines and payloads which were rejected before processing, by reason.",
+	}, []string{"reason"})
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "processing_duration_seconds",
+		Help:      "Time taken to decide a transaction including the storage, by type.",
+		Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 16),
+	}, []string{"type"})
+	loadedAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "loaded_amount_total",
+		Help:      "Amount of the accepted loads in major units, by currency.",
+	}, []string{"currency"})
+)
+
+// NewRegistry returns a registry with the transaction metrics and the number of customer
+// accounts in the storage, which is counted whenever the metrics are gathered.
+func NewRegistry(storage storage.Storage) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(decisions, duplicates, parseErrors, latency, loadedAmount)
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_accounts",
+		Help:      "Customer accounts in the storage.",
+	}, func() float64 {
+		count, err := storage.CountAccounts()
+		if err != nil {
+			log.Printf("Error - Counting accounts: %v\n", err)
+			return math.NaN()
+		}
+		return float64(count)
+	}))
+	return registry
+}
+
+// Handler returns an HTTP handler serving the metrics of the registry.
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Write writes the metrics of the registry to the writer in the text exposition format.
+func Write(registry *prometheus.Registry, writer io.Writer) error {
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if _, err = expfmt.MetricFamilyToText(writer, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ObserveDecision records the response to a transaction and the time it took to decide.
+// Repeated transactions and nil responses of duplicates are counted as duplicates, the
+// amount of accepted loads is added to the loaded amount.
+func ObserveDecision(transaction *models.Transaction, response *models.Response, duration time.Duration) {
+	transactionType := transaction.NormalizedType()
+	if response == nil || response.IsRepeated() {
+		reason := models.ReasonDuplicateTransaction
+		if response != nil && !response.Replay {
+			reason = response.Reason
+		}
+		duplicates.WithLabelValues(transactionType, string(reason)).Inc()
+		return
+	}
+
+	latency.WithLabelValues(transactionType).Observe(duration.Seconds())
+	if !response.Accepted {
+		decisions.WithLabelValues(transactionType, "declined", string(response.Reason)).Inc()
+		return
+	}
+	decisions.WithLabelValues(transactionType, "accepted", "").Inc()
+	if transactionType == config.TypeLoad {
+		// The amount was validated by the accepted load.
+		amount, _ := transaction.GetParsedAmount()
+		loadedAmount.WithLabelValues(amount.Currency).Add(amount.Major())
+	}
+}
+
+// ObserveParseError records an input line or payload rejected with the reason.
+func ObserveParseError(reason models.Reason) {
+	parseErrors.WithLabelValues(string(reason)).Inc()
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+	"velocity-limits/config"
+)
+
+// LimitSnapshot represents the usage of every limit rule of an account in the rule
+// window of a transaction, keyed by rule name.
+type LimitSnapshot map[string]Limit
+
+// AuditRecord struct represents why a decision about a transaction was made: the
+// transaction as it was received, the limit usage before and after it, the decision
+// and the version of the config the limit rules came from. Invalid and duplicate
+// transactions are recorded without limit snapshots.
+type AuditRecord struct {
+	RecordedAt    time.Time     `json:"recorded_at"`
+	Transaction   Transaction   `json:"transaction"`
+	Accepted      bool          `json:"accepted"`
+	Reason        Reason        `json:"reason,omitempty"`
+	Before        LimitSnapshot `json:"before,omitempty"`
+	After         LimitSnapshot `json:"after,omitempty"`
+	ConfigVersion string        `json:"config_version,omitempty"`
+}
+
+// Returns a new audit record of the decision about the transaction, recorded now.
+func NewAuditRecord(txn *Transaction, decision Decision, before, after LimitSnapshot, configVersion string) AuditRecord {
+	return AuditRecord{
+		RecordedAt:    time.Now().UTC(),
+		Transaction:   *txn,
+		Accepted:      decision.Accepted,
+		Reason:        decision.Reason,
+		Before:        before,
+		After:         after,
+		ConfigVersion: configVersion,
+	}
+}
+
+// Returns the usage of every rule in its window of the given time.
+func (c *CustomerAccount) Snapshot(transactionTime time.Time, rules []config.LimitRule) LimitSnapshot {
+	snapshot := make(LimitSnapshot, len(rules))
+	for _, rule := range rules {
+		snapshot[rule.Name] = c.usage(rule, transactionTime)
+	}
+	return snapshot
+}
@@ -0,0 +1,33 @@
+package models
+
+import "velocity-limits/pkg/money"
+
+// Balances represents the balances of an account keyed by ISO 4217 currency code.
+type Balances map[string]money.Money
+
+// Get returns the balance in the currency, which is zero when the account never had any.
+func (b Balances) Get(currency string) money.Money {
+	if balance, ok := b[currency]; ok {
+		return balance
+	}
+	return money.New(0, currency)
+}
+
+// Add adds the amount to the balance of its currency, negative amounts are subtracted.
+func (b Balances) Add(amount money.Money) {
+	b[amount.Currency] = b.Get(amount.Currency).Add(amount)
+}
+
+// Sub subtracts the amount from the balance of its currency.
+func (b Balances) Sub(amount money.Money) {
+	b[amount.Currency] = b.Get(amount.Currency).Sub(amount)
+}
+
+// Clone returns a copy of the balances.
+func (b Balances) Clone() Balances {
+	clone := make(Balances, len(b))
+	for currency, balance := range b {
+		clone[currency] = balance
+	}
+	return clone
+}
@@ -2,103 +2,536 @@
 package models
 
 import (
+	"fmt"
 	"time"
-	"velocity-limits/pkg/util"
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
 )
 
-// CustomerAccount struct stores customer balance and current velocity limits.
+// CustomerAccount struct stores customer balances per currency and current velocity limits.
+// PastLimits keeps the usage of earlier windows and History the loads of rolling windows.
+// Calendar is the time zone and week start the calendar windows are tracked in.
+// The profile set at runtime takes precedence over the config.
 type CustomerAccount struct {
-	CustomerID  string
-	Balance     float64
-	DailyLimit  *DailyLimit
-	WeeklyLimit *WeeklyLimit
-}
-
-// DailyLimit struct represents daily load limits and max loads.
-type DailyLimit struct {
-	Date         time.Time
-	MaxLoadLimit float64
-	MaxLoad      int
-}
-
-// WeeklyLimit struct represents weekly load limits.
-type WeeklyLimit struct {
-	Date         time.Time
-	MaxLoadLimit float64
+	CustomerID          string                       `json:"customer_id"`
+	Balances            Balances                     `json:"balances"`
+	Limits              map[string]*Limit            `json:"limits"`
+	PastLimits          map[string]map[string]*Limit `json:"past_limits,omitempty"`
+	History             []LoadEntry                  `json:"history,omitempty"`
+	LastTransactionTime time.Time                    `json:"last_transaction_time"`
+	Calendar            string                       `json:"calendar,omitempty"`
+	config.Profile
 }
 
 // Returns a new customer account struct.
 func NewCustomerAccount(customerID string) *CustomerAccount {
 	return &CustomerAccount{
 		CustomerID: customerID,
+		Balances:   Balances{},
+		Limits:     make(map[string]*Limit),
+	}
+}
+
+// Returns a deep copy of the customer account which can be changed without
+// affecting the original account.
+func (c *CustomerAccount) Clone() *CustomerAccount {
+	clone := *c
+	clone.Balances = c.Balances.Clone()
+	clone.Limits = make(map[string]*Limit, len(c.Limits))
+	for name, limit := range c.Limits {
+		copied := *limit
+		clone.Limits[name] = &copied
+	}
+	if c.PastLimits != nil {
+		clone.PastLimits = make(map[string]map[string]*Limit, len(c.PastLimits))
+		for name, periods := range c.PastLimits {
+			clone.PastLimits[name] = make(map[string]*Limit, len(periods))
+			for period, limit := range periods {
+				copied := *limit
+				clone.PastLimits[name][period] = &copied
+			}
+		}
+	}
+	clone.History = append([]LoadEntry(nil), c.History...)
+	clone.LimitOverrides = append([]config.LimitOverride(nil), c.LimitOverrides...)
+	return &clone
+}
+
+// Moves limits of windows which ended before the transaction time to the past limits.
+// Usage late loads can't fall into anymore is dropped and missing limits are created.
+func (c *CustomerAccount) ResetLimits(transactionTime time.Time, rules []config.LimitRule, lateTolerance time.Duration) {
+	if c.Limits == nil {
+		c.Limits = make(map[string]*Limit)
+	}
+	latest := c.LastTransactionTime
+	if transactionTime.After(latest) {
+		latest = transactionTime
+	}
+	// Loads before the oldest accepted time are declined as late, so no usage before it is needed.
+	oldestAccepted := c.LastTransactionTime.Add(-lateTolerance)
+
+	var longestRollingWindow time.Duration
+	for _, rule := range rules {
+		if rule.IsRolling() {
+			if window := rollingWindow(rule); window > longestRollingWindow {
+				longestRollingWindow = window
+			}
+			continue
+		}
+
+		c.limitFor(rule, latest)
+		oldestStart := windowStart(rule, oldestAccepted)
+		for period, limit := range c.PastLimits[rule.Name] {
+			if limit.Start.Before(oldestStart) {
+				delete(c.PastLimits[rule.Name], period)
+			}
+		}
+		if len(c.PastLimits[rule.Name]) == 0 {
+			delete(c.PastLimits, rule.Name)
+		}
+	}
+
+	// History is only kept for rolling windows, evict entries older than the longest one.
+	evictBefore := oldestAccepted.Add(-longestRollingWindow)
+	kept := c.History[:0]
+	for _, entry := range c.History {
+		if longestRollingWindow > 0 && entry.Time.After(evictBefore) {
+			kept = append(kept, entry)
+		}
+	}
+	c.History = kept
+}
+
+// Moves the usage of the calendar windows tracked with the old rules into the windows of the
+// new rules with the same name when the time zone or the week start changed, so that a new
+// calendar doesn't start with empty windows. The usage of an old window is added to every new
+// window it overlaps, which may count it twice but never forgets it.
+func (c *CustomerAccount) ChangeCalendar(oldRules, newRules []config.LimitRule) {
+	for _, rule := range newRules {
+		old, ok := findRule(oldRules, rule.Name)
+		if !ok || rule.IsRolling() || old.IsRolling() || old.Window != rule.Window || sameCalendar(old, rule) {
+			continue
+		}
+
+		var windows []*Limit
+		if limit, ok := c.Limits[rule.Name]; ok {
+			windows = append(windows, limit)
+		}
+		for _, limit := range c.PastLimits[rule.Name] {
+			windows = append(windows, limit)
+		}
+		delete(c.Limits, rule.Name)
+		delete(c.PastLimits, rule.Name)
+		for _, window := range windows {
+			end := windowEnd(old, window.Start)
+			for start := windowStart(rule, window.Start); start.Before(end); start = windowEnd(rule, start) {
+				limit := c.limitFor(rule, start)
+				limit.Amount = limit.Amount.Add(window.Amount)
+				limit.Count += window.Count
+			}
+		}
+	}
+}
+
+// Moves the usage into the calendar of the rules when it was tracked in another one.
+// Returns an error without changing the account when the recorded calendar can't be loaded.
+func (c *CustomerAccount) UseCalendar(rules []config.LimitRule) error {
+	for _, rule := range rules {
+		if rule.IsRolling() {
+			continue
+		}
+		calendar := calendarOf(rule).String()
+		if c.Calendar != "" && c.Calendar != calendar {
+			old, err := config.ParseCalendar(c.Calendar)
+			if err != nil {
+				return fmt.Errorf("changing the calendar of customer %s: %w", c.CustomerID, err)
+			}
+			oldRules := make([]config.LimitRule, len(rules))
+			for i, rule := range rules {
+				rule.Calendar = &old
+				oldRules[i] = rule
+			}
+			c.ChangeCalendar(oldRules, rules)
+		}
+		c.Calendar = calendar
+		return nil
+	}
+	return nil
+}
+
+// Converts the usage of the calendar windows and the load history into the base currency of
+// the rules, which changes with the BASE_CURRENCY config, so that stored usage is never
+// combined with amounts in another currency. Returns an error without changing the account
+// when there's no exchange rate for a stored amount.
+func (c *CustomerAccount) ConvertUsage(rules []config.LimitRule) error {
+	converted := make(map[*money.Money]money.Money)
+	convert := func(amount *money.Money, exchange config.Exchange) error {
+		if amount.Currency == exchange.Base {
+			return nil
+		}
+		value, err := exchange.Convert(*amount)
+		if err != nil {
+			return fmt.Errorf("converting the usage of customer %s: %w", c.CustomerID, err)
+		}
+		converted[amount] = value
+		return nil
+	}
+
+	for _, rule := range rules {
+		if rule.IsRolling() {
+			continue
+		}
+		if limit, ok := c.Limits[rule.Name]; ok {
+			if err := convert(&limit.Amount, exchangeOf(rule)); err != nil {
+				return err
+			}
+		}
+		for _, limit := range c.PastLimits[rule.Name] {
+			if err := convert(&limit.Amount, exchangeOf(rule)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(rules) > 0 {
+		for i := range c.History {
+			if err := convert(&c.History[i].Amount, exchangeOf(rules[0])); err != nil {
+				return err
+			}
+		}
+	}
+
+	for amount, value := range converted {
+		*amount = value
+	}
+	return nil
+}
+
+// Returns the velocity limits currently left for the customer at the given time.
+func (c *CustomerAccount) Headroom(transactionTime time.Time, rules []config.LimitRule) Headroom {
+	headroom := make(Headroom, 0, len(rules))
+	for _, rule := range rules {
+		headroom = append(headroom, NewLimitHeadroom(rule, c.usage(rule, transactionTime)))
+	}
+	return headroom
+}
+
+// Tries to load fund if it's within all velocity limit rules of loads.
+// The first exceeded rule declines the load without changing any limit.
+// Returns the decision with the decline reason and the headroom left after the attempt.
+func (c *CustomerAccount) LoadFunds(txn *Transaction, rules []config.LimitRule, lateTolerance time.Duration) Decision {
+	return c.apply(txn, config.TypeLoad, rules, lateTolerance)
+}
+
+// Evaluates a load like LoadFunds on a copy of the account after resetting its limits, so
+// neither the account nor its limits change. Returns the pre-check with the decision, the
+// largest amount in the base currency of the rules and the number of loads which the load
+// rules allow at the transaction time. Both are zero for a load older than the late tolerance.
+func (c *CustomerAccount) PreCheckLoad(txn *Transaction, rules []config.LimitRule, lateTolerance time.Duration) *PreCheck {
+	account := c.Clone()
+	account.ResetLimits(txn.Time, rules, lateTolerance)
+	maxAmount, remainingLoads := account.available(rulesFor(rules, config.TypeLoad), txn.Time)
+	decision := account.LoadFunds(txn, rules, lateTolerance)
+	if decision.Reason == ReasonLateTransaction {
+		none := 0
+		remainingLoads = &none
+		if maxAmount != nil {
+			zero := money.New(0, maxAmount.Currency)
+			maxAmount = &zero
+		}
+	}
+	return NewPreCheck(txn, decision, maxAmount, remainingLoads)
+}
+
+// Tries to withdraw or transfer out funds if they're within the balance of their currency and all velocity
+// limit rules of the transaction type. Otherwise it's evaluated like a load.
+// Returns the decision with the decline reason and the headroom left after the attempt.
+func (c *CustomerAccount) WithdrawFunds(txn *Transaction, rules []config.LimitRule, lateTolerance time.Duration) Decision {
+	return c.apply(txn, txn.NormalizedType(), rules, lateTolerance)
+}
+
+// Adds funds transferred from another account, which aren't limited by any rule.
+func (c *CustomerAccount) ReceiveFunds(amount money.Money) {
+	c.Balances.Add(amount)
+}
+
+// Reverses the load referenced by the transaction, which must be in the ledger and not reversed yet.
+// The windows of the load get back the base amount it was charged with and its count.
+// Returns the decision with the decline reason and the load headroom left at the reversal time.
+func (c *CustomerAccount) ReverseLoad(txn *Transaction, ledger []LedgerEntry, rules []config.LimitRule) Decision {
+	rules = rulesFor(rules, config.TypeLoad)
+	original, reversed := FindLoad(ledger, txn.OriginalID)
+	switch {
+	case original == nil:
+		return c.decline(ReasonUnknownOriginal, txn.Time, rules)
+	case reversed:
+		return c.decline(ReasonAlreadyReversed, txn.Time, rules)
+	}
+	if txn.Amount != "" {
+		if amount, err := txn.GetParsedAmount(); err != nil || amount != original.Amount {
+			return c.decline(ReasonInvalidAmount, txn.Time, rules)
+		}
+	}
+	if original.Amount.Cmp(c.Balances.Get(original.Amount.Currency)) > 0 {
+		return c.decline(ReasonInsufficientFunds, txn.Time, rules)
+	}
+	baseAmount, err := chargedAmount(rules, *original)
+	if err != nil {
+		return c.decline(ReasonNoExchangeRate, txn.Time, rules)
+	}
+
+	c.Balances.Sub(original.Amount)
+	for _, rule := range rules {
+		// Windows which aren't tracked anymore can't be used by later loads either.
+		if rule.IsRolling() {
+			continue
+		}
+		if limit := c.findLimit(rule, windowStart(rule, original.Time)); limit != nil {
+			limit.Release(baseAmount)
+		}
+	}
+	// Rolling windows are evaluated over the load history.
+	for i, entry := range c.History {
+		if entry.Type == "" && entry.Time.Equal(original.Time) && entry.Amount == baseAmount {
+			c.History = append(c.History[:i], c.History[i+1:]...)
+			break
+		}
+	}
+	c.accept(txn.Time)
+	return Decision{Accepted: true, Headroom: c.Headroom(txn.Time, rules)}
+}
+
+// apply evaluates the transaction against the rules of the transaction type and changes
+// the balance and limits if it's accepted. Loads are credited, other types debited.
+func (c *CustomerAccount) apply(txn *Transaction, transactionType string, rules []config.LimitRule, lateTolerance time.Duration) Decision {
+	rules = rulesFor(rules, transactionType)
+	amount, err := txn.GetParsedAmount()
+	if err != nil || !amount.IsPositive() {
+		return c.decline(ReasonInvalidAmount, txn.Time, rules)
+	}
+	if c.LastTransactionTime.Sub(txn.Time) > lateTolerance {
+		return c.decline(ReasonLateTransaction, txn.Time, rules)
+	}
+	debit := transactionType != config.TypeLoad
+	if debit && amount.Cmp(c.Balances.Get(amount.Currency)) > 0 {
+		return c.decline(ReasonInsufficientFunds, txn.Time, rules)
+	}
+	baseAmount, err := toBase(rules, amount)
+	if err != nil {
+		return c.decline(ReasonNoExchangeRate, txn.Time, rules)
+	}
+
+	for _, rule := range rules {
+		if reason := c.validate(rule, txn.Time, baseAmount); reason != ReasonNone {
+			return c.decline(reason, txn.Time, rules)
+		}
+	}
+
+	if debit {
+		c.Balances.Sub(amount)
+	} else {
+		c.Balances.Add(amount)
+	}
+	for _, rule := range rules {
+		if !rule.IsRolling() {
+			c.limitFor(rule, txn.Time).UpdateLimits(baseAmount)
+		}
+	}
+	if hasRollingRule(rules) {
+		entry := LoadEntry{Time: txn.Time, Amount: baseAmount}
+		if debit {
+			entry.Type = transactionType
+		}
+		c.History = append(c.History, entry)
+	}
+	c.accept(txn.Time)
+	return Decision{Accepted: true, Headroom: c.Headroom(txn.Time, rules), BaseAmount: baseAmount}
+}
+
+// accept moves the latest accepted transaction time forward to the given time.
+func (c *CustomerAccount) accept(transactionTime time.Time) {
+	if transactionTime.After(c.LastTransactionTime) {
+		c.LastTransactionTime = transactionTime
+	}
+}
+
+// validate returns the reason when loading the amount at the given time exceeds the rule.
+func (c *CustomerAccount) validate(rule config.LimitRule, transactionTime time.Time, amount money.Money) Reason {
+	return c.peakUsage(rule, transactionTime).Validate(rule, amount)
+}
+
+// available returns the largest amount and the number of transactions which the rules allow
+// at the given time, a nil one when no rule limits it. No amount is available when no more
+// transactions are allowed.
+func (c *CustomerAccount) available(rules []config.LimitRule, transactionTime time.Time) (*money.Money, *int) {
+	var maxAmount *money.Money
+	var remaining *int
+	for _, rule := range rules {
+		usage := c.peakUsage(rule, transactionTime)
+		switch rule.Metric {
+		case config.MetricAmount:
+			left := rule.MaxAmount.Sub(usage.Amount)
+			if left.IsNegative() {
+				left = money.New(0, left.Currency)
+			}
+			if maxAmount == nil || left.Cmp(*maxAmount) < 0 {
+				maxAmount = &left
+			}
+		case config.MetricCount:
+			left := rule.MaxCount - usage.Count
+			if left < 0 {
+				left = 0
+			}
+			if remaining == nil || left < *remaining {
+				remaining = &left
+			}
+		}
+	}
+	if maxAmount != nil && remaining != nil && *remaining == 0 {
+		none := money.New(0, maxAmount.Currency)
+		maxAmount = &none
 	}
+	return maxAmount, remaining
 }
 
-// Returns a new daily limit struct.
-func NewDailyLimit(d time.Time, maxLoadLimit float64, maxLoad int) *DailyLimit {
-	return &DailyLimit{
-		Date:         util.GetBeginningOfTheDay(d),
-		MaxLoadLimit: maxLoadLimit,
-		MaxLoad:      maxLoad,
+// peakUsage returns the highest amount and count of the rule a transaction at the given time
+// is evaluated against. A late transaction also falls into the rolling windows of the later
+// transactions, so their usage counts too.
+func (c *CustomerAccount) peakUsage(rule config.LimitRule, transactionTime time.Time) Limit {
+	peak := c.usage(rule, transactionTime)
+	if !rule.IsRolling() {
+		return peak
+	}
+	windowEnd := transactionTime.Add(rollingWindow(rule))
+	for _, entry := range c.History {
+		if rule.AppliesTo(entry.Type) && entry.Time.After(transactionTime) && entry.Time.Before(windowEnd) {
+			usage := c.usage(rule, entry.Time)
+			if usage.Amount.Cmp(peak.Amount) > 0 {
+				peak.Amount = usage.Amount
+			}
+			if usage.Count > peak.Count {
+				peak.Count = usage.Count
+			}
+		}
 	}
+	return peak
 }
 
-// Returns a new weekly limit struct.
-func NewWeeklyLimit(d time.Time, maxLoadLimit float64) *WeeklyLimit {
-	return &WeeklyLimit{
-		Date:         util.GetBeginningOfTheWeek(d),
-		MaxLoadLimit: maxLoadLimit,
+// usage returns the amount and count of the rule transaction type in the rule window of the given time.
+func (c *CustomerAccount) usage(rule config.LimitRule, transactionTime time.Time) Limit {
+	if !rule.IsRolling() {
+		if limit := c.findLimit(rule, windowStart(rule, transactionTime)); limit != nil {
+			return *limit
+		}
+		return *NewLimit(rule, transactionTime)
 	}
+
+	usage := Limit{Start: transactionTime.Add(-rollingWindow(rule)), Amount: money.New(0, exchangeOf(rule).Base)}
+	for _, entry := range c.History {
+		if rule.AppliesTo(entry.Type) && entry.Time.After(usage.Start) && !entry.Time.After(transactionTime) {
+			usage.UpdateLimits(entry.Amount)
+		}
+	}
+	return usage
 }
 
-// Validates daily velocity limits are not reached
-func (dl *DailyLimit) Validate(amount float64) bool {
-	return dl.MaxLoadLimit-amount >= 0 && dl.MaxLoad-1 >= 0
+// findLimit returns the limit of the rule window starting at the given time or nil.
+func (c *CustomerAccount) findLimit(rule config.LimitRule, start time.Time) *Limit {
+	if limit, ok := c.Limits[rule.Name]; ok && limit.Start.Equal(start) {
+		return limit
+	}
+	return c.PastLimits[rule.Name][periodKey(start)]
 }
 
-// Updates daily limit struct.
-func (dl *DailyLimit) UpdateLimits(amount float64) {
-	dl.MaxLoadLimit -= amount
-	dl.MaxLoad--
+// limitFor returns the limit of the rule window of the given time, creating it if needed.
+// A later window replaces the current limit, which is kept in the past limits if it was used.
+func (c *CustomerAccount) limitFor(rule config.LimitRule, transactionTime time.Time) *Limit {
+	start := windowStart(rule, transactionTime)
+	if limit := c.findLimit(rule, start); limit != nil {
+		return limit
+	}
+	if c.Limits == nil {
+		c.Limits = make(map[string]*Limit)
+	}
+
+	limit := NewLimit(rule, transactionTime)
+	current, ok := c.Limits[rule.Name]
+	if ok && current.Start.After(start) {
+		c.addPastLimit(rule.Name, limit)
+		return limit
+	}
+	// Unused windows are left out, a missing window has no usage anyway.
+	if ok && current.Count > 0 {
+		c.addPastLimit(rule.Name, current)
+	}
+	c.Limits[rule.Name] = limit
+	return limit
+}
+
+// addPastLimit keeps the limit of an earlier window of the rule.
+func (c *CustomerAccount) addPastLimit(name string, limit *Limit) {
+	if c.PastLimits == nil {
+		c.PastLimits = make(map[string]map[string]*Limit)
+	}
+	if c.PastLimits[name] == nil {
+		c.PastLimits[name] = make(map[string]*Limit)
+	}
+	c.PastLimits[name][periodKey(limit.Start)] = limit
 }
 
-// Validates daily velocity limits are not reached
-func (wl *WeeklyLimit) Validate(amount float64) bool {
-	return wl.MaxLoadLimit-amount >= 0
+// periodKey returns the key of a window in the past limits.
+func periodKey(start time.Time) string {
+	return start.UTC().Format(time.RFC3339)
 }
 
-// Updates weekly limit struct.
-func (wl *WeeklyLimit) UpdateLimits(amount float64) {
-	wl.MaxLoadLimit -= amount
+// decline returns a declined decision with the given reason.
+func (c *CustomerAccount) decline(reason Reason, transactionTime time.Time, rules []config.LimitRule) Decision {
+	return Decision{Accepted: false, Reason: reason, Headroom: c.Headroom(transactionTime, rules)}
 }
 
-// Reset daily limits and/or weekly limits depending on a transaction time.
-func (c *CustomerAccount) ResetLimits(transactionTime time.Time, maxLoadLimitPerDay float64, maxLoad int, maxLoadLimitPerWeek float64) {
-	transactionDay := util.GetBeginningOfTheDay(transactionTime)
-	if transactionDay.After(c.DailyLimit.Date) {
-		c.DailyLimit.Date = transactionDay
-		c.DailyLimit.MaxLoadLimit = maxLoadLimitPerDay
-		c.DailyLimit.MaxLoad = maxLoad
+// findRule returns the rule with the given name.
+func findRule(rules []config.LimitRule, name string) (config.LimitRule, bool) {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return rule, true
+		}
 	}
-	transactionWeek := util.GetBeginningOfTheWeek(transactionTime)
-	if transactionWeek.After(c.WeeklyLimit.Date) {
-		c.WeeklyLimit.Date = transactionWeek
-		c.WeeklyLimit.MaxLoadLimit = maxLoadLimitPerWeek
+	return config.LimitRule{}, false
+}
+
+// rulesFor returns the rules which apply to transactions of the given type.
+func rulesFor(rules []config.LimitRule, transactionType string) []config.LimitRule {
+	applying := make([]config.LimitRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.AppliesTo(transactionType) {
+			applying = append(applying, rule)
+		}
 	}
+	return applying
 }
 
-// Tries to load fund if it's within daily and weekly velocity limits.
-func (c *CustomerAccount) LoadFunds(txn *Transaction) bool {
-	if !c.DailyLimit.Validate(txn.GetParsedAmount()) {
-		return false
+// toBase converts the amount into the base currency of the rules, which share one exchange.
+func toBase(rules []config.LimitRule, amount money.Money) (money.Money, error) {
+	if len(rules) == 0 {
+		return amount, nil
 	}
+	return exchangeOf(rules[0]).Convert(amount)
+}
 
-	if !c.WeeklyLimit.Validate(txn.GetParsedAmount()) {
-		return false
+// chargedAmount returns the base amount the limits were charged with for the load entry,
+// which is converted again for entries without one or in another base currency.
+func chargedAmount(rules []config.LimitRule, load LedgerEntry) (money.Money, error) {
+	if load.BaseAmount != nil && (len(rules) == 0 || load.BaseAmount.Currency == exchangeOf(rules[0]).Base) {
+		return *load.BaseAmount, nil
 	}
+	return toBase(rules, load.Amount)
+}
 
-	c.Balance += txn.GetParsedAmount()
-	c.DailyLimit.UpdateLimits(txn.GetParsedAmount())
-	c.WeeklyLimit.UpdateLimits(txn.GetParsedAmount())
-	return true
+// hasRollingRule reports whether any of the rules uses a rolling window.
+func hasRollingRule(rules []config.LimitRule) bool {
+	for _, rule := range rules {
+		if rule.IsRolling() {
+			return true
+		}
+	}
+	return false
 }
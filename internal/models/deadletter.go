@@ -0,0 +1,10 @@
+package models
+
+// DeadLetter struct represents an input line which couldn't be processed, written to
+// the dead-letter file with its line number so that it can be fixed and replayed.
+type DeadLetter struct {
+	Line   int    `json:"line"`
+	Reason Reason `json:"reason"`
+	Error  string `json:"error,omitempty"`
+	Record string `json:"record"`
+}
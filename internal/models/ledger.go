@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+)
+
+// LedgerEntry struct represents a change of a customer balance by an accepted transaction.
+// Credits are positive and debits negative, so the balance is the sum of the entries.
+// BaseAmount is what a load was charged with in the base currency, a reversal gives it back.
+type LedgerEntry struct {
+	CustomerID     string       `json:"customer_id"`
+	TransactionID  string       `json:"transaction_id"`
+	Type           string       `json:"type"`
+	Amount         money.Money  `json:"amount"`
+	Time           time.Time    `json:"time"`
+	CounterpartyID string       `json:"counterparty_id,omitempty"`
+	OriginalID     string       `json:"original_id,omitempty"`
+	BaseAmount     *money.Money `json:"base_amount,omitempty"`
+}
+
+// Returns a new ledger entry of the transaction for the customer with the signed amount.
+func NewLedgerEntry(customerID string, txn *Transaction, amount money.Money, counterpartyID string) LedgerEntry {
+	return LedgerEntry{
+		CustomerID:     customerID,
+		TransactionID:  txn.ID,
+		Type:           txn.NormalizedType(),
+		Amount:         amount,
+		Time:           txn.Time,
+		CounterpartyID: counterpartyID,
+		OriginalID:     txn.OriginalID,
+	}
+}
+
+// FindLoad returns the ledger entry of the load with the given transaction ID or nil,
+// and whether the load was reversed already.
+func FindLoad(entries []LedgerEntry, transactionID string) (load *LedgerEntry, reversed bool) {
+	for i, entry := range entries {
+		switch {
+		case entry.Type == config.TypeLoad && entry.TransactionID == transactionID:
+			load = &entries[i]
+		case entry.Type == config.TypeReversal && entry.OriginalID == transactionID:
+			reversed = true
+		}
+	}
+	return load, reversed
+}
+
+// LedgerBalance returns the balances per currency derived from the ledger entries of an account.
+func LedgerBalance(entries []LedgerEntry) Balances {
+	balances := Balances{}
+	for _, entry := range entries {
+		balances.Add(entry.Amount)
+	}
+	return balances
+}
@@ -0,0 +1,148 @@
+// Package models represents model structs and its functions.
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+	"velocity-limits/pkg/util"
+)
+
+// Limit struct represents the amount and number of loads used in the current window of a rule.
+// The amount is in the base currency of the rule.
+type Limit struct {
+	Start  time.Time   `json:"start"`
+	Amount money.Money `json:"amount"`
+	Count  int         `json:"count"`
+}
+
+// LoadEntry struct represents an accepted transaction kept for rolling window rules.
+// Type is empty for loads and the amount is in the base currency of the rules.
+type LoadEntry struct {
+	Time   time.Time   `json:"time"`
+	Type   string      `json:"type,omitempty"`
+	Amount money.Money `json:"amount"`
+}
+
+// Returns a new unused limit struct for the rule window of the given time.
+func NewLimit(rule config.LimitRule, d time.Time) *Limit {
+	return &Limit{
+		Start:  windowStart(rule, d),
+		Amount: money.New(0, exchangeOf(rule).Base),
+	}
+}
+
+// Validates the rule threshold isn't reached after loading the amount.
+// Returns the reason of the exceeded rule or ReasonNone.
+func (l Limit) Validate(rule config.LimitRule, amount money.Money) Reason {
+	switch rule.Metric {
+	case config.MetricAmount:
+		if l.Amount.Add(amount).Cmp(rule.MaxAmount) > 0 {
+			return ReasonForRule(rule)
+		}
+	case config.MetricCount:
+		if l.Count+1 > rule.MaxCount {
+			return ReasonForRule(rule)
+		}
+	}
+	return ReasonNone
+}
+
+// Updates limit struct with an accepted load.
+func (l *Limit) UpdateLimits(amount money.Money) {
+	l.Amount = l.Amount.Add(amount)
+	l.Count++
+}
+
+// Gives back the amount and count of a reversed load.
+func (l *Limit) Release(amount money.Money) {
+	l.Amount = l.Amount.Sub(amount)
+	if l.Amount.IsNegative() {
+		l.Amount = money.New(0, l.Amount.Currency)
+	}
+	if l.Count > 0 {
+		l.Count--
+	}
+}
+
+// windowStart returns the beginning of the calendar window of the rule for the given time
+// in the time zone of the rule.
+func windowStart(rule config.LimitRule, d time.Time) time.Time {
+	calendar := calendarOf(rule)
+	switch rule.Window {
+	case config.WindowHour:
+		return util.GetBeginningOfTheHourIn(d, calendar.Location)
+	case config.WindowDay:
+		return util.GetBeginningOfTheDayIn(d, calendar.Location)
+	case config.WindowWeek:
+		return util.GetBeginningOfTheWeekIn(d, calendar.Location, calendar.WeekStart)
+	case config.WindowMonth:
+		return util.GetBeginningOfTheMonthIn(d, calendar.Location)
+	}
+	return d.Add(-rollingWindow(rule))
+}
+
+// windowEnd returns the beginning of the calendar window of the rule after the one starting
+// at the given time, in the time zone of the rule.
+func windowEnd(rule config.LimitRule, start time.Time) time.Time {
+	local := start.In(calendarOf(rule).Location)
+	switch rule.Window {
+	case config.WindowHour:
+		return start.Add(time.Hour)
+	case config.WindowDay:
+		return windowStart(rule, local.AddDate(0, 0, 1))
+	case config.WindowWeek:
+		return windowStart(rule, local.AddDate(0, 0, 7))
+	case config.WindowMonth:
+		return windowStart(rule, local.AddDate(0, 1, 0))
+	}
+	return start.Add(rollingWindow(rule))
+}
+
+// calendarOf returns the calendar of the rule windows.
+func calendarOf(rule config.LimitRule) config.Calendar {
+	if rule.Calendar != nil {
+		return *rule.Calendar
+	}
+	return config.DefaultCalendar
+}
+
+// sameCalendar reports whether the calendar windows of two rules start at the same times.
+func sameCalendar(a, b config.LimitRule) bool {
+	calendarA, calendarB := calendarOf(a), calendarOf(b)
+	return a.Window == b.Window && calendarA.WeekStart == calendarB.WeekStart &&
+		calendarA.Location.String() == calendarB.Location.String()
+}
+
+// exchangeOf returns the exchange which converts amounts into the base currency of the rule.
+func exchangeOf(rule config.LimitRule) config.Exchange {
+	if rule.Exchange != nil {
+		return *rule.Exchange
+	}
+	return config.DefaultExchange
+}
+
+// rollingWindow returns the length of a rolling window rule.
+func rollingWindow(rule config.LimitRule) time.Duration {
+	return time.Duration(rule.Hours) * time.Hour
+}
+
+// windowNames maps rule windows to the prefix of their reason codes.
+var windowNames = map[string]string{
+	config.WindowHour:    "HOURLY",
+	config.WindowDay:     "DAILY",
+	config.WindowWeek:    "WEEKLY",
+	config.WindowMonth:   "MONTHLY",
+	config.WindowRolling: "ROLLING",
+}
+
+// ReasonForRule returns the decline reason of an exceeded rule, e.g. DAILY_AMOUNT_EXCEEDED
+// for loads or DAILY_WITHDRAWAL_AMOUNT_EXCEEDED for withdrawals.
+func ReasonForRule(rule config.LimitRule) Reason {
+	if rule.AppliesTo(config.TypeLoad) {
+		return Reason(fmt.Sprintf("%s_%s_EXCEEDED", windowNames[rule.Window], strings.ToUpper(rule.Metric)))
+	}
+	return Reason(fmt.Sprintf("%s_%s_%s_EXCEEDED", windowNames[rule.Window], strings.ToUpper(rule.Type), strings.ToUpper(rule.Metric)))
+}
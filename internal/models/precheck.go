@@ -0,0 +1,22 @@
+package models
+
+import "velocity-limits/pkg/money"
+
+// PreCheck struct represents a load evaluated without committing it: the response it
+// would get now, the largest amount the customer could load at its time in the base
+// currency of the limit rules and how many more loads the count rules allow. A nil
+// maximum means no rule limits it.
+type PreCheck struct {
+	Response
+	MaxLoadAmount  *money.Money `json:"max_load_amount,omitempty"`
+	RemainingLoads *int         `json:"remaining_loads,omitempty"`
+}
+
+// Returns a new PreCheck struct from the decision of the evaluated load and what's available.
+func NewPreCheck(txn *Transaction, decision Decision, maxAmount *money.Money, remainingLoads *int) *PreCheck {
+	return &PreCheck{
+		Response:       *NewResponseFromDecision(txn.ID, txn.CustomerID, decision),
+		MaxLoadAmount:  maxAmount,
+		RemainingLoads: remainingLoads,
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ProcessedTransaction struct represents a processed transaction kept for duplicate detection.
+// The fingerprint and response of its payload tell a retry from a conflicting payload.
+// ProcessedAt is when it was processed by the clock of the application.
+type ProcessedTransaction struct {
+	ID          string    `json:"id"`
+	CustomerID  string    `json:"customer_id"`
+	Time        time.Time `json:"time"`
+	ProcessedAt time.Time `json:"processed_at,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+// Returns a new ProcessedTransaction struct for the transaction and its response processed now.
+func NewProcessedTransaction(txn *Transaction, response *Response) ProcessedTransaction {
+	return ProcessedTransaction{
+		ID:          txn.ID,
+		CustomerID:  txn.CustomerID,
+		Time:        txn.Time,
+		ProcessedAt: time.Now().UTC(),
+		Fingerprint: txn.Fingerprint(),
+		Response:    response,
+	}
+}
+
+// Repeat returns the response to a transaction with the ID of the processed one: the
+// original response flagged as a replay when the payload is the same, or a decline with
+// the IDEMPOTENCY_CONFLICT reason when it differs. The reason tells which one it is for
+// the audit log. Returns a nil response when the original response isn't known.
+func (p *ProcessedTransaction) Repeat(txn *Transaction) (*Response, Reason) {
+	if p.Fingerprint != "" && p.Fingerprint != txn.Fingerprint() {
+		return NewResponseFromDecision(txn.ID, txn.CustomerID, Decision{Reason: ReasonIdempotencyConflict}), ReasonIdempotencyConflict
+	}
+	if p.Response == nil {
+		return nil, ReasonDuplicateTransaction
+	}
+	response := *p.Response
+	response.Replay = true
+	return &response, ReasonDuplicateTransaction
+}
+
+// Fingerprint returns the payload of a valid transaction which must be the same for a
+// retry: the type, the parsed amount, the time and the referenced customer or load.
+func (txn *Transaction) Fingerprint() string {
+	amount := ""
+	if parsed, err := txn.GetParsedAmount(); err == nil {
+		amount = parsed.String()
+	}
+	return strings.Join([]string{txn.NormalizedType(), amount, txn.Time.UTC().Format(time.RFC3339Nano), txn.ToCustomerID, txn.OriginalID}, "|")
+}
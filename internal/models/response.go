@@ -1,12 +1,96 @@
 // Package models represents model structs and its functions.
 package models
 
+import (
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+)
+
+// Reason represents a code explaining why a load was declined.
+type Reason string
+
+// Reason codes returned in the response when a load is declined. Limit rules decline
+// with <WINDOW>_<METRIC>_EXCEEDED codes, the most common ones are listed here.
+const (
+	ReasonNone                 Reason = ""
+	ReasonDailyAmountExceeded  Reason = "DAILY_AMOUNT_EXCEEDED"
+	ReasonWeeklyAmountExceeded Reason = "WEEKLY_AMOUNT_EXCEEDED"
+	ReasonDailyCountExceeded   Reason = "DAILY_COUNT_EXCEEDED"
+	ReasonInvalidAmount        Reason = "INVALID_AMOUNT"
+	ReasonLateTransaction      Reason = "LATE_TRANSACTION"
+	ReasonFutureTransaction    Reason = "FUTURE_TRANSACTION"
+	ReasonInsufficientFunds    Reason = "INSUFFICIENT_FUNDS"
+	ReasonUnknownOriginal      Reason = "UNKNOWN_ORIGINAL_LOAD"
+	ReasonAlreadyReversed      Reason = "ALREADY_REVERSED"
+	ReasonNoExchangeRate       Reason = "NO_EXCHANGE_RATE"
+)
+
+// Reason codes of malformed input records which are declined without being processed.
+const (
+	ReasonMalformedRecord     Reason = "MALFORMED_RECORD"
+	ReasonMissingID           Reason = "MISSING_ID"
+	ReasonMissingCustomerID   Reason = "MISSING_CUSTOMER_ID"
+	ReasonMissingTime         Reason = "MISSING_TIME"
+	ReasonUnknownCurrency     Reason = "UNKNOWN_CURRENCY"
+	ReasonUnknownType         Reason = "UNKNOWN_TYPE"
+	ReasonInvalidCounterparty Reason = "INVALID_COUNTERPARTY"
+	ReasonMissingOriginalID   Reason = "MISSING_ORIGINAL_ID"
+)
+
+// Reasons of repeated transaction IDs. Duplicates get the original response as a replay
+// and are recorded in the audit log with the duplicate reason, while another payload
+// with the ID of a processed transaction is declined as an idempotency conflict.
+const (
+	ReasonDuplicateTransaction Reason = "DUPLICATE_TRANSACTION"
+	ReasonIdempotencyConflict  Reason = "IDEMPOTENCY_CONFLICT"
+)
+
+// LimitHeadroom struct represents what's left of a limit rule after a load attempt.
+// Only the remaining value for the rule metric is set.
+type LimitHeadroom struct {
+	Limit           string       `json:"limit"`
+	RemainingAmount *money.Money `json:"remaining_amount,omitempty"`
+	RemainingCount  *int         `json:"remaining_count,omitempty"`
+}
+
+// Headroom represents remaining velocity limits of all rules after a load attempt.
+type Headroom []LimitHeadroom
+
+// Returns a new limit headroom struct from the rule threshold and its usage.
+func NewLimitHeadroom(rule config.LimitRule, usage Limit) LimitHeadroom {
+	headroom := LimitHeadroom{Limit: rule.Name}
+	switch rule.Metric {
+	case config.MetricAmount:
+		remaining := rule.MaxAmount.Sub(usage.Amount)
+		headroom.RemainingAmount = &remaining
+	case config.MetricCount:
+		remaining := rule.MaxCount - usage.Count
+		headroom.RemainingCount = &remaining
+	}
+	return headroom
+}
+
+// Decision struct represents the outcome of a load, withdrawal or transfer attempt with
+// its decline reason and the velocity limits of the transaction type left for the customer.
+// BaseAmount is the amount an accepted transaction charged to the limits in their base currency.
+type Decision struct {
+	Accepted   bool
+	Reason     Reason
+	Headroom   Headroom
+	BaseAmount money.Money
+}
+
 // Response struct stores load ID, customer ID and accepted flag.
 // Accepted flag represents transaction was load successfully or failed.
+// Reason and headroom are only written by the detailed output format.
+// Replay is set on the original response returned again for a duplicate transaction.
 type Response struct {
-	ID         string `json:"id"`
-	CustomerID string `json:"customer_id"`
-	Accepted   bool   `json:"accepted"`
+	ID         string   `json:"id"`
+	CustomerID string   `json:"customer_id"`
+	Accepted   bool     `json:"accepted"`
+	Reason     Reason   `json:"reason,omitempty"`
+	Headroom   Headroom `json:"headroom,omitempty"`
+	Replay     bool     `json:"replay,omitempty"`
 }
 
 // Returns a new Response struct.
@@ -17,3 +101,23 @@ func NewResponse(id string, custID string, accepted bool) *Response {
 		Accepted:   accepted,
 	}
 }
+
+// Returns a new Response struct from the decision of a load attempt.
+func NewResponseFromDecision(id string, custID string, decision Decision) *Response {
+	response := NewResponse(id, custID, decision.Accepted)
+	response.Reason = decision.Reason
+	response.Headroom = decision.Headroom
+	return response
+}
+
+// IsRepeated reports whether the response answers a repeated transaction ID instead of
+// deciding a transaction, as a replay or an idempotency conflict.
+func (r Response) IsRepeated() bool {
+	return r.Replay || r.Reason == ReasonIdempotencyConflict
+}
+
+// Legacy returns a copy of the response without reason and headroom,
+// which marshals exactly like the original output.txt format.
+func (r Response) Legacy() Response {
+	return *NewResponse(r.ID, r.CustomerID, r.Accepted)
+}
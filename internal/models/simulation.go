@@ -0,0 +1,84 @@
+package models
+
+import "sort"
+
+// CustomerImpact struct represents how many decisions about the transactions of a
+// customer changed in a simulation.
+type CustomerImpact struct {
+	CustomerID    string `json:"customer_id"`
+	NewlyDeclined int    `json:"newly_declined"`
+	NewlyAccepted int    `json:"newly_accepted"`
+}
+
+// SimulationReport struct represents the differences between baseline and simulated responses.
+// Responses are matched by ID and customer ID, the others are counted as unmatched.
+type SimulationReport struct {
+	Transactions      int              `json:"transactions"`
+	BaselineAccepted  int              `json:"baseline_accepted"`
+	SimulatedAccepted int              `json:"simulated_accepted"`
+	Unmatched         int              `json:"unmatched"`
+	NewlyDeclined     []Response       `json:"newly_declined"`
+	NewlyAccepted     []Response       `json:"newly_accepted"`
+	Customers         []CustomerImpact `json:"customers"`
+	DeclinedByReason  map[Reason]int   `json:"declined_by_reason"`
+}
+
+// Returns the report of the differences between the baseline and the simulated responses.
+// Responses to repeated transaction IDs aren't decisions, so they're left out.
+func CompareResponses(baseline, simulated []Response) *SimulationReport {
+	baselineAccepted := make(map[string]bool, len(baseline))
+	for _, response := range baseline {
+		if !response.IsRepeated() {
+			baselineAccepted[responseKey(response)] = response.Accepted
+		}
+	}
+
+	report := &SimulationReport{DeclinedByReason: make(map[Reason]int)}
+	impacts := make(map[string]*CustomerImpact)
+	impactOf := func(customerID string) *CustomerImpact {
+		if impacts[customerID] == nil {
+			impacts[customerID] = &CustomerImpact{CustomerID: customerID}
+		}
+		return impacts[customerID]
+	}
+	for _, response := range simulated {
+		if response.IsRepeated() {
+			continue
+		}
+		report.Transactions++
+		if response.Accepted {
+			report.SimulatedAccepted++
+		} else {
+			report.DeclinedByReason[response.Reason]++
+		}
+
+		accepted, ok := baselineAccepted[responseKey(response)]
+		switch {
+		case !ok:
+			report.Unmatched++
+			continue
+		case accepted && !response.Accepted:
+			report.NewlyDeclined = append(report.NewlyDeclined, response)
+			impactOf(response.CustomerID).NewlyDeclined++
+		case !accepted && response.Accepted:
+			report.NewlyAccepted = append(report.NewlyAccepted, response)
+			impactOf(response.CustomerID).NewlyAccepted++
+		}
+		if accepted {
+			report.BaselineAccepted++
+		}
+	}
+
+	for _, impact := range impacts {
+		report.Customers = append(report.Customers, *impact)
+	}
+	sort.Slice(report.Customers, func(i, j int) bool {
+		return report.Customers[i].CustomerID < report.Customers[j].CustomerID
+	})
+	return report
+}
+
+// responseKey returns the key responses are matched by.
+func responseKey(response Response) string {
+	return response.ID + "\x00" + response.CustomerID
+}
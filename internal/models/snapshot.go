@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot format. Bump it when a change of the
+// format can't be read by earlier versions and keep reading the earlier formats.
+const SnapshotVersion = 1
+
+// Snapshot struct represents the state of the engine at a point in time: the customer
+// accounts with their limit windows, their ledgers and the processed transactions kept for
+// duplicate detection. The audit log isn't part of it, it's a record of decisions rather
+// than state they depend on. ConfigVersion is the version of the config it was taken with.
+type Snapshot struct {
+	Version       int                    `json:"version"`
+	CreatedAt     time.Time              `json:"created_at"`
+	ConfigVersion string                 `json:"config_version,omitempty"`
+	Accounts      []*CustomerAccount     `json:"accounts"`
+	Ledger        []LedgerEntry          `json:"ledger"`
+	Transactions  []ProcessedTransaction `json:"transactions"`
+}
+
+// Returns a new empty snapshot of the current version taken now.
+func NewSnapshot(configVersion string) *Snapshot {
+	return &Snapshot{
+		Version:       SnapshotVersion,
+		CreatedAt:     time.Now().UTC(),
+		ConfigVersion: configVersion,
+		Accounts:      []*CustomerAccount{},
+		Ledger:        []LedgerEntry{},
+		Transactions:  []ProcessedTransaction{},
+	}
+}
+
+// CheckVersion returns an error when the snapshot has no version or a version newer than
+// the supported one.
+func (s *Snapshot) CheckVersion() error {
+	switch {
+	case s.Version < 1:
+		return errors.New("snapshot has no version")
+	case s.Version > SnapshotVersion:
+		return fmt.Errorf("snapshot version %d is newer than supported version %d", s.Version, SnapshotVersion)
+	}
+	return nil
+}
@@ -2,27 +2,84 @@
 package models
 
 import (
-	"log"
-	"strconv"
+	"errors"
 	"strings"
 	"time"
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
 )
 
 // Transaction struct stores load ID, customer ID, load amount and transaction time.
-// It represents the transaction payload from the input file.
+// It represents the transaction payload from the input file. Type is empty for loads,
+// withdrawals and transfers set it, and transfers move the amount to ToCustomerID.
+// Reversals undo the load with OriginalID, their amount is optional.
 type Transaction struct {
-	ID         string    `json:"id"`
-	CustomerID string    `json:"customer_id"`
-	Amount     string    `json:"load_amount"`
-	Time       time.Time `json:"time"`
+	ID           string    `json:"id"`
+	CustomerID   string    `json:"customer_id"`
+	Type         string    `json:"type,omitempty"`
+	ToCustomerID string    `json:"to_customer_id,omitempty"`
+	OriginalID   string    `json:"original_id,omitempty"`
+	Amount       string    `json:"load_amount"`
+	Time         time.Time `json:"time"`
 }
 
 // GetParsedAmount function parses amount from the transaction struct
-// into float64 type and removes $ sign.
-func (txn *Transaction) GetParsedAmount() float64 {
-	parsedAmount, err := strconv.ParseFloat(strings.Trim(txn.Amount, "$"), 64)
-	if err != nil {
-		log.Fatal("Error - GetParsedAmount function error: ", err)
+// into the fixed-point money type, e.g. "$1,234.56" into 123456 cents.
+func (txn *Transaction) GetParsedAmount() (money.Money, error) {
+	return money.Parse(txn.Amount)
+}
+
+// NormalizedType returns the transaction type with an empty type as a load.
+func (txn *Transaction) NormalizedType() string {
+	return config.NormalizeType(txn.Type)
+}
+
+// IsDebit reports whether the transaction takes funds out of the account.
+func (txn *Transaction) IsDebit() bool {
+	return txn.NormalizedType() != config.TypeLoad
+}
+
+// IsReversal reports whether the transaction reverses an earlier load.
+func (txn *Transaction) IsReversal() bool {
+	return txn.NormalizedType() == config.TypeReversal
+}
+
+// Validate checks the fields of a transaction read from the input.
+// Returns the reason of the first invalid field or ReasonNone.
+func (txn *Transaction) Validate() Reason {
+	switch {
+	case strings.TrimSpace(txn.ID) == "":
+		return ReasonMissingID
+	case strings.TrimSpace(txn.CustomerID) == "":
+		return ReasonMissingCustomerID
+	case txn.Time.IsZero():
+		return ReasonMissingTime
+	}
+
+	switch txn.NormalizedType() {
+	case config.TypeLoad, config.TypeWithdrawal:
+	case config.TypeTransfer:
+		if strings.TrimSpace(txn.ToCustomerID) == "" || txn.ToCustomerID == txn.CustomerID {
+			return ReasonInvalidCounterparty
+		}
+	case config.TypeReversal:
+		if strings.TrimSpace(txn.OriginalID) == "" {
+			return ReasonMissingOriginalID
+		}
+		// The amount of the original load is reversed when it's left out.
+		if txn.Amount == "" {
+			return ReasonNone
+		}
+	default:
+		return ReasonUnknownType
+	}
+
+	amount, err := txn.GetParsedAmount()
+	switch {
+	case errors.Is(err, money.ErrUnknownCurrency):
+		return ReasonUnknownCurrency
+	case err != nil || !amount.IsPositive():
+		return ReasonInvalidAmount
 	}
-	return parsedAmount
+	return ReasonNone
 }
@@ -0,0 +1,12 @@
+package models
+
+// Mismatch struct represents a response line which differs from the expected line, with
+// the input line of its transaction as context. A line missing on either side is empty.
+type Mismatch struct {
+	Line       int    `json:"line"`
+	ID         string `json:"id"`
+	CustomerID string `json:"customer_id"`
+	Input      string `json:"input,omitempty"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual"`
+}
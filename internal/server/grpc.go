@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	pb "velocity-limits/api/velocitylimits/v1"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService struct implements the VelocityLimits gRPC service on the server, so that
+// transactions share the storage with the HTTP API and are processed one at a time.
+type grpcService struct {
+	pb.UnimplementedVelocityLimitsServer
+	server *Server
+}
+
+// GRPCServer returns a gRPC server with the VelocityLimits service registered.
+func (s *Server) GRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	grpcServer := grpc.NewServer(options...)
+	pb.RegisterVelocityLimitsServer(grpcServer, &grpcService{server: s})
+	return grpcServer
+}
+
+// LoadFunds decides a single load like POST /loads. Other types and invalid loads return
+// InvalidArgument and other payloads with the ID of a processed transaction AlreadyExists.
+func (g *grpcService) LoadFunds(ctx context.Context, request *pb.Transaction) (*pb.Response, error) {
+	transaction := transactionFromProto(request)
+	if transaction.Type != "" && transaction.Type != config.TypeLoad {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transaction type %q, only loads are accepted", transaction.Type)
+	}
+	transaction.Type = config.TypeLoad
+	// Invalid transactions are processed too, so that they're recorded in the audit log.
+	response, err := g.server.process(transaction)
+	if err != nil {
+		log.Printf("Error - Processing transaction %+v: %v\n", transaction, err)
+		return nil, status.Error(codes.Internal, "unable to process transaction")
+	}
+	if reason := transaction.Validate(); reason != models.ReasonNone {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transaction: %s", reason)
+	}
+	// Retries get the original response, other payloads with the same ID a conflict.
+	if response == nil {
+		return nil, status.Error(codes.AlreadyExists, "duplicate load id for customer")
+	}
+	if response.Reason == models.ReasonIdempotencyConflict {
+		return nil, status.Error(codes.AlreadyExists, string(models.ReasonIdempotencyConflict))
+	}
+	return responseToProto(response), nil
+}
+
+// StreamLoadFunds decides the transactions of the stream in the order they're received and
+// sends one response for each of them. Invalid and repeated transactions are declined with
+// their reason, so only storage errors end the stream.
+func (g *grpcService) StreamLoadFunds(stream pb.VelocityLimits_StreamLoadFundsServer) error {
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		transaction := transactionFromProto(request)
+		response, err := g.server.process(transaction)
+		if err != nil {
+			log.Printf("Error - Processing transaction %+v: %v\n", transaction, err)
+			return status.Error(codes.Internal, "unable to process transaction")
+		}
+		if response == nil {
+			response = models.NewResponseFromDecision(transaction.ID, transaction.CustomerID, models.Decision{Reason: models.ReasonDuplicateTransaction})
+		}
+		if err = stream.Send(responseToProto(response)); err != nil {
+			return err
+		}
+	}
+}
+
+// transactionFromProto returns the transaction of a request, a missing time is the zero time.
+func transactionFromProto(request *pb.Transaction) *models.Transaction {
+	transaction := &models.Transaction{
+		ID:           request.GetId(),
+		CustomerID:   request.GetCustomerId(),
+		Type:         request.GetType(),
+		ToCustomerID: request.GetToCustomerId(),
+		OriginalID:   request.GetOriginalId(),
+		Amount:       request.GetLoadAmount(),
+	}
+	if request.GetTime() != nil {
+		transaction.Time = request.GetTime().AsTime()
+	}
+	return transaction
+}
+
+// responseToProto returns the protobuf message of a response.
+func responseToProto(response *models.Response) *pb.Response {
+	message := &pb.Response{
+		Id:         response.ID,
+		CustomerId: response.CustomerID,
+		Accepted:   response.Accepted,
+		Reason:     string(response.Reason),
+		Replay:     response.Replay,
+	}
+	for _, headroom := range response.Headroom {
+		limit := &pb.LimitHeadroom{Limit: headroom.Limit}
+		if headroom.RemainingAmount != nil {
+			amount := headroom.RemainingAmount.String()
+			limit.RemainingAmount = &amount
+		}
+		if headroom.RemainingCount != nil {
+			count := int64(*headroom.RemainingCount)
+			limit.RemainingCount = &count
+		}
+		message.Headroom = append(message.Headroom, limit)
+	}
+	return message
+}
@@ -0,0 +1,338 @@
+// Package server exposes the velocity limits engine over HTTP and gRPC so that loads
+// can be accepted or declined in real-time instead of in a batch file run.
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/internal/metrics"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/service"
+	"velocity-limits/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Server struct handles HTTP and gRPC requests against a shared storage.
+// Transactions are processed one at a time since a transaction reads and writes the
+// accounts of its customers, the storage itself is safe for concurrent use.
+type Server struct {
+	config   *config.Configuration
+	storage  storage.Storage
+	registry *prometheus.Registry
+	mu       sync.Mutex
+}
+
+// LimitsResponse struct represents the current velocity limits state of a customer account:
+// the usage of every calendar window rule and the headroom left for all rules.
+type LimitsResponse struct {
+	CustomerID string                  `json:"customer_id"`
+	Balances   models.Balances         `json:"balances"`
+	Tier       string                  `json:"tier,omitempty"`
+	TimeZone   string                  `json:"time_zone,omitempty"`
+	Limits     map[string]models.Limit `json:"limits"`
+	Headroom   models.Headroom         `json:"headroom"`
+}
+
+// LedgerResponse struct represents the balances of a customer account and the ledger
+// entries they're derived from.
+type LedgerResponse struct {
+	CustomerID string               `json:"customer_id"`
+	Balances   models.Balances      `json:"balances"`
+	Entries    []models.LedgerEntry `json:"entries"`
+}
+
+// ErrorResponse struct represents an error returned by the API.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Returns a new Server struct.
+func NewServer(config *config.Configuration, storage storage.Storage) *Server {
+	return &Server{
+		config:   config,
+		storage:  storage,
+		registry: metrics.NewRegistry(storage),
+	}
+}
+
+// Handler returns the HTTP handler with all API routes and the Prometheus metrics at
+// GET /metrics registered.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loads", s.handleTransactions(config.TypeLoad))
+	mux.HandleFunc("/loads/precheck", s.handlePreCheck)
+	mux.HandleFunc("/withdrawals", s.handleTransactions(config.TypeWithdrawal))
+	mux.HandleFunc("/transfers", s.handleTransactions(config.TypeTransfer))
+	mux.HandleFunc("/reversals", s.handleTransactions(config.TypeReversal))
+	mux.HandleFunc("/customers/", s.handleCustomers)
+	mux.HandleFunc("/snapshot", s.handleSnapshot)
+	mux.Handle("/metrics", metrics.Handler(s.registry))
+	return mux
+}
+
+// handleTransactions returns a handler which accepts a transaction payload in the input
+// file format, processes it as the given transaction type and returns the decision.
+// POST /loads, POST /withdrawals, POST /transfers and POST /reversals
+func (s *Server) handleTransactions(transactionType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.handleTransaction(w, r, transactionType)
+	}
+}
+
+// handleTransaction processes a single transaction payload as the given transaction type.
+func (s *Server) handleTransaction(w http.ResponseWriter, r *http.Request, transactionType string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var transaction models.Transaction
+	if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil {
+		metrics.ObserveParseError(models.ReasonMalformedRecord)
+		writeError(w, http.StatusBadRequest, "invalid transaction payload: "+err.Error())
+		return
+	}
+	transaction.Type = transactionType
+
+	// Invalid transactions are processed too, so that they're recorded in the audit log.
+	response, err := s.process(&transaction)
+	if err != nil {
+		log.Printf("Error - Processing transaction %+v: %v\n", transaction, err)
+		writeError(w, http.StatusInternalServerError, "unable to process transaction")
+		return
+	}
+	if reason := transaction.Validate(); reason != models.ReasonNone {
+		writeError(w, http.StatusBadRequest, "invalid transaction: "+string(reason))
+		return
+	}
+	// Retries get the original response, other payloads with the same ID a conflict.
+	if response == nil {
+		writeError(w, http.StatusConflict, "duplicate load id for customer")
+		return
+	}
+	if response.Reason == models.ReasonIdempotencyConflict {
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handlePreCheck evaluates a load payload without committing it and returns the decision
+// with the maximum amount and number of loads left. The time defaults to now.
+// POST /loads/precheck
+func (s *Server) handlePreCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var transaction models.Transaction
+	if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid transaction payload: "+err.Error())
+		return
+	}
+	transaction.Type = config.TypeLoad
+	if transaction.Time.IsZero() {
+		transaction.Time = time.Now().UTC()
+	}
+	if reason := transaction.Validate(); reason != models.ReasonNone {
+		writeError(w, http.StatusBadRequest, "invalid transaction: "+string(reason))
+		return
+	}
+
+	// Accounts are read while no transaction changes them.
+	s.mu.Lock()
+	preCheck, err := service.PreCheckLoad(s.config, s.storage, &transaction)
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("Error - Pre-checking transaction %+v: %v\n", transaction, err)
+		writeError(w, http.StatusInternalServerError, "unable to pre-check transaction")
+		return
+	}
+	writeJSON(w, http.StatusOK, preCheck)
+}
+
+// handleSnapshot returns a snapshot of the state taken while no transaction is processed.
+// GET /snapshot
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	snapshot, err := s.storage.Snapshot()
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("Error - Taking a snapshot: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "unable to take a snapshot")
+		return
+	}
+	snapshot.ConfigVersion = s.config.Version
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// process validates and processes a transaction, one at a time across all APIs.
+func (s *Server) process(transaction *models.Transaction) (*models.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return service.ValidateAndProcessTransaction(transaction, s.config, s.storage)
+}
+
+// handleCustomers routes requests for a single customer to its handler.
+func (s *Server) handleCustomers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "customers" || parts[1] == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	switch parts[2] {
+	case "limits":
+		s.handleCustomerLimits(w, r, parts[1])
+	case "profile":
+		s.handleCustomerProfile(w, r, parts[1])
+	case "ledger":
+		s.handleCustomerLedger(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handleCustomerLimits returns the limits of a customer at the time given by the
+// optional "at" query parameter (RFC 3339), which defaults to now.
+// GET /customers/{id}/limits
+func (s *Server) handleCustomerLimits(w http.ResponseWriter, r *http.Request, customerID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	at := time.Now().UTC()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid at parameter: "+err.Error())
+			return
+		}
+		at = parsed
+	}
+
+	limits, err := s.CustomerLimits(customerID, at)
+
+	if err != nil {
+		log.Printf("Error - Reading customer %s: %v\n", customerID, err)
+		writeError(w, http.StatusInternalServerError, "unable to read customer limits")
+		return
+	}
+	if limits == nil {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, limits)
+}
+
+// CustomerLimits returns the limits of a customer at the given time or nil if the customer doesn't exist.
+func (s *Server) CustomerLimits(customerID string, at time.Time) (*LimitsResponse, error) {
+	// Copy the account while holding the lock so it can't change while encoding.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, err := s.storage.GetAccount(customerID)
+	if err != nil || account == nil {
+		return nil, err
+	}
+
+	// Resets a copy so that windows which ended before the requested time show up unused.
+	account = account.Clone()
+	rules, err := service.AccountRules(s.config, account)
+	if err != nil {
+		return nil, err
+	}
+	account.ResetLimits(at, rules, s.config.LateTolerance)
+	limits := &LimitsResponse{
+		CustomerID: account.CustomerID,
+		Balances:   account.Balances,
+		Tier:       account.Tier,
+		TimeZone:   account.TimeZone,
+		Limits:     make(map[string]models.Limit, len(account.Limits)),
+		Headroom:   account.Headroom(at, rules),
+	}
+	for name, limit := range account.Limits {
+		limits.Limits[name] = *limit
+	}
+	return limits, nil
+}
+
+// handleCustomerProfile changes the tier, limit overrides and time zone of a customer at runtime.
+// PUT /customers/{id}/profile
+func (s *Server) handleCustomerProfile(w http.ResponseWriter, r *http.Request, customerID string) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var profile config.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid profile payload: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	account, err := service.SetCustomerProfile(s.config, s.storage, customerID, profile)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &account.Profile)
+}
+
+// handleCustomerLedger returns the ledger entries of a customer and the balances derived from them.
+// GET /customers/{id}/ledger
+func (s *Server) handleCustomerLedger(w http.ResponseWriter, r *http.Request, customerID string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	entries, err := s.storage.GetLedger(customerID)
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Error - Reading ledger of customer %s: %v\n", customerID, err)
+		writeError(w, http.StatusInternalServerError, "unable to read ledger")
+		return
+	}
+	if len(entries) == 0 {
+		writeError(w, http.StatusNotFound, "customer has no ledger entries")
+		return
+	}
+	writeJSON(w, http.StatusOK, &LedgerResponse{CustomerID: customerID, Balances: models.LedgerBalance(entries), Entries: entries})
+}
+
+// writeJSON writes the value as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error - Writing response: %v\n", err)
+	}
+}
+
+// writeError writes an error message as a JSON response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &ErrorResponse{Error: message})
+}
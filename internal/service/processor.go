@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/storage"
+)
+
+// tasksPerWorker is how many transactions per worker may wait for their turn to be
+// written, which bounds the memory used by a slow customer holding back the output.
+const tasksPerWorker = 64
+
+// Processor struct processes transactions on worker goroutines sharded by customer ID.
+// Transfers wait for all earlier transactions, since they change two accounts.
+// Responses are returned in input order, so the output is the same as a sequential run.
+type Processor struct {
+	config  *config.Configuration
+	storage storage.Storage
+	workers int
+}
+
+// task struct represents a transaction in flight with its outcome. Done is closed
+// when the outcome is set. Input lines which aren't processed have a dead letter,
+// tasks of input lines have the line number to report errors with.
+type task struct {
+	lineNumber  int
+	transaction models.Transaction
+	response    *models.Response
+	deadLetter  *models.DeadLetter
+	err         error
+	done        chan struct{}
+}
+
+// Returns a new Processor struct with the given number of workers, at least one.
+func NewProcessor(config *config.Configuration, storage storage.Storage, workers int) *Processor {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Processor{config: config, storage: storage, workers: workers}
+}
+
+// ProcessStream processes the input lines like the ProcessStream function and writes the
+// responses in input order. Returns the first read, storage or write error, transactions
+// already handed to other workers may still be processed.
+func (p *Processor) ProcessStream(reader io.Reader, writer io.Writer, deadLetters io.Writer) error {
+	lines := bufio.NewReader(reader)
+	output := bufio.NewWriter(writer)
+	lineNumber := 0
+	return p.run(func() (*task, error) {
+		for {
+			line, readErr := lines.ReadBytes('\n')
+			if readErr != nil && readErr != io.EOF {
+				return nil, readErr
+			}
+			lineNumber++
+			// Skips blank lines such as a trailing new line at the end of the input.
+			if len(bytes.TrimSpace(line)) > 0 {
+				return p.newTask(line, lineNumber, deadLetters), nil
+			}
+			if readErr == io.EOF {
+				return nil, nil
+			}
+		}
+	}, func(t *task) error {
+		if t.deadLetter != nil {
+			return writeDeadLetter(deadLetters, *t.deadLetter)
+		}
+		if t.response == nil {
+			return nil
+		}
+		if err := writeResponse(p.config, output, *t.response); err != nil {
+			return err
+		}
+		// Flushes every response so that consumers see decisions immediately.
+		return output.Flush()
+	})
+}
+
+// newTask returns the task of an input line, or a finished task with a dead letter when
+// the line isn't valid JSON or it's invalid and invalid lines go to the dead letters.
+func (p *Processor) newTask(line []byte, lineNumber int, deadLetters io.Writer) *task {
+	record := string(bytes.TrimSpace(line))
+	t := &task{lineNumber: lineNumber}
+	if err := json.Unmarshal(line, &t.transaction); err != nil {
+		t.deadLetter = &models.DeadLetter{Line: lineNumber, Reason: models.ReasonMalformedRecord, Error: err.Error(), Record: record}
+	} else if reason := t.transaction.Validate(); reason != models.ReasonNone && deadLetters != nil {
+		t.deadLetter = &models.DeadLetter{Line: lineNumber, Reason: reason, Record: record}
+	}
+	return t
+}
+
+// run dispatches the tasks returned by next to the worker of their customer until next
+// returns nil and passes every finished task to emit in the order they were returned.
+// Returns the first error of next, a task or emit.
+func (p *Processor) run(next func() (*task, error), emit func(*task) error) error {
+	var workers, inFlight sync.WaitGroup
+	shards := make([]chan *task, p.workers)
+	for i := range shards {
+		shards[i] = make(chan *task, tasksPerWorker)
+		workers.Add(1)
+		go func(shard <-chan *task) {
+			defer workers.Done()
+			for t := range shard {
+				p.process(t)
+				inFlight.Done()
+			}
+		}(shards[i])
+	}
+
+	// Emits the finished tasks in order, the first error stops the dispatch of new tasks
+	// while the remaining ones are still drained.
+	var emitErr error
+	failed := make(chan struct{})
+	pending := make(chan *task, p.workers*tasksPerWorker)
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+		for t := range pending {
+			<-t.done
+			if emitErr != nil {
+				continue
+			}
+			if emitErr = t.err; emitErr == nil {
+				emitErr = emit(t)
+			}
+			if emitErr != nil {
+				close(failed)
+			}
+		}
+	}()
+
+	nextErr := p.dispatch(next, shards, pending, &inFlight, failed)
+	for _, shard := range shards {
+		close(shard)
+	}
+	workers.Wait()
+	close(pending)
+	<-emitted
+	if emitErr != nil {
+		return emitErr
+	}
+	return nextErr
+}
+
+// dispatch hands the tasks to the shard of their customer until next returns nil or an
+// error or the emit fails. Transfers are processed on the dispatching goroutine after all
+// tasks in flight have finished, since they also change the receiving account.
+func (p *Processor) dispatch(next func() (*task, error), shards []chan *task, pending chan<- *task, inFlight *sync.WaitGroup, failed <-chan struct{}) error {
+	for {
+		select {
+		case <-failed:
+			return nil
+		default:
+		}
+
+		t, err := next()
+		if err != nil || t == nil {
+			return err
+		}
+		t.done = make(chan struct{})
+		pending <- t
+
+		switch {
+		case t.deadLetter != nil:
+			close(t.done)
+		case t.transaction.NormalizedType() == config.TypeTransfer:
+			inFlight.Wait()
+			p.process(t)
+		default:
+			inFlight.Add(1)
+			shards[p.shard(t.transaction.CustomerID)] <- t
+		}
+	}
+}
+
+// process validates and processes the transaction of the task and finishes the task.
+func (p *Processor) process(t *task) {
+	defer close(t.done)
+	t.response, t.err = ValidateAndProcessTransaction(&t.transaction, p.config, p.storage)
+	if t.err != nil && t.lineNumber > 0 {
+		t.err = fmt.Errorf("line %d: %w", t.lineNumber, t.err)
+	}
+}
+
+// shard returns the index of the worker which processes the transactions of a customer.
+func (p *Processor) shard(customerID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(customerID))
+	return int(hash.Sum32() % uint32(p.workers))
+}
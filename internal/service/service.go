@@ -5,14 +5,20 @@ package service
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"time"
 	"velocity-limits/config"
+	"velocity-limits/internal/metrics"
 	"velocity-limits/internal/models"
 	"velocity-limits/internal/storage"
+	"velocity-limits/pkg/money"
 	"velocity-limits/pkg/util"
 )
 
 // GetTransactionsFromInputFile reads the input file and creates a slice of Transaction struct.
+// Lines which aren't valid JSON are logged with their line number and skipped.
 func GetTransactionsFromInputFile(config *config.Configuration, filePath string) ([]models.Transaction, error) {
 	transactions := []models.Transaction{}
 	inputFile, err := util.OpenFile(config, filePath)
@@ -22,73 +28,322 @@ func GetTransactionsFromInputFile(config *config.Configuration, filePath string)
 	// defers input file closing so that it can be read.
 	defer inputFile.Close()
 	scanner := bufio.NewScanner(inputFile)
-	for scanner.Scan() {
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
 		byteValue := []byte(scanner.Text())
 		var transaction models.Transaction
 		// tries to unmarshal input transactions json into Transaction struct.
 		if err = json.Unmarshal(byteValue, &transaction); err != nil {
-			return nil, err
+			log.Printf("Skipping a malformed transaction on line %d: %v\n", lineNumber, err)
+			metrics.ObserveParseError(models.ReasonMalformedRecord)
+			err = nil
+			continue
 		}
 
 		// append current transaction to transactions slice.
 		transactions = append(transactions, transaction)
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
 	}
-	return transactions, err
+	// A read error or a line longer than the buffer ends the scan early.
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
 }
 
 // LoadFunds reads transactions, loads it into storage and creates a slice of Response struct.
-func LoadFunds(config *config.Configuration, transactions []models.Transaction, storage *storage.Storage) []models.Response {
+// Returns any storage error, stopping at the failing transaction.
+func LoadFunds(config *config.Configuration, transactions []models.Transaction, storage storage.Storage) ([]models.Response, error) {
 	responses := []models.Response{}
 	for _, transaction := range transactions {
-		response := ValidateAndProcessTransaction(&transaction, config, storage)
+		response, err := ValidateAndProcessTransaction(&transaction, config, storage)
+		if err != nil {
+			return nil, err
+		}
 		if response != nil {
 			responses = append(responses, *response)
 		}
 	}
-	return responses
+	return responses, nil
 }
 
-// Validates transaction for duplication and send it for further processing.
-// Also stores processing result into responses slice.
-func ValidateAndProcessTransaction(transaction *models.Transaction, config *config.Configuration, storage *storage.Storage) *models.Response {
+// Validates transaction fields and duplication and send it for further processing.
+// Invalid, future and repeated transactions are declined with their reason in the audit log.
+// The writes of a decision are stored together with Storage.Atomic and recorded in the metrics.
+// Returns a nil response for duplicates without a stored response and any storage error.
+func ValidateAndProcessTransaction(transaction *models.Transaction, config *config.Configuration, storage storage.Storage) (*models.Response, error) {
+	start := time.Now()
+	response, err := processAtomically(transaction, config, storage)
+	if err != nil {
+		return nil, err
+	}
+	if reason := transaction.Validate(); reason != models.ReasonNone {
+		metrics.ObserveParseError(reason)
+		return response, nil
+	}
+	metrics.ObserveDecision(transaction, response, time.Since(start))
+	return response, nil
+}
+
+// processAtomically validates and processes the transaction with the writes of its decision
+// in a single storage transaction.
+func processAtomically(transaction *models.Transaction, config *config.Configuration, store storage.Storage) (response *models.Response, err error) {
+	err = store.Atomic(func(storage storage.Storage) error {
+		response, err = validateAndProcessTransaction(transaction, config, storage)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// validateAndProcessTransaction validates and processes the transaction like ValidateAndProcessTransaction.
+func validateAndProcessTransaction(transaction *models.Transaction, config *config.Configuration, storage storage.Storage) (*models.Response, error) {
+	if reason := transaction.Validate(); reason != models.ReasonNone {
+		decision := models.Decision{Reason: reason}
+		if err := storage.AppendAudit(models.NewAuditRecord(transaction, decision, nil, nil, config.Version)); err != nil {
+			return nil, err
+		}
+		return models.NewResponseFromDecision(transaction.ID, transaction.CustomerID, decision), nil
+	}
+
+	// Transactions from a clock far ahead would move the windows of the account forward.
+	if isFuture(config, transaction) {
+		decision := models.Decision{Reason: models.ReasonFutureTransaction}
+		if err := storage.AppendAudit(models.NewAuditRecord(transaction, decision, nil, nil, config.Version)); err != nil {
+			return nil, err
+		}
+		return models.NewResponseFromDecision(transaction.ID, transaction.CustomerID, decision), nil
+	}
+
 	// Checks if load ID is repeated for the same customer ID.
-	if storage.IsDuplicateTransaction(transaction.ID, transaction.CustomerID) {
-		log.Printf("Ignoring a duplicate transaction: %+v\n", transaction)
-		return nil
+	processed, err := storage.GetProcessedTransaction(transaction.ID, transaction.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if processed != nil {
+		response, reason := processed.Repeat(transaction)
+		log.Printf("Repeated transaction (%s): %+v\n", reason, transaction)
+		decision := models.Decision{Reason: reason}
+		return response, storage.AppendAudit(models.NewAuditRecord(transaction, decision, nil, nil, config.Version))
+	}
+
+	// If valid, process it and add it with its response to the storage.
+	decision, err := ProcessTransaction(transaction, storage, config)
+	if err != nil {
+		return nil, err
 	}
+	response := models.NewResponseFromDecision(transaction.ID, transaction.CustomerID, decision)
+	if err = storage.AddTransaction(models.NewProcessedTransaction(transaction, response)); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
 
-	// If valid, add it to the storage and send it for processing.
-	storage.AddTransaction(transaction.ID, transaction.CustomerID)
-	accepted := ProcessTransaction(transaction, storage, config)
-	response := models.NewResponse(transaction.ID, transaction.CustomerID, accepted)
+// PreCheckLoad evaluates a transaction as a load without storing anything.
+// A load with the ID of a processed transaction gets what sending it would return.
+// Returns the pre-check with the maximum amount and number of loads left and any storage error.
+func PreCheckLoad(config *config.Configuration, storage storage.Storage, transaction *models.Transaction) (*models.PreCheck, error) {
+	if reason := transaction.Validate(); reason != models.ReasonNone {
+		return models.NewPreCheck(transaction, models.Decision{Reason: reason}, nil, nil), nil
+	}
+	if isFuture(config, transaction) {
+		return models.NewPreCheck(transaction, models.Decision{Reason: models.ReasonFutureTransaction}, nil, nil), nil
+	}
+	processed, err := storage.GetProcessedTransaction(transaction.ID, transaction.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if processed != nil {
+		response, reason := processed.Repeat(transaction)
+		if response == nil {
+			return models.NewPreCheck(transaction, models.Decision{Reason: reason}, nil, nil), nil
+		}
+		return &models.PreCheck{Response: *response}, nil
+	}
+	account, err := getOrCreateAccount(storage, transaction.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	// The usage is converted on a copy, since nothing is stored.
+	account = account.Clone()
+	rules, err := AccountRules(config, account)
+	if err != nil {
+		return nil, err
+	}
+	return account.PreCheckLoad(transaction, rules, config.LateTolerance), nil
+}
 
-	return response
+// isFuture reports whether the transaction time is later than the clock of the config allows,
+// which is never the case without a clock.
+func isFuture(config *config.Configuration, transaction *models.Transaction) bool {
+	return config.Clock != nil && transaction.Time.After(config.Clock().Add(config.FutureTolerance))
 }
 
 // ProcessTransaction function verifies if customer account is created in the storage.
-// If not it will create a new account with default velocity limits.
-// If already created, then tries to reset limits based on transaction time.
-// At last, it tries to load the funds from given transaction.
-func ProcessTransaction(transaction *models.Transaction, storage *storage.Storage, config *config.Configuration) bool {
-	// Get the account from storage
-	account := storage.GetAccount(transaction.CustomerID)
+// If not it will create a new account, then it resets limits based on transaction time.
+// At last, it tries to decide the transaction and stores the accounts, ledger and audit record.
+func ProcessTransaction(transaction *models.Transaction, storage storage.Storage, config *config.Configuration) (models.Decision, error) {
+	account, err := getOrCreateAccount(storage, transaction.CustomerID)
+	if err != nil {
+		return models.Decision{}, err
+	}
+	rules, err := AccountRules(config, account)
+	if err != nil {
+		return models.Decision{}, err
+	}
+	account.ResetLimits(transaction.Time, rules, config.LateTolerance)
 
-	if account == nil {
-		account = models.NewCustomerAccount(transaction.CustomerID)
-		account.DailyLimit = models.NewDailyLimit(transaction.Time, config.MaxLoadLimitPerDay, config.MaxLoadPerDay)
-		account.WeeklyLimit = models.NewWeeklyLimit(transaction.Time, config.MaxLoadLimitPerWeek)
-		storage.AddAccount(account)
+	before := account.Snapshot(transaction.Time, rules)
+	decision, err := applyTransaction(transaction, account, rules, storage, config.LateTolerance)
+	if err != nil {
+		return models.Decision{}, err
+	}
+	record := models.NewAuditRecord(transaction, decision, before, account.Snapshot(transaction.Time, rules), config.Version)
+	if err = storage.AppendAudit(record); err != nil {
+		return models.Decision{}, err
+	}
+	return decision, nil
+}
+
+// applyTransaction loads, withdraws, transfers or reverses the transaction on the account
+// and saves the balance changes of an accepted transaction.
+func applyTransaction(transaction *models.Transaction, account *models.CustomerAccount, rules []config.LimitRule, storage storage.Storage, lateTolerance time.Duration) (models.Decision, error) {
+	if transaction.IsReversal() {
+		return processReversal(transaction, account, rules, storage)
+	}
+
+	var decision models.Decision
+	if transaction.IsDebit() {
+		decision = account.WithdrawFunds(transaction, rules, lateTolerance)
 	} else {
-		account.ResetLimits(transaction.Time, config.MaxLoadLimitPerDay, config.MaxLoadPerDay, config.MaxLoadLimitPerWeek)
+		decision = account.LoadFunds(transaction, rules, lateTolerance)
+	}
+	if _, err := storage.AddAccount(account); err != nil || !decision.Accepted {
+		return decision, err
+	}
+
+	if err := recordBalanceChanges(transaction, decision, storage); err != nil {
+		return models.Decision{}, err
+	}
+	return decision, nil
+}
+
+// processReversal reverses the load referenced by the transaction, which is looked up in
+// the ledger of the account, and appends the reversed amount to the ledger as a debit.
+func processReversal(transaction *models.Transaction, account *models.CustomerAccount, rules []config.LimitRule, storage storage.Storage) (models.Decision, error) {
+	ledger, err := storage.GetLedger(transaction.CustomerID)
+	if err != nil {
+		return models.Decision{}, err
+	}
+	decision := account.ReverseLoad(transaction, ledger, rules)
+	if _, err = storage.AddAccount(account); err != nil || !decision.Accepted {
+		return decision, err
+	}
+
+	original, _ := models.FindLoad(ledger, transaction.OriginalID)
+	debit := money.New(0, original.Amount.Currency).Sub(original.Amount)
+	if err = storage.AppendLedger(models.NewLedgerEntry(transaction.CustomerID, transaction, debit, "")); err != nil {
+		return models.Decision{}, err
+	}
+	return decision, nil
+}
+
+// recordBalanceChanges appends the balance changes of an accepted transaction to the
+// ledger, a load with the base amount of its decision. A transfer also credits the
+// receiving account, which is created if needed.
+func recordBalanceChanges(transaction *models.Transaction, decision models.Decision, storage storage.Storage) error {
+	// The amount was validated by the accepted transaction.
+	amount, _ := transaction.GetParsedAmount()
+	debit := money.New(0, amount.Currency).Sub(amount)
+
+	switch transaction.NormalizedType() {
+	case config.TypeLoad:
+		entry := models.NewLedgerEntry(transaction.CustomerID, transaction, amount, "")
+		entry.BaseAmount = &decision.BaseAmount
+		return storage.AppendLedger(entry)
+	case config.TypeWithdrawal:
+		return storage.AppendLedger(models.NewLedgerEntry(transaction.CustomerID, transaction, debit, ""))
+	}
+
+	receiver, err := getOrCreateAccount(storage, transaction.ToCustomerID)
+	if err != nil {
+		return err
+	}
+	receiver.ReceiveFunds(amount)
+	if _, err = storage.AddAccount(receiver); err != nil {
+		return err
+	}
+	return storage.AppendLedger(
+		models.NewLedgerEntry(transaction.CustomerID, transaction, debit, transaction.ToCustomerID),
+		models.NewLedgerEntry(transaction.ToCustomerID, transaction, amount, transaction.CustomerID),
+	)
+}
+
+// getOrCreateAccount returns the customer account from the storage or a new one.
+func getOrCreateAccount(storage storage.Storage, customerID string) (*models.CustomerAccount, error) {
+	account, err := storage.GetAccount(customerID)
+	if err != nil || account != nil {
+		return account, err
+	}
+	return models.NewCustomerAccount(customerID), nil
+}
+
+// LimitRules returns the limit rules which apply to a customer account: the global rules
+// overridden by the customer tier, the customer overrides from the config and at last
+// the overrides set on the account at runtime.
+func LimitRules(config *config.Configuration, account *models.CustomerAccount) ([]config.LimitRule, error) {
+	return config.LimitRulesFor(account.CustomerID, account.Profile)
+}
+
+// AccountRules returns the limit rules of the account like LimitRules and converts the usage
+// of the account into their base currency and calendar.
+func AccountRules(config *config.Configuration, account *models.CustomerAccount) ([]config.LimitRule, error) {
+	rules, err := LimitRules(config, account)
+	if err != nil {
+		return nil, err
+	}
+	if err = account.ConvertUsage(rules); err != nil {
+		return nil, err
+	}
+	if err = account.UseCalendar(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SetCustomerProfile changes the tier, limit overrides and time zone of a customer at runtime.
+// The usage of the current windows is carried into the windows of a new time zone.
+// Returns an error without changing the account for an invalid profile.
+func SetCustomerProfile(config *config.Configuration, storage storage.Storage, customerID string, profile config.Profile) (*models.CustomerAccount, error) {
+	if profile.Tier != "" && !config.HasTier(profile.Tier) {
+		return nil, fmt.Errorf("unknown tier %q", profile.Tier)
 	}
 
-	return account.LoadFunds(transaction)
+	account, err := storage.GetAccount(customerID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		account = models.NewCustomerAccount(customerID)
+	}
+	// The profile is changed on a copy, so a rejected one leaves the stored account as it is.
+	account = account.Clone()
+	// Records the calendar of the current windows, unless the rules don't resolve anymore.
+	if oldRules, err := LimitRules(config, account); err == nil {
+		if err = account.UseCalendar(oldRules); err != nil {
+			return nil, err
+		}
+	}
+	account.Profile = profile
+	// Resolving the rules validates the overrides and the time zone.
+	if _, err = AccountRules(config, account); err != nil {
+		return nil, err
+	}
+	return storage.AddAccount(account)
 }
 
 // WriteResponsesToOutputFile writes responses to the output.txt file.
+// The legacy output format drops reasons and headroom to match the original output.
 // Returns any error or nil in case succeed.
 func WriteResponsesToOutputFile(config *config.Configuration, responses []models.Response, filePath string) error {
 	outputFile := util.CreateFile(config, filePath)
@@ -96,15 +351,67 @@ func WriteResponsesToOutputFile(config *config.Configuration, responses []models
 	writer := bufio.NewWriter(outputFile)
 
 	for _, response := range responses {
-		byteValue, err := json.Marshal(response)
-		if err != nil {
+		if err := writeResponse(config, writer, response); err != nil {
 			return err
 		}
+	}
+	writer.Flush()
+	return nil
+}
+
+// ProcessStream reads transactions line by line and writes each response as soon as it's decided.
+// Malformed lines go to the dead-letter writer, without one they're declined or skipped.
+// Returns the first read, storage or write error.
+func ProcessStream(config *config.Configuration, storage storage.Storage, reader io.Reader, writer io.Writer, deadLetters io.Writer) error {
+	return NewProcessor(config, storage, 1).ProcessStream(reader, writer, deadLetters)
+}
 
-		if _, err = writer.WriteString(string(byteValue) + "\n"); err != nil {
+// writeDeadLetter writes a rejected input line as a JSON line to the dead-letter writer.
+// Without a dead-letter writer the line is logged. Either way it's counted as a parse error.
+func writeDeadLetter(deadLetters io.Writer, deadLetter models.DeadLetter) error {
+	metrics.ObserveParseError(deadLetter.Reason)
+	if deadLetters == nil {
+		log.Printf("Skipping a malformed transaction on line %d: %s\n", deadLetter.Line, deadLetter.Error)
+		return nil
+	}
+	byteValue, err := json.Marshal(deadLetter)
+	if err != nil {
+		return err
+	}
+	_, err = deadLetters.Write(append(byteValue, '\n'))
+	return err
+}
+
+// writeResponse writes a response as a JSON line in the configured output format.
+// The legacy format ignores repeated transaction IDs like the original output.
+func writeResponse(config *config.Configuration, writer *bufio.Writer, response models.Response) error {
+	if config.IsLegacyOutput() {
+		if response.IsRepeated() {
+			return nil
+		}
+		response = response.Legacy()
+	}
+	byteValue, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.WriteString(string(byteValue) + "\n")
+	return err
+}
+
+// WriteAudit writes the audit records of a customer with a transaction time in [from, to)
+// to the writer as JSON lines. A zero from or to leaves that end of the range open.
+func WriteAudit(storage storage.Storage, customerID string, from, to time.Time, writer io.Writer) error {
+	records, err := storage.GetAudit(customerID, from, to)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
 			return err
 		}
 	}
-	writer.Flush()
 	return nil
 }
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/storage"
+)
+
+// Simulate replays the transactions through LoadFunds with the given config on a new
+// in-memory storage, so the replay is deterministic and doesn't change any stored state,
+// and returns the report of the differences to the baseline responses.
+func Simulate(config *config.Configuration, transactions []models.Transaction, baseline []models.Response) (*models.SimulationReport, error) {
+	responses, err := LoadFunds(config, transactions, storage.NewStorage())
+	if err != nil {
+		return nil, err
+	}
+	return models.CompareResponses(baseline, responses), nil
+}
+
+// ReadResponses reads responses written as JSON lines in the legacy or detailed output format.
+// Empty lines are skipped. Returns an error with the line number of a malformed line.
+func ReadResponses(reader io.Reader) ([]models.Response, error) {
+	var responses []models.Response
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var response models.Response
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		responses = append(responses, response)
+	}
+	return responses, scanner.Err()
+}
+
+// WriteSimulationReport writes the simulation report as aligned text: the totals, the
+// simulated declines by reason, the impact per customer and the changed decisions.
+func WriteSimulationReport(report *models.SimulationReport, writer io.Writer) error {
+	w := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Transactions:\t%d\n", report.Transactions)
+	fmt.Fprintf(w, "Accepted (baseline):\t%d\n", report.BaselineAccepted)
+	fmt.Fprintf(w, "Accepted (simulated):\t%d\n", report.SimulatedAccepted)
+	fmt.Fprintf(w, "Newly declined:\t%d\n", len(report.NewlyDeclined))
+	fmt.Fprintf(w, "Newly accepted:\t%d\n", len(report.NewlyAccepted))
+	fmt.Fprintf(w, "Without baseline:\t%d\n", report.Unmatched)
+
+	reasons := make([]string, 0, len(report.DeclinedByReason))
+	for reason := range report.DeclinedByReason {
+		reasons = append(reasons, string(reason))
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(w, "\nDeclines by reason:\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "  %s\t%d\n", reason, report.DeclinedByReason[models.Reason(reason)])
+	}
+
+	fmt.Fprintf(w, "\nCustomer impact:\n")
+	for _, impact := range report.Customers {
+		fmt.Fprintf(w, "  %s\tnewly declined %d\tnewly accepted %d\n", impact.CustomerID, impact.NewlyDeclined, impact.NewlyAccepted)
+	}
+
+	for _, changes := range []struct {
+		title     string
+		responses []models.Response
+	}{{"Newly declined", report.NewlyDeclined}, {"Newly accepted", report.NewlyAccepted}} {
+		fmt.Fprintf(w, "\n%s:\n", changes.title)
+		for _, response := range changes.responses {
+			fmt.Fprintf(w, "  id %s\tcustomer %s\t%s\n", response.ID, response.CustomerID, response.Reason)
+		}
+	}
+	return w.Flush()
+}
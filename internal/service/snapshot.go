@@ -0,0 +1,54 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/storage"
+)
+
+// WriteSnapshot takes a snapshot of the storage with the version of the config and writes
+// it to the writer as JSON. No transaction may be processed while it's taken.
+func WriteSnapshot(config *config.Configuration, storage storage.Storage, writer io.Writer) error {
+	snapshot, err := storage.Snapshot()
+	if err != nil {
+		return err
+	}
+	snapshot.ConfigVersion = config.Version
+	return json.NewEncoder(writer).Encode(snapshot)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+// Returns an error for malformed snapshots and versions which aren't supported.
+func ReadSnapshot(reader io.Reader) (*models.Snapshot, error) {
+	var snapshot models.Snapshot
+	if err := json.NewDecoder(reader).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	if err := snapshot.CheckVersion(); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// RestoreSnapshot reads a snapshot and restores it into the empty storage. A snapshot taken
+// with another config is restored too, since limits may change between runs, which is logged.
+// The usage of the accounts is converted into the base currency of their rules, a snapshot
+// with usage which can't be converted isn't restored.
+func RestoreSnapshot(config *config.Configuration, storage storage.Storage, reader io.Reader) error {
+	snapshot, err := ReadSnapshot(reader)
+	if err != nil {
+		return err
+	}
+	if snapshot.ConfigVersion != config.Version {
+		log.Printf("Restoring a snapshot taken with config version %s, the config version is %s\n", snapshot.ConfigVersion, config.Version)
+	}
+	for _, account := range snapshot.Accounts {
+		if _, err = AccountRules(config, account); err != nil {
+			return err
+		}
+	}
+	return storage.Restore(snapshot)
+}
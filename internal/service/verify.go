@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/storage"
+)
+
+// Verify processes the input with the config on a new in-memory storage, like a run of the
+// application, and compares the responses line by line with the expected JSON lines while
+// they're written. Only the input lines of responses which weren't compared yet are kept.
+// Returns the mismatching lines, which are empty when the output is as expected.
+func Verify(config *config.Configuration, input io.Reader, expected io.Reader) ([]models.Mismatch, error) {
+	// Malformed lines go to the dead letters instead of the output when they're configured.
+	var deadLetters io.Writer
+	if config.DeadLetterFile != "" {
+		deadLetters = io.Discard
+	}
+	inputLines := &lineQueue{}
+	outputReader, outputWriter := io.Pipe()
+	// Closing the reader stops the processing when the comparison ends early.
+	defer outputReader.Close()
+	processed := make(chan error, 1)
+	go func() {
+		err := ProcessStream(config, storage.NewStorage(), io.TeeReader(input, inputLines), outputWriter, deadLetters)
+		outputWriter.CloseWithError(err)
+		processed <- err
+	}()
+
+	actualLines, expectedLines := newLineReader(outputReader), newLineReader(expected)
+	var mismatches []models.Mismatch
+	for i := 1; ; i++ {
+		var mismatch models.Mismatch
+		actualOK, err := actualLines.next(&mismatch.Actual)
+		if err != nil {
+			return nil, err
+		}
+		expectedOK, err := expectedLines.next(&mismatch.Expected)
+		if err != nil {
+			return nil, err
+		}
+		if !actualOK && !expectedOK {
+			break
+		}
+
+		var response models.Response
+		if json.Unmarshal([]byte(mismatch.Actual), &response) != nil || response.ID == "" {
+			json.Unmarshal([]byte(mismatch.Expected), &response)
+		}
+		// The input lines are taken for every response, so that the queue doesn't grow.
+		input := inputLines.take(response.ID, response.CustomerID)
+		if mismatch.Expected == mismatch.Actual {
+			continue
+		}
+		mismatch.Line, mismatch.ID, mismatch.CustomerID, mismatch.Input = i, response.ID, response.CustomerID, input
+		mismatches = append(mismatches, mismatch)
+	}
+	if err := <-processed; err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// WriteMismatches writes every mismatching line with its id, customer_id, input line and
+// the expected and actual lines, followed by the number of mismatches.
+func WriteMismatches(mismatches []models.Mismatch, writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for _, mismatch := range mismatches {
+		fmt.Fprintf(w, "line %d: id %q customer_id %q\n", mismatch.Line, mismatch.ID, mismatch.CustomerID)
+		fmt.Fprintf(w, "  input:    %s\n", mismatch.Input)
+		fmt.Fprintf(w, "  expected: %s\n", mismatch.Expected)
+		fmt.Fprintf(w, "  actual:   %s\n", mismatch.Actual)
+	}
+	fmt.Fprintf(w, "%d mismatching lines\n", len(mismatches))
+	return w.Flush()
+}
+
+// lineReader struct reads lines without line endings and trailing empty lines.
+type lineReader struct {
+	scanner *bufio.Scanner
+	// blanks is the number of empty lines read before line, which are only returned when
+	// there's a line after them.
+	blanks int
+	line   *string
+}
+
+// Returns a new line reader struct for the reader.
+func newLineReader(reader io.Reader) *lineReader {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &lineReader{scanner: scanner}
+}
+
+// next sets the next line and reports whether there was one.
+func (r *lineReader) next(line *string) (bool, error) {
+	if r.blanks > 0 {
+		r.blanks--
+		*line = ""
+		return true, nil
+	}
+	if r.line != nil {
+		*line, r.line = *r.line, nil
+		return true, nil
+	}
+	for r.scanner.Scan() {
+		text := string(bytes.TrimRight(r.scanner.Bytes(), "\r"))
+		if text == "" {
+			r.blanks++
+			continue
+		}
+		if r.blanks > 0 {
+			r.blanks--
+			*line, r.line = "", &text
+			return true, nil
+		}
+		*line = text
+		return true, nil
+	}
+	return false, r.scanner.Err()
+}
+
+// lineQueue struct records the lines written to it, i.e. the input lines read by the
+// processing, until they're taken for the response of their transaction.
+type lineQueue struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+// Write records the complete lines of p and keeps the rest for the next write.
+func (q *lineQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(p)
+	for {
+		end := bytes.IndexByte(p, '\n')
+		if end < 0 {
+			q.partial = append(q.partial, p...)
+			return n, nil
+		}
+		q.partial = append(q.partial, p[:end]...)
+		q.lines = append(q.lines, string(bytes.TrimRight(q.partial, "\r")))
+		q.partial, p = q.partial[:0], p[end+1:]
+	}
+}
+
+// take removes the lines up to the first one of the transaction with the ID and customer ID
+// and returns it, lines before it had no response of their own. The last line may have no
+// line ending. Returns an empty line and keeps the queue when there's no such line.
+func (q *lineQueue) take(id, customerID string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, line := range q.lines {
+		if isTransactionLine(line, id, customerID) {
+			q.lines = q.lines[i+1:]
+			return line
+		}
+	}
+	if line := string(q.partial); isTransactionLine(line, id, customerID) {
+		q.lines, q.partial = q.lines[:0], q.partial[:0]
+		return line
+	}
+	return ""
+}
+
+// isTransactionLine reports whether the line is a transaction with the ID and customer ID.
+func isTransactionLine(line, id, customerID string) bool {
+	var transaction models.Transaction
+	return json.Unmarshal([]byte(line), &transaction) == nil && transaction.ID == id && transaction.CustomerID == customerID
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+	"velocity-limits/internal/models"
+)
+
+// auditFile struct appends audit records to a file as JSON lines and reads them back from it,
+// so that the in-memory storage doesn't keep the audit log. Records are never changed or removed.
+type auditFile struct {
+	path string
+	file *os.File
+}
+
+// Returns a new audit file struct appending to the file at the given path, which is created if needed.
+func openAuditFile(path string) (*auditFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditFile{path: path, file: file}, nil
+}
+
+// append writes the records as JSON lines with a single write.
+func (a *auditFile) append(records ...models.AuditRecord) error {
+	var lines []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	_, err := a.file.Write(lines)
+	return err
+}
+
+// read returns the records of a customer with a transaction time in [from, to) in the order
+// they were appended.
+func (a *auditFile) read(customerID string, from, to time.Time) ([]models.AuditRecord, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []models.AuditRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record models.AuditRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return nil, err
+			}
+			if inAuditRange(record, customerID, from, to) {
+				records = append(records, record)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// close closes the file.
+func (a *auditFile) close() error {
+	return a.file.Close()
+}
+
+// inAuditRange reports whether the record is of the customer with a transaction time in [from, to).
+// A zero from or to leaves that end of the range open.
+func inAuditRange(record models.AuditRecord, customerID string, from, to time.Time) bool {
+	transactionTime := record.Transaction.Time
+	return record.Transaction.CustomerID == customerID && (from.IsZero() || !transactionTime.Before(from)) &&
+		(to.IsZero() || transactionTime.Before(to))
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+	"velocity-limits/internal/models"
+)
+
+// Retention struct bounds the processed transaction IDs kept for duplicate detection.
+// IDs expire Window after the latest processing time, at most MaxIDs of them are kept.
+// The in-memory storage only keeps the responses of the latest MaxResponses IDs.
+// Zero values keep IDs and responses forever.
+type Retention struct {
+	Window       time.Duration
+	MaxIDs       int
+	MaxResponses int
+}
+
+// horizon returns the processing time before which IDs are expired given the latest
+// processing time, or the zero time when IDs never expire.
+func (r Retention) horizon(latest time.Time) time.Time {
+	if r.Window <= 0 || latest.IsZero() {
+		return time.Time{}
+	}
+	return latest.Add(-r.Window)
+}
+
+// transactionKey is the composite key of a processed transaction, so that the load ID
+// "12" of customer "3" doesn't collide with the load ID "1" of customer "23".
+type transactionKey struct {
+	id         string
+	customerID string
+}
+
+// processedIDs keeps processed transactions by key in a map for duplicate checks and
+// their keys in a min-heap by processing time for evicting the oldest ones. The keys of
+// transactions with a response are queued in the order they were added for dropping the
+// oldest responses.
+type processedIDs struct {
+	retention     Retention
+	transactions  map[transactionKey]models.ProcessedTransaction
+	byTime        keysByTime
+	withResponses []transactionKey
+	latest        time.Time
+}
+
+// Returns new empty processed IDs with the given retention.
+func newProcessedIDs(retention Retention) *processedIDs {
+	return &processedIDs{retention: retention, transactions: make(map[transactionKey]models.ProcessedTransaction)}
+}
+
+// add records a processed transaction, keeping the first one added with its key,
+// and evicts the expired IDs and the oldest ones above the maximum.
+func (p *processedIDs) add(processed models.ProcessedTransaction) {
+	processed = withProcessedAt(processed)
+	key := transactionKey{id: processed.ID, customerID: processed.CustomerID}
+	if _, ok := p.transactions[key]; !ok {
+		p.transactions[key] = processed
+		heap.Push(&p.byTime, timedKey{key: key, time: processed.ProcessedAt})
+		if processed.Response != nil && p.retention.MaxResponses > 0 {
+			p.withResponses = append(p.withResponses, key)
+		}
+	}
+	for p.retention.MaxResponses > 0 && len(p.withResponses) > p.retention.MaxResponses {
+		if dropped, ok := p.transactions[p.withResponses[0]]; ok {
+			dropped.Response = nil
+			p.transactions[p.withResponses[0]] = dropped
+		}
+		p.withResponses = p.withResponses[1:]
+	}
+	if processed.ProcessedAt.After(p.latest) {
+		p.latest = processed.ProcessedAt
+	}
+
+	horizon := p.retention.horizon(p.latest)
+	for len(p.byTime) > 0 && (p.byTime[0].time.Before(horizon) ||
+		(p.retention.MaxIDs > 0 && len(p.byTime) > p.retention.MaxIDs)) {
+		delete(p.transactions, heap.Pop(&p.byTime).(timedKey).key)
+	}
+}
+
+// get returns the processed transaction with the key or nil if there's none or it expired.
+func (p *processedIDs) get(key transactionKey) *models.ProcessedTransaction {
+	processed, ok := p.transactions[key]
+	if !ok || processed.ProcessedAt.Before(p.retention.horizon(p.latest)) {
+		return nil
+	}
+	return &processed
+}
+
+// all returns the unexpired processed transactions ordered by time and key.
+func (p *processedIDs) all() []models.ProcessedTransaction {
+	horizon := p.retention.horizon(p.latest)
+	processed := make([]models.ProcessedTransaction, 0, len(p.transactions))
+	for _, transaction := range p.transactions {
+		if !transaction.ProcessedAt.Before(horizon) {
+			processed = append(processed, transaction)
+		}
+	}
+	sort.Slice(processed, func(i, j int) bool {
+		a, b := processed[i], processed[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.CustomerID != b.CustomerID {
+			return a.CustomerID < b.CustomerID
+		}
+		return a.ID < b.ID
+	})
+	return processed
+}
+
+// withProcessedAt returns the processed transaction with the current time as its processing
+// time when it has none, such as the transactions of snapshots of earlier versions.
+func withProcessedAt(processed models.ProcessedTransaction) models.ProcessedTransaction {
+	if processed.ProcessedAt.IsZero() {
+		processed.ProcessedAt = time.Now().UTC()
+	}
+	return processed
+}
+
+// setRetention changes the retention, which applies from the next added ID.
+func (p *processedIDs) setRetention(retention Retention) {
+	p.retention = retention
+}
+
+// timedKey is a transaction key with its processing time.
+type timedKey struct {
+	key  transactionKey
+	time time.Time
+}
+
+// keysByTime implements heap.Interface with the earliest processed transaction key first.
+type keysByTime []timedKey
+
+func (h keysByTime) Len() int            { return len(h) }
+func (h keysByTime) Less(i, j int) bool  { return h[i].time.Before(h[j].time) }
+func (h keysByTime) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keysByTime) Push(x interface{}) { *h = append(*h, x.(timedKey)) }
+func (h *keysByTime) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
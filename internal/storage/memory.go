@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"velocity-limits/internal/models"
+)
+
+// MemoryStorage struct keeps customer accounts, ledgers and processed transactions in maps.
+// The audit log is appended to an audit file, without one it isn't kept.
+// Fields can't be exported out of package and the state is lost at process exit.
+type MemoryStorage struct {
+	mu           sync.RWMutex
+	accounts     map[string]*models.CustomerAccount
+	ledgers      map[string][]models.LedgerEntry
+	transactions *processedIDs
+	audit        *auditFile
+}
+
+// Returns a new in-memory storage struct with default values
+func NewStorage() *MemoryStorage {
+	return &MemoryStorage{
+		accounts:     make(map[string]*models.CustomerAccount),
+		ledgers:      make(map[string][]models.LedgerEntry),
+		transactions: newProcessedIDs(Retention{}),
+	}
+}
+
+// Returns a customer account by customer ID.
+func (s *MemoryStorage) GetAccount(customerID string) (*models.CustomerAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if acc, ok := s.accounts[customerID]; ok {
+		return acc, nil
+	}
+	return nil, nil
+}
+
+// Add customer account to the storage with its velocity limits.
+func (s *MemoryStorage) AddAccount(account *models.CustomerAccount) (*models.CustomerAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[account.CustomerID] = account
+	return account, nil
+}
+
+// Returns the number of customer accounts.
+func (s *MemoryStorage) CountAccounts() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.accounts), nil
+}
+
+// Sets how long and how many processed transaction IDs are kept for duplicate
+// detection, by default all of them are kept.
+func (s *MemoryStorage) SetRetention(retention Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions.setRetention(retention)
+}
+
+// Adds a processed transaction with its response for duplicate detection.
+func (s *MemoryStorage) AddTransaction(processed models.ProcessedTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions.add(processed)
+	return nil
+}
+
+// Checks for duplicate transaction by load ID and customer ID.
+func (s *MemoryStorage) IsDuplicateTransaction(id, customerID string) (bool, error) {
+	processed, err := s.GetProcessedTransaction(id, customerID)
+	return processed != nil, err
+}
+
+// Returns the processed transaction with the load ID and customer ID or nil.
+func (s *MemoryStorage) GetProcessedTransaction(id, customerID string) (*models.ProcessedTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transactions.get(transactionKey{id: id, customerID: customerID}), nil
+}
+
+// Appends entries to the ledgers of their accounts.
+func (s *MemoryStorage) AppendLedger(entries ...models.LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		s.appendLedger(entry)
+	}
+	return nil
+}
+
+// appendLedger appends an entry to the ledger of its account.
+func (s *MemoryStorage) appendLedger(entry models.LedgerEntry) {
+	s.ledgers[entry.CustomerID] = append(s.ledgers[entry.CustomerID], entry)
+}
+
+// Returns a copy of the ledger entries of a customer account.
+func (s *MemoryStorage) GetLedger(customerID string) ([]models.LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.LedgerEntry(nil), s.ledgers[customerID]...), nil
+}
+
+// Appends the audit log to the file at the given path as JSON lines, after the records
+// already in it. The file is created if needed.
+func (s *MemoryStorage) SetAuditFile(path string) error {
+	audit, err := openAuditFile(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audit != nil {
+		s.audit.close()
+	}
+	s.audit = audit
+	return nil
+}
+
+// Appends a record to the audit file, it's discarded without one.
+func (s *MemoryStorage) AppendAudit(record models.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audit == nil {
+		return nil
+	}
+	return s.audit.append(record)
+}
+
+// Returns the audit records of a customer with a transaction time in [from, to) from the
+// audit file, there are none without one.
+func (s *MemoryStorage) GetAudit(customerID string, from, to time.Time) ([]models.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.audit == nil {
+		return nil, nil
+	}
+	return s.audit.read(customerID, from, to)
+}
+
+// Returns a snapshot with copies of the accounts and the ledgers ordered by customer ID and
+// the unexpired processed transactions ordered by time.
+func (s *MemoryStorage) Snapshot() (*models.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := models.NewSnapshot("")
+	customerIDs := make([]string, 0, len(s.accounts))
+	for customerID := range s.accounts {
+		customerIDs = append(customerIDs, customerID)
+	}
+	sort.Strings(customerIDs)
+	for _, customerID := range customerIDs {
+		snapshot.Accounts = append(snapshot.Accounts, s.accounts[customerID].Clone())
+	}
+
+	customerIDs = customerIDs[:0]
+	for customerID := range s.ledgers {
+		customerIDs = append(customerIDs, customerID)
+	}
+	sort.Strings(customerIDs)
+	for _, customerID := range customerIDs {
+		snapshot.Ledger = append(snapshot.Ledger, s.ledgers[customerID]...)
+	}
+	snapshot.Transactions = append(snapshot.Transactions, s.transactions.all()...)
+	return snapshot, nil
+}
+
+// Restores the accounts, ledgers and processed transactions of a snapshot into an empty storage.
+func (s *MemoryStorage) Restore(snapshot *models.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.accounts) > 0 || len(s.ledgers) > 0 || len(s.transactions.transactions) > 0 {
+		return ErrNotEmpty
+	}
+	for _, account := range snapshot.Accounts {
+		s.accounts[account.CustomerID] = account.Clone()
+	}
+	for _, entry := range snapshot.Ledger {
+		s.appendLedger(entry)
+	}
+	for _, processed := range snapshot.Transactions {
+		s.transactions.add(processed)
+	}
+	return nil
+}
+
+// Runs fn with a storage which buffers its writes and applies them together when fn returns
+// nil, after appending its audit records to the audit file, so a failed write leaves none of
+// them behind. There's nothing to recover after a crash.
+func (s *MemoryStorage) Atomic(fn func(storage Storage) error) error {
+	tx := &memoryTx{MemoryStorage: s, accounts: make(map[string]*models.CustomerAccount)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Closes the audit file if there's one.
+func (s *MemoryStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audit == nil {
+		return nil
+	}
+	err := s.audit.close()
+	s.audit = nil
+	return err
+}
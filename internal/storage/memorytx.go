@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"time"
+	"velocity-limits/internal/models"
+)
+
+// memoryTx struct is the storage of MemoryStorage.Atomic. It returns copies of the stored
+// accounts and buffers the writes, which its reads see, until they're committed.
+type memoryTx struct {
+	*MemoryStorage
+	accounts     map[string]*models.CustomerAccount
+	ledger       []models.LedgerEntry
+	transactions []models.ProcessedTransaction
+	audit        []models.AuditRecord
+}
+
+// Returns the account written in the transaction or a copy of the stored one.
+func (t *memoryTx) GetAccount(customerID string) (*models.CustomerAccount, error) {
+	if account, ok := t.accounts[customerID]; ok {
+		return account, nil
+	}
+	account, err := t.MemoryStorage.GetAccount(customerID)
+	if err != nil || account == nil {
+		return account, err
+	}
+	return account.Clone(), nil
+}
+
+// Buffers the account until the transaction is committed.
+func (t *memoryTx) AddAccount(account *models.CustomerAccount) (*models.CustomerAccount, error) {
+	t.accounts[account.CustomerID] = account
+	return account, nil
+}
+
+// Returns the number of stored accounts and accounts added in the transaction.
+func (t *memoryTx) CountAccounts() (int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	count := len(t.MemoryStorage.accounts)
+	for customerID := range t.accounts {
+		if _, ok := t.MemoryStorage.accounts[customerID]; !ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Buffers the processed transaction until the transaction is committed.
+func (t *memoryTx) AddTransaction(processed models.ProcessedTransaction) error {
+	t.transactions = append(t.transactions, withProcessedAt(processed))
+	return nil
+}
+
+// Checks for duplicate transaction by load ID and customer ID.
+func (t *memoryTx) IsDuplicateTransaction(id, customerID string) (bool, error) {
+	processed, err := t.GetProcessedTransaction(id, customerID)
+	return processed != nil, err
+}
+
+// Returns the processed transaction added in the transaction or the stored one.
+func (t *memoryTx) GetProcessedTransaction(id, customerID string) (*models.ProcessedTransaction, error) {
+	for i := len(t.transactions) - 1; i >= 0; i-- {
+		if processed := t.transactions[i]; processed.ID == id && processed.CustomerID == customerID {
+			return &processed, nil
+		}
+	}
+	return t.MemoryStorage.GetProcessedTransaction(id, customerID)
+}
+
+// Buffers the ledger entries until the transaction is committed.
+func (t *memoryTx) AppendLedger(entries ...models.LedgerEntry) error {
+	t.ledger = append(t.ledger, entries...)
+	return nil
+}
+
+// Returns the stored ledger entries of a customer account followed by the appended ones.
+func (t *memoryTx) GetLedger(customerID string) ([]models.LedgerEntry, error) {
+	entries, err := t.MemoryStorage.GetLedger(customerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range t.ledger {
+		if entry.CustomerID == customerID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Buffers the audit record until the transaction is committed.
+func (t *memoryTx) AppendAudit(record models.AuditRecord) error {
+	t.audit = append(t.audit, record)
+	return nil
+}
+
+// Returns the stored audit records of a customer followed by the appended ones.
+func (t *memoryTx) GetAudit(customerID string, from, to time.Time) ([]models.AuditRecord, error) {
+	records, err := t.MemoryStorage.GetAudit(customerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.MemoryStorage.audit == nil {
+		return records, nil
+	}
+	for _, record := range t.audit {
+		if inAuditRange(record, customerID, from, to) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// Runs fn in the transaction itself.
+func (t *memoryTx) Atomic(fn func(storage Storage) error) error {
+	return fn(t)
+}
+
+// commit appends the audit records to the audit file and applies the other writes only when
+// that succeeds.
+func (t *memoryTx) commit() error {
+	s := t.MemoryStorage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audit != nil && len(t.audit) > 0 {
+		if err := s.audit.append(t.audit...); err != nil {
+			return err
+		}
+	}
+	for customerID, account := range t.accounts {
+		s.accounts[customerID] = account
+	}
+	for _, entry := range t.ledger {
+		s.appendLedger(entry)
+	}
+	for _, processed := range t.transactions {
+		s.transactions.add(processed)
+	}
+	return nil
+}
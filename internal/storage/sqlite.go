@@ -0,0 +1,724 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/pkg/money"
+
+	// Registers the pure-Go "sqlite" database/sql driver.
+	_ "modernc.org/sqlite"
+)
+
+// migration is a schema change applied in a database transaction. Changes of data which
+// depends on the limits are given the limit rules of the config.
+type migration func(tx *sql.Tx, rules []config.LimitRule) error
+
+// migrations contains the schema changes applied in order to a SQLite database.
+// Never edit a released migration, append a new one instead.
+var migrations = []migration{
+	// 1: customer accounts stored as JSON state keyed by customer ID.
+	statements(`CREATE TABLE accounts (
+		customer_id TEXT PRIMARY KEY,
+		state       TEXT NOT NULL
+	)`),
+	// 2: processed transactions for duplicate detection.
+	statements(`CREATE TABLE transactions (
+		id          TEXT NOT NULL,
+		customer_id TEXT NOT NULL,
+		PRIMARY KEY (id, customer_id)
+	)`),
+	// 3: append-only ledger of balance changes per account.
+	statements(`CREATE TABLE ledger (
+		seq             INTEGER PRIMARY KEY AUTOINCREMENT,
+		customer_id     TEXT NOT NULL,
+		transaction_id  TEXT NOT NULL,
+		type            TEXT NOT NULL,
+		amount          INTEGER NOT NULL,
+		currency        TEXT NOT NULL,
+		time            TEXT NOT NULL,
+		counterparty_id TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX ledger_customer_id ON ledger (customer_id, seq);
+	CREATE TRIGGER ledger_no_update BEFORE UPDATE ON ledger BEGIN SELECT RAISE(ABORT, 'ledger is append-only'); END;
+	CREATE TRIGGER ledger_no_delete BEFORE DELETE ON ledger BEGIN SELECT RAISE(ABORT, 'ledger is append-only'); END`),
+	// 4: loads referenced by reversal entries.
+	statements(`ALTER TABLE ledger ADD COLUMN original_id TEXT NOT NULL DEFAULT ''`),
+	// 5: balances per currency, the single balance of earlier versions was always in USD.
+	statements(`UPDATE accounts SET state = json_remove(json_set(state, '$.balances', json_object('USD', json_extract(state, '$.balance'))), '$.balance')
+	WHERE json_type(state, '$.balance') IS NOT NULL`),
+	// 6: append-only audit log of decisions, transaction times in Unix nanoseconds for range queries.
+	statements(`CREATE TABLE audit (
+		seq              INTEGER PRIMARY KEY AUTOINCREMENT,
+		customer_id      TEXT NOT NULL,
+		transaction_time INTEGER NOT NULL,
+		record           TEXT NOT NULL
+	);
+	CREATE INDEX audit_customer_id ON audit (customer_id, transaction_time);
+	CREATE TRIGGER audit_no_update BEFORE UPDATE ON audit BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+	CREATE TRIGGER audit_no_delete BEFORE DELETE ON audit BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`),
+	// 7: transaction times of processed IDs in Unix nanoseconds for their retention. IDs of
+	// earlier versions get the latest audited transaction time, so they're kept a full window.
+	statements(`ALTER TABLE transactions ADD COLUMN time INTEGER NOT NULL DEFAULT 0;
+	UPDATE transactions SET time = (SELECT COALESCE(MAX(transaction_time), 0) FROM audit);
+	CREATE INDEX transactions_time ON transactions (time)`),
+	// 8: payload fingerprints and original responses of processed transactions for replays.
+	statements(`ALTER TABLE transactions ADD COLUMN fingerprint TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN response TEXT`),
+	// 9: limits of the rules by name instead of the daily and weekly limits of earlier versions.
+	migrateLegacyLimits,
+	// 10: processing times of processed IDs in Unix nanoseconds for their retention, which
+	// no longer depends on transaction times. IDs of earlier versions are processed now.
+	statements(`ALTER TABLE transactions ADD COLUMN processed_at INTEGER NOT NULL DEFAULT 0;
+	UPDATE transactions SET processed_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000;
+	CREATE INDEX transactions_processed_at ON transactions (processed_at)`),
+	// 11: base amounts loads charged to the limits with, which reversals give back.
+	statements(`ALTER TABLE ledger ADD COLUMN base_amount INTEGER;
+	ALTER TABLE ledger ADD COLUMN base_currency TEXT`),
+}
+
+// statements returns a migration running the SQL statements.
+func statements(query string) migration {
+	return func(tx *sql.Tx, rules []config.LimitRule) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// legacyLimit struct represents a daily or weekly limit of earlier versions, which held the
+// amount left as a USD string such as "$1234.56" and the daily loads left.
+type legacyLimit struct {
+	Date         time.Time `json:"date"`
+	MaxLoadLimit string    `json:"max_load_limit"`
+	MaxLoad      int       `json:"max_load"`
+}
+
+// migrateLegacyLimits moves the daily and weekly limits of earlier versions to the limits of
+// the daily_amount, daily_count and weekly_amount rules. The usage is what's left subtracted
+// from the thresholds of those rules, which earlier versions built from the MAX_LOAD_* configs,
+// so the config of the upgraded deployment must still have them.
+func migrateLegacyLimits(tx *sql.Tx, rules []config.LimitRule) error {
+	rows, err := tx.Query(`SELECT customer_id, state FROM accounts
+		WHERE json_type(state, '$.daily_limit') = 'object' AND json_type(state, '$.weekly_limit') = 'object'`)
+	if err != nil {
+		return err
+	}
+	states := map[string][]byte{}
+	for rows.Next() {
+		var customerID string
+		var state []byte
+		if err = rows.Scan(&customerID, &state); err != nil {
+			rows.Close()
+			return err
+		}
+		states[customerID] = state
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for customerID, state := range states {
+		limits, err := legacyLimits(state, rules)
+		if err != nil {
+			return fmt.Errorf("converting the limits of account %s: %w", customerID, err)
+		}
+		encoded, err := json.Marshal(limits)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE accounts SET state = json_remove(json_set(state, '$.limits', json(?)), '$.daily_limit', '$.weekly_limit')
+			WHERE customer_id = ?`, string(encoded), customerID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyLimits returns the limits of the rules by name for the account state of earlier versions.
+func legacyLimits(state []byte, rules []config.LimitRule) (map[string]*models.Limit, error) {
+	var account struct {
+		DailyLimit  legacyLimit `json:"daily_limit"`
+		WeeklyLimit legacyLimit `json:"weekly_limit"`
+	}
+	if err := json.Unmarshal(state, &account); err != nil {
+		return nil, err
+	}
+	thresholds := map[string]config.LimitRule{}
+	for _, name := range []string{"daily_amount", "daily_count", "weekly_amount"} {
+		for _, rule := range rules {
+			if rule.Name == name {
+				thresholds[name] = rule
+			}
+		}
+		if _, ok := thresholds[name]; !ok {
+			return nil, fmt.Errorf("no %s rule in the config", name)
+		}
+	}
+
+	dailyUsage, err := legacyUsage(account.DailyLimit, thresholds["daily_amount"])
+	if err != nil {
+		return nil, err
+	}
+	weeklyUsage, err := legacyUsage(account.WeeklyLimit, thresholds["weekly_amount"])
+	if err != nil {
+		return nil, err
+	}
+	dailyCount := thresholds["daily_count"].MaxCount - account.DailyLimit.MaxLoad
+	return map[string]*models.Limit{
+		"daily_amount":  {Start: account.DailyLimit.Date, Amount: dailyUsage, Count: dailyCount},
+		"daily_count":   {Start: account.DailyLimit.Date, Amount: dailyUsage, Count: dailyCount},
+		"weekly_amount": {Start: account.WeeklyLimit.Date, Amount: weeklyUsage},
+	}, nil
+}
+
+// legacyUsage returns the amount used of a limit of earlier versions given the rule of its threshold.
+func legacyUsage(limit legacyLimit, rule config.LimitRule) (money.Money, error) {
+	left, err := money.Parse(limit.MaxLoadLimit)
+	if err != nil {
+		return money.Money{}, err
+	}
+	if left.Currency != rule.MaxAmount.Currency {
+		return money.Money{}, fmt.Errorf("the %s threshold isn't in %s", rule.Name, left.Currency)
+	}
+	return rule.MaxAmount.Sub(left), nil
+}
+
+// SQLiteStorage struct keeps customer accounts and processed transactions in a
+// SQLite database file so that the state survives restarts. The database handle
+// is safe for concurrent use and serializes statements on its single connection.
+// Statements run on the database transaction of Atomic when there's one.
+type SQLiteStorage struct {
+	db       *sql.DB
+	tx       *sql.Tx
+	retained *retainedIDs
+}
+
+// retainedIDs struct tracks the retention of processed transactions with their latest processing
+// time and count, it's shared by the storage and the storages of its database transactions.
+// The mutex is never held while waiting for the database connection.
+type retainedIDs struct {
+	mu        sync.Mutex
+	retention Retention
+	latest    time.Time
+	count     int
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Returns a new SQLite storage struct for the database file at the given path.
+// The file is created if needed and pending schema migrations are applied, the limit
+// rules of the config convert the usage of accounts of earlier versions.
+func NewSQLiteStorage(path string, rules []config.LimitRule) (*SQLiteStorage, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, so share one connection to avoid busy errors.
+	db.SetMaxOpenConns(1)
+
+	if err = migrate(db, rules); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	storage := &SQLiteStorage{db: db, retained: &retainedIDs{}}
+	if err = storage.loadRetained(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+// loadRetained reads the latest processing time and the count of the processed transactions.
+func (s *SQLiteStorage) loadRetained() error {
+	var latest int64
+	var count int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(processed_at), 0), COUNT(*) FROM transactions`).Scan(&latest, &count); err != nil {
+		return err
+	}
+	s.retained.mu.Lock()
+	defer s.retained.mu.Unlock()
+	s.retained.count, s.retained.latest = count, time.Time{}
+	if latest != 0 {
+		s.retained.latest = time.Unix(0, latest).UTC()
+	}
+	return nil
+}
+
+// conn returns the database transaction of Atomic or the database.
+func (s *SQLiteStorage) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// Runs fn with a storage whose statements run in a single database transaction, which is
+// committed when fn returns nil and rolled back otherwise. Other statements wait for it,
+// so fn must only use the given storage.
+func (s *SQLiteStorage) Atomic(fn func(storage Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(&SQLiteStorage{db: s.db, tx: tx, retained: s.retained}); err != nil {
+		tx.Rollback()
+		// The retention may count processed transactions which were rolled back.
+		if loadErr := s.loadRetained(); loadErr != nil {
+			return fmt.Errorf("%w (reading retention: %v)", err, loadErr)
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		s.loadRetained()
+		return err
+	}
+	return nil
+}
+
+// migrate applies all migrations newer than the schema version stored in the database.
+func migrate(db *sql.DB, rules []config.LimitRule) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err = migrations[i](tx, rules); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		if _, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d: %w", i+1, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a customer account by customer ID.
+func (s *SQLiteStorage) GetAccount(customerID string) (*models.CustomerAccount, error) {
+	var state []byte
+	err := s.conn().QueryRow(`SELECT state FROM accounts WHERE customer_id = ?`, customerID).Scan(&state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var account models.CustomerAccount
+	if err = json.Unmarshal(state, &account); err != nil {
+		return nil, fmt.Errorf("decoding account %s: %w", customerID, err)
+	}
+	return &account, nil
+}
+
+// Adds or replaces a customer account with its velocity limits.
+func (s *SQLiteStorage) AddAccount(account *models.CustomerAccount) (*models.CustomerAccount, error) {
+	state, err := json.Marshal(account)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.conn().Exec(`INSERT INTO accounts (customer_id, state) VALUES (?, ?)
+		ON CONFLICT (customer_id) DO UPDATE SET state = excluded.state`, account.CustomerID, string(state))
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Returns the number of customer accounts.
+func (s *SQLiteStorage) CountAccounts() (int, error) {
+	var count int
+	err := s.conn().QueryRow(`SELECT COUNT(*) FROM accounts`).Scan(&count)
+	return count, err
+}
+
+// Sets how long and how many processed transaction IDs are kept for duplicate
+// detection, by default all of them are kept.
+func (s *SQLiteStorage) SetRetention(retention Retention) {
+	s.retained.mu.Lock()
+	defer s.retained.mu.Unlock()
+	s.retained.retention = retention
+}
+
+// Adds a processed transaction with its response for duplicate detection and
+// deletes the expired IDs and the oldest ones above the maximum.
+func (s *SQLiteStorage) AddTransaction(processed models.ProcessedTransaction) error {
+	var response []byte
+	if processed.Response != nil {
+		var err error
+		if response, err = json.Marshal(processed.Response); err != nil {
+			return err
+		}
+	}
+
+	processed = withProcessedAt(processed)
+	result, err := s.conn().Exec(`INSERT OR IGNORE INTO transactions (id, customer_id, time, processed_at, fingerprint, response) VALUES (?, ?, ?, ?, ?, ?)`,
+		processed.ID, processed.CustomerID, processed.Time.UnixNano(), processed.ProcessedAt.UnixNano(), processed.Fingerprint, nullString(response))
+	if err != nil {
+		return err
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	s.retained.mu.Lock()
+	s.retained.count += int(added)
+	if processed.ProcessedAt.After(s.retained.latest) {
+		s.retained.latest = processed.ProcessedAt
+	}
+	retention := s.retained.retention
+	horizon, excess := retention.horizon(s.retained.latest), s.retained.count-retention.MaxIDs
+	s.retained.mu.Unlock()
+
+	if !horizon.IsZero() {
+		if err = s.deleteTransactions(`DELETE FROM transactions WHERE processed_at < ?`, horizon.UnixNano()); err != nil {
+			return err
+		}
+	}
+	if retention.MaxIDs > 0 && excess > 0 {
+		return s.deleteTransactions(`DELETE FROM transactions WHERE rowid IN (SELECT rowid FROM transactions ORDER BY processed_at LIMIT ?)`, excess)
+	}
+	return nil
+}
+
+// deleteTransactions deletes processed transactions and updates their count.
+func (s *SQLiteStorage) deleteTransactions(query string, args ...interface{}) error {
+	result, err := s.conn().Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	s.retained.mu.Lock()
+	s.retained.count -= int(deleted)
+	s.retained.mu.Unlock()
+	return err
+}
+
+// horizon returns the processing time before which processed transactions are expired.
+func (s *SQLiteStorage) horizon() time.Time {
+	s.retained.mu.Lock()
+	defer s.retained.mu.Unlock()
+	return s.retained.retention.horizon(s.retained.latest)
+}
+
+// Checks for duplicate transaction by load ID and customer ID among unexpired IDs.
+func (s *SQLiteStorage) IsDuplicateTransaction(id, customerID string) (bool, error) {
+	processed, err := s.GetProcessedTransaction(id, customerID)
+	return processed != nil, err
+}
+
+// Returns the unexpired processed transaction with the load ID and customer ID or nil.
+func (s *SQLiteStorage) GetProcessedTransaction(id, customerID string) (*models.ProcessedTransaction, error) {
+	notBefore := int64(math.MinInt64)
+	if horizon := s.horizon(); !horizon.IsZero() {
+		notBefore = horizon.UnixNano()
+	}
+
+	processed := models.ProcessedTransaction{ID: id, CustomerID: customerID}
+	var at, processedAt int64
+	var response sql.NullString
+	err := s.conn().QueryRow(`SELECT time, processed_at, fingerprint, response FROM transactions WHERE id = ? AND customer_id = ? AND processed_at >= ?`,
+		id, customerID, notBefore).Scan(&at, &processedAt, &processed.Fingerprint, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = decodeProcessed(&processed, at, processedAt, response); err != nil {
+		return nil, err
+	}
+	return &processed, nil
+}
+
+// decodeProcessed sets the times and the response of a processed transaction from their columns.
+func decodeProcessed(processed *models.ProcessedTransaction, at, processedAt int64, response sql.NullString) error {
+	processed.Time = time.Unix(0, at).UTC()
+	processed.ProcessedAt = time.Unix(0, processedAt).UTC()
+	if !response.Valid {
+		return nil
+	}
+	processed.Response = &models.Response{}
+	if err := json.Unmarshal([]byte(response.String), processed.Response); err != nil {
+		return fmt.Errorf("decoding response of transaction %s: %w", processed.ID, err)
+	}
+	return nil
+}
+
+// nullString returns NULL for empty content.
+func nullString(content []byte) sql.NullString {
+	return sql.NullString{String: string(content), Valid: len(content) > 0}
+}
+
+// Appends entries to the ledgers of their accounts in a single database transaction.
+func (s *SQLiteStorage) AppendLedger(entries ...models.LedgerEntry) error {
+	return s.Atomic(func(storage Storage) error {
+		tx := storage.(*SQLiteStorage).tx
+		for _, entry := range entries {
+			if err := insertLedger(tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertLedger inserts the ledger entry.
+func insertLedger(q querier, entry models.LedgerEntry) error {
+	var baseAmount sql.NullInt64
+	var baseCurrency sql.NullString
+	if entry.BaseAmount != nil {
+		baseAmount = sql.NullInt64{Int64: entry.BaseAmount.Amount, Valid: true}
+		baseCurrency = sql.NullString{String: entry.BaseAmount.Currency, Valid: true}
+	}
+	_, err := q.Exec(`INSERT INTO ledger (`+ledgerColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, entry.CustomerID, entry.TransactionID,
+		entry.Type, entry.Amount.Amount, entry.Amount.Currency, entry.Time.Format(time.RFC3339Nano), entry.CounterpartyID, entry.OriginalID,
+		baseAmount, baseCurrency)
+	return err
+}
+
+// Returns the ledger entries of a customer account in the order they were appended.
+func (s *SQLiteStorage) GetLedger(customerID string) ([]models.LedgerEntry, error) {
+	rows, err := s.conn().Query(`SELECT `+ledgerColumns+` FROM ledger WHERE customer_id = ? ORDER BY seq`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLedger(rows)
+}
+
+// ledgerColumns are the columns of a ledger entry read by scanLedger.
+const ledgerColumns = `customer_id, transaction_id, type, amount, currency, time, counterparty_id, original_id, base_amount, base_currency`
+
+// scanLedger reads the ledger entries of the rows and closes them.
+func scanLedger(rows *sql.Rows) ([]models.LedgerEntry, error) {
+	defer rows.Close()
+	var entries []models.LedgerEntry
+	for rows.Next() {
+		var entry models.LedgerEntry
+		var entryTime string
+		var baseAmount sql.NullInt64
+		var baseCurrency sql.NullString
+		err := rows.Scan(&entry.CustomerID, &entry.TransactionID, &entry.Type, &entry.Amount.Amount, &entry.Amount.Currency, &entryTime,
+			&entry.CounterpartyID, &entry.OriginalID, &baseAmount, &baseCurrency)
+		if err != nil {
+			return nil, err
+		}
+		if baseAmount.Valid {
+			base := money.New(baseAmount.Int64, baseCurrency.String)
+			entry.BaseAmount = &base
+		}
+		if entry.Time, err = time.Parse(time.RFC3339Nano, entryTime); err != nil {
+			return nil, fmt.Errorf("decoding ledger entry time: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Appends a record to the audit log.
+func (s *SQLiteStorage) AppendAudit(record models.AuditRecord) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().Exec(`INSERT INTO audit (customer_id, transaction_time, record) VALUES (?, ?, ?)`,
+		record.Transaction.CustomerID, record.Transaction.Time.UnixNano(), string(encoded))
+	return err
+}
+
+// Returns the audit records of a customer with a transaction time in [from, to).
+func (s *SQLiteStorage) GetAudit(customerID string, from, to time.Time) ([]models.AuditRecord, error) {
+	query, args := `SELECT record FROM audit WHERE customer_id = ?`, []interface{}{customerID}
+	if !from.IsZero() {
+		query, args = query+` AND transaction_time >= ?`, append(args, from.UnixNano())
+	}
+	if !to.IsZero() {
+		query, args = query+` AND transaction_time < ?`, append(args, to.UnixNano())
+	}
+	rows, err := s.conn().Query(query+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AuditRecord
+	for rows.Next() {
+		var encoded []byte
+		if err = rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		var record models.AuditRecord
+		if err = json.Unmarshal(encoded, &record); err != nil {
+			return nil, fmt.Errorf("decoding audit record: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Returns a snapshot with the accounts and the ledgers ordered by customer ID and the
+// unexpired processed transactions ordered by time, read in a single database transaction.
+func (s *SQLiteStorage) Snapshot() (*models.Snapshot, error) {
+	notBefore := int64(math.MinInt64)
+	if horizon := s.horizon(); !horizon.IsZero() {
+		notBefore = horizon.UnixNano()
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	snapshot := models.NewSnapshot("")
+
+	rows, err := tx.Query(`SELECT customer_id, state FROM accounts ORDER BY customer_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var customerID string
+		var state []byte
+		if err = rows.Scan(&customerID, &state); err != nil {
+			return nil, err
+		}
+		account := &models.CustomerAccount{}
+		if err = json.Unmarshal(state, account); err != nil {
+			return nil, fmt.Errorf("decoding account %s: %w", customerID, err)
+		}
+		snapshot.Accounts = append(snapshot.Accounts, account)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if rows, err = tx.Query(`SELECT ` + ledgerColumns + ` FROM ledger ORDER BY customer_id, seq`); err != nil {
+		return nil, err
+	}
+	entries, err := scanLedger(rows)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Ledger = append(snapshot.Ledger, entries...)
+
+	rows, err = tx.Query(`SELECT id, customer_id, time, processed_at, fingerprint, response FROM transactions
+		WHERE processed_at >= ? ORDER BY time, customer_id, id`, notBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var processed models.ProcessedTransaction
+		var at, processedAt int64
+		var response sql.NullString
+		if err = rows.Scan(&processed.ID, &processed.CustomerID, &at, &processedAt, &processed.Fingerprint, &response); err != nil {
+			return nil, err
+		}
+		if err = decodeProcessed(&processed, at, processedAt, response); err != nil {
+			return nil, err
+		}
+		snapshot.Transactions = append(snapshot.Transactions, processed)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snapshot, tx.Commit()
+}
+
+// Restores the accounts, ledgers and processed transactions of a snapshot into an empty
+// database in a single database transaction.
+func (s *SQLiteStorage) Restore(snapshot *models.Snapshot) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rows int
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM accounts) + (SELECT COUNT(*) FROM ledger) + (SELECT COUNT(*) FROM transactions)`).Scan(&rows)
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return ErrNotEmpty
+	}
+
+	for _, account := range snapshot.Accounts {
+		state, err := json.Marshal(account)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`INSERT INTO accounts (customer_id, state) VALUES (?, ?)`, account.CustomerID, string(state)); err != nil {
+			return err
+		}
+	}
+	for _, entry := range snapshot.Ledger {
+		if err = insertLedger(tx, entry); err != nil {
+			return err
+		}
+	}
+	latest := time.Time{}
+	for _, processed := range snapshot.Transactions {
+		var response []byte
+		if processed.Response != nil {
+			if response, err = json.Marshal(processed.Response); err != nil {
+				return err
+			}
+		}
+		processed = withProcessedAt(processed)
+		_, err = tx.Exec(`INSERT INTO transactions (id, customer_id, time, processed_at, fingerprint, response) VALUES (?, ?, ?, ?, ?, ?)`,
+			processed.ID, processed.CustomerID, processed.Time.UnixNano(), processed.ProcessedAt.UnixNano(), processed.Fingerprint, nullString(response))
+		if err != nil {
+			return err
+		}
+		if processed.ProcessedAt.After(latest) {
+			latest = processed.ProcessedAt
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.retained.mu.Lock()
+	defer s.retained.mu.Unlock()
+	s.retained.count, s.retained.latest = len(snapshot.Transactions), latest
+	return nil
+}
+
+// Closes the underlying database.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
@@ -1,50 +1,96 @@
-// Package storage defines a Storage struct for storing customer accounts
-// and transactions to detect duplication.
+// Package storage defines a Storage interface for storing customer accounts
+// and transactions to detect duplication, with in-memory and SQLite implementations.
 
-// Note that for abstraction Storage struct fields start with lowercase letters
+// Note that for abstraction storage struct fields start with lowercase letters
 // and because of that it cannot be exported.
 package storage
 
-import "velocity-limits/internal/models"
+import (
+	"errors"
+	"fmt"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/pkg/util"
+)
 
-// Storage struct represents customer accounts and processed transactions.
-// Fields can't be exported out of package.
-type Storage struct {
-	accounts     map[string]*models.CustomerAccount
-	transactions map[string]struct{}
-}
+// Storage types which can be selected with the STORAGE config.
+const (
+	TypeMemory = "memory"
+	TypeSQLite = "sqlite"
+)
 
-// Returns a new Storage struct with default values
-func NewStorage() *Storage {
-	return &Storage{
-		accounts:     make(map[string]*models.CustomerAccount),
-		transactions: make(map[string]struct{}),
-	}
-}
+// ErrNotEmpty is returned when a snapshot is restored into a storage which has state already.
+var ErrNotEmpty = errors.New("storage isn't empty")
 
-// Returns a customer account by customer ID.
-func (s *Storage) GetAccount(customerID string) *models.CustomerAccount {
-	if acc, ok := s.accounts[customerID]; ok {
-		return acc
-	}
-	return nil
-}
-
-// Add customer account to the storage with its velocity limits.
-func (s *Storage) AddAccount(account *models.CustomerAccount) *models.CustomerAccount {
-	s.accounts[account.CustomerID] = account
-	return account
-}
+// ErrNoAuditFile is returned when the in-memory storage is opened without an AUDIT_FILE.
+var ErrNoAuditFile = errors.New("the in-memory storage requires an AUDIT_FILE")
 
-// Adds transaction info with (Load ID + Customer ID) key for duplicate detection.
-func (s *Storage) AddTransaction(id, customerID string) {
-	s.transactions[id+customerID] = struct{}{}
+// Storage interface represents customer accounts, their ledgers, processed transactions
+// and the audit log of decisions.
+// Accounts returned by GetAccount must be added again with AddAccount after
+// changing them, so that persistent implementations can save the new state.
+// Implementations are safe for concurrent use, while the read, change and add of a
+// customer account must be done by one goroutine at a time.
+type Storage interface {
+	// Returns a customer account by customer ID or nil if it doesn't exist.
+	GetAccount(customerID string) (*models.CustomerAccount, error)
+	// Adds or replaces a customer account with its velocity limits.
+	AddAccount(account *models.CustomerAccount) (*models.CustomerAccount, error)
+	// Returns the number of customer accounts.
+	CountAccounts() (int, error)
+	// Adds a processed transaction with its response for duplicate detection. The processing
+	// time, now when it has none, decides when the ID expires with the retention of the storage.
+	AddTransaction(processed models.ProcessedTransaction) error
+	// Checks for duplicate transaction by load ID and customer ID among unexpired IDs.
+	IsDuplicateTransaction(id, customerID string) (bool, error)
+	// Returns the unexpired processed transaction with the load ID and customer ID or nil.
+	GetProcessedTransaction(id, customerID string) (*models.ProcessedTransaction, error)
+	// Appends entries to the ledgers of their accounts, all of them or none.
+	// Ledger entries are never changed or removed.
+	AppendLedger(entries ...models.LedgerEntry) error
+	// Returns the ledger entries of a customer account in the order they were appended.
+	GetLedger(customerID string) ([]models.LedgerEntry, error)
+	// Appends a record to the audit log, records are never changed or removed.
+	AppendAudit(record models.AuditRecord) error
+	// Returns the audit records of a customer with a transaction time in [from, to) in the
+	// order they were appended. A zero from or to leaves that end of the range open.
+	GetAudit(customerID string, from, to time.Time) ([]models.AuditRecord, error)
+	// Returns a consistent snapshot of the accounts, ledgers and unexpired processed
+	// transactions, which must not change while it's taken.
+	Snapshot() (*models.Snapshot, error)
+	// Restores the state of a snapshot into an empty storage, the audit log isn't checked.
+	// Returns ErrNotEmpty when the storage has accounts, ledger entries or processed transactions.
+	Restore(snapshot *models.Snapshot) error
+	// Runs fn with a storage whose writes are applied together if fn returns nil and
+	// discarded otherwise. Other writes may wait for fn, so it must only use the given storage.
+	Atomic(fn func(storage Storage) error) error
+	// Releases any resources held by the storage.
+	Close() error
 }
 
-// Checks for duplicate transaction by load ID and customer ID.
-func (s *Storage) IsDuplicateTransaction(id, customerID string) bool {
-	if _, ok := s.transactions[id+customerID]; ok {
-		return true
+// Open returns the storage selected by the STORAGE config with the DUPLICATE_* retention.
+// The in-memory storage requires an AUDIT_FILE, files are resolved relative to the given path.
+func Open(config *config.Configuration, path string) (Storage, error) {
+	retention := Retention{Window: config.DuplicateRetention, MaxIDs: config.DuplicateMaxIDs, MaxResponses: config.DuplicateMaxResponses}
+	switch config.Storage {
+	case "", TypeMemory:
+		memoryStorage := NewStorage()
+		memoryStorage.SetRetention(retention)
+		if config.AuditFile == "" {
+			return nil, ErrNoAuditFile
+		}
+		if err := memoryStorage.SetAuditFile(util.ResolvePath(path, config.AuditFile)); err != nil {
+			return nil, err
+		}
+		return memoryStorage, nil
+	case TypeSQLite:
+		sqliteStorage, err := NewSQLiteStorage(util.ResolvePath(path, config.SQLiteFile), config.Limits)
+		if err != nil {
+			return nil, err
+		}
+		sqliteStorage.SetRetention(retention)
+		return sqliteStorage, nil
 	}
-	return false
+	return nil, fmt.Errorf("unknown storage type %q", config.Storage)
 }
@@ -0,0 +1,95 @@
+// Package fx converts money amounts between currencies with exchange rates from a
+// pluggable provider. Rates are exact rational numbers, so a conversion rounds only once.
+package fx
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"velocity-limits/pkg/money"
+)
+
+// ErrNoRate is returned when a provider has no exchange rate between two currencies.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Provider interface returns the exchange rate between two currencies, that is the
+// amount of the to currency one unit of the from currency is worth.
+type Provider interface {
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// StaticProvider struct returns exchange rates from a fixed table, which makes it usable
+// offline. Rates holds the value of one unit of every currency in the Base currency.
+type StaticProvider struct {
+	Base  string
+	Rates map[string]*big.Rat
+}
+
+// Returns a new static provider from rates given as decimal strings, e.g. "1.0850",
+// of one unit of every currency in the base currency.
+// Returns an error for unknown currencies and rates which aren't positive numbers.
+func NewStaticProvider(base string, rates map[string]string) (*StaticProvider, error) {
+	base = strings.ToUpper(base)
+	if !money.IsCurrency(base) {
+		return nil, fmt.Errorf("%w: %q", money.ErrUnknownCurrency, base)
+	}
+	provider := &StaticProvider{Base: base, Rates: make(map[string]*big.Rat, len(rates))}
+	for currency, value := range rates {
+		currency = strings.ToUpper(currency)
+		if !money.IsCurrency(currency) {
+			return nil, fmt.Errorf("%w: %q", money.ErrUnknownCurrency, currency)
+		}
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate of %s: %q", currency, value)
+		}
+		provider.Rates[currency] = rate
+	}
+	return provider, nil
+}
+
+// Returns the exchange rate between two currencies of the table, crossing through the base currency.
+func (p *StaticProvider) Rate(from, to string) (*big.Rat, error) {
+	fromRate, fromOK := p.rate(from)
+	toRate, toOK := p.rate(to)
+	if !fromOK || !toOK {
+		return nil, fmt.Errorf("%w from %s to %s", ErrNoRate, from, to)
+	}
+	return new(big.Rat).Quo(fromRate, toRate), nil
+}
+
+// rate returns the value of one unit of the currency in the base currency.
+func (p *StaticProvider) rate(currency string) (*big.Rat, bool) {
+	if currency == p.Base {
+		return big.NewRat(1, 1), true
+	}
+	rate, ok := p.Rates[currency]
+	return rate, ok
+}
+
+// Convert returns the amount in the to currency, rounded half away from zero to minor units.
+// Amounts already in the to currency are returned as they are, even without a provider.
+func Convert(provider Provider, amount money.Money, to string) (money.Money, error) {
+	if amount.Currency == to {
+		return amount, nil
+	}
+	if provider == nil {
+		return money.Money{}, fmt.Errorf("%w from %s to %s", ErrNoRate, amount.Currency, to)
+	}
+	rate, err := provider.Rate(amount.Currency, to)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Amount), rate)
+	quotient, remainder := new(big.Int).QuoRem(converted.Num(), converted.Denom(), new(big.Int))
+	if remainder.Abs(remainder).Lsh(remainder, 1).Cmp(converted.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(converted.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return money.Money{}, fmt.Errorf("%w: %s in %s", money.ErrOverflow, amount, to)
+	}
+	return money.New(quotient.Int64(), to), nil
+}
@@ -0,0 +1,266 @@
+// Package money implements a fixed-point money type. Amounts are stored as
+// integer minor units (cents) together with an ISO 4217 currency code so that
+// velocity limits never accumulate floating point rounding errors.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts which don't carry a currency symbol or code.
+const DefaultCurrency = "USD"
+
+// minorUnits is the number of minor units (cents) in one major unit (dollar).
+const minorUnits = 100
+
+var (
+	// ErrInvalidAmount is returned when an amount can't be parsed.
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrTooManyDecimals is returned when an amount has more than two decimals.
+	ErrTooManyDecimals = errors.New("amount has more than two decimals")
+	// ErrUnknownCurrency is returned when an amount has an unsupported currency symbol or code.
+	ErrUnknownCurrency = errors.New("unknown currency")
+	// ErrOverflow is returned when an amount doesn't fit into minor units.
+	ErrOverflow = errors.New("amount is out of range")
+)
+
+// symbols maps supported currency symbols to their ISO 4217 codes.
+var symbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+}
+
+// currencies contains the supported ISO 4217 currency codes, all of them have two decimals.
+var currencies = map[string]bool{
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"CAD": true,
+	"AUD": true,
+	"CHF": true,
+}
+
+// IsCurrency reports whether the ISO 4217 currency code is supported.
+func IsCurrency(code string) bool {
+	return currencies[code]
+}
+
+// Money struct represents an amount in minor units and its currency code.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// Returns a new Money struct from minor units.
+func New(amount int64, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: currency,
+	}
+}
+
+// Returns a new Money struct from whole major units, e.g. 5000 dollars.
+func FromMajor(amount int64, currency string) Money {
+	return New(amount*minorUnits, currency)
+}
+
+// Parse parses an amount such as "$1,234.56", "-$12.50", "€100", "EUR 100.00", "100.00 CAD"
+// or "100" into a Money struct. Amounts without a currency symbol or code are in DefaultCurrency.
+// Thousands separators must group exactly three digits and at most two decimals are allowed.
+func Parse(s string) (Money, error) {
+	value := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	}
+
+	currency, value, err := splitCurrency(value)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", err, s)
+	}
+	// Accept the sign after the currency as well, e.g. "$-12.50".
+	if !negative && strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	}
+	if value == "" {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	whole, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		whole, fraction = value[:i], value[i+1:]
+	}
+	whole, err = stripThousandsSeparators(whole)
+	if err != nil || whole == "" || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(fraction) > 2 {
+		return Money{}, fmt.Errorf("%w: %q", ErrTooManyDecimals, s)
+	}
+
+	var amount int64
+	for _, digit := range whole + fraction + strings.Repeat("0", 2-len(fraction)) {
+		if amount > (math.MaxInt64-int64(digit-'0'))/10 {
+			return Money{}, fmt.Errorf("%w: %q", ErrOverflow, s)
+		}
+		amount = amount*10 + int64(digit-'0')
+	}
+	if negative {
+		amount = -amount
+	}
+	return New(amount, currency), nil
+}
+
+// splitCurrency returns the currency of an amount given by a leading symbol, or by a leading
+// or trailing ISO 4217 code, and the amount without it.
+func splitCurrency(value string) (string, string, error) {
+	for symbol, code := range symbols {
+		if strings.HasPrefix(value, symbol) {
+			return code, value[len(symbol):], nil
+		}
+	}
+
+	code := ""
+	if letters := len(value) - len(strings.TrimLeftFunc(value, isLetter)); letters > 0 {
+		code, value = value[:letters], strings.TrimSpace(value[letters:])
+	} else if letters = len(value) - len(strings.TrimRightFunc(value, isLetter)); letters > 0 {
+		code, value = value[len(value)-letters:], strings.TrimSpace(value[:len(value)-letters])
+	}
+	switch {
+	case code != "":
+		code = strings.ToUpper(code)
+		if !currencies[code] {
+			return "", "", ErrUnknownCurrency
+		}
+		return code, value, nil
+	case value != "" && strings.IndexByte("0123456789.,-", value[0]) < 0:
+		return "", "", ErrUnknownCurrency
+	}
+	return DefaultCurrency, value, nil
+}
+
+// isLetter reports whether r is an ASCII letter.
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// stripThousandsSeparators removes commas from the whole part of an amount
+// and validates that every group after the first one has three digits.
+func stripThousandsSeparators(whole string) (string, error) {
+	if !strings.Contains(whole, ",") {
+		if !isDigits(whole) {
+			return "", ErrInvalidAmount
+		}
+		return whole, nil
+	}
+	groups := strings.Split(whole, ",")
+	for i, group := range groups {
+		if !isDigits(group) || group == "" || len(group) > 3 || (i > 0 && len(group) != 3) {
+			return "", ErrInvalidAmount
+		}
+	}
+	return strings.Join(groups, ""), nil
+}
+
+// isDigits reports whether s contains only ASCII digits.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Add returns the sum of two amounts. Both amounts must share the same currency.
+func (m Money) Add(other Money) Money {
+	m.mustMatch(other)
+	return New(m.Amount+other.Amount, m.Currency)
+}
+
+// Sub returns the difference of two amounts. Both amounts must share the same currency.
+func (m Money) Sub(other Money) Money {
+	m.mustMatch(other)
+	return New(m.Amount-other.Amount, m.Currency)
+}
+
+// Cmp compares two amounts and returns -1, 0 or +1.
+// Both amounts must share the same currency.
+func (m Money) Cmp(other Money) int {
+	m.mustMatch(other)
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is below zero.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// IsPositive reports whether the amount is above zero.
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Major returns the amount in major units, e.g. 1234.56 dollars. It's only meant for
+// reporting since floating point amounts can't be added up exactly.
+func (m Money) Major() float64 {
+	return float64(m.Amount) / minorUnits
+}
+
+// String formats the amount with its currency symbol, e.g. "$1234.56", or with its
+// code when it has no symbol, e.g. "1234.56 CAD".
+func (m Money) String() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	for symbol, code := range symbols {
+		if code == m.Currency {
+			return fmt.Sprintf("%s%s%d.%02d", sign, symbol, amount/minorUnits, amount%minorUnits)
+		}
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/minorUnits, amount%minorUnits, m.Currency)
+}
+
+// MarshalJSON encodes the amount as a string, e.g. "$1234.56".
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+// UnmarshalJSON decodes an amount from a string, e.g. "$1234.56".
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// mustMatch panics when two amounts with different currencies are combined,
+// since that is always a programming error rather than bad input.
+func (m Money) mustMatch(other Money) {
+	if m.Currency != other.Currency {
+		panic(fmt.Sprintf("money: currency mismatch %s != %s", m.Currency, other.Currency))
+	}
+}
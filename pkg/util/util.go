@@ -3,15 +3,28 @@
 package util
 
 import (
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 	"velocity-limits/config"
 )
 
+// StandardStream is the file name which selects stdin for input and stdout for output.
+const StandardStream = "-"
+
+// ResolvePath returns the file path relative to the given path unless it's absolute.
+func ResolvePath(path, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(path, file)
+}
+
 // OpenFile tries to open an input file from the given path.
 func OpenFile(config *config.Configuration, path string) (*os.File, error) {
-	input, err := os.Open(path + config.InputFile)
+	input, err := os.Open(ResolvePath(path, config.InputFile))
 	if err != nil {
 		return nil, err
 	}
@@ -20,19 +33,109 @@ func OpenFile(config *config.Configuration, path string) (*os.File, error) {
 
 // CreateFile tries to create an output file from the given path.
 func CreateFile(config *config.Configuration, path string) *os.File {
-	output, err := os.Create(path + config.OutputFile)
+	output, err := os.Create(ResolvePath(path, config.OutputFile))
 	if err != nil {
 		log.Fatal("Error - Unable to open file: ", err)
 	}
 	return output
 }
 
+// OpenInput opens the input file from the given path, or stdin when the input file is "-".
+func OpenInput(config *config.Configuration, path string) (io.ReadCloser, error) {
+	if config.InputFile == StandardStream {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return OpenFile(config, path)
+}
+
+// CreateOutput creates the output file from the given path, or uses stdout when the output file is "-".
+func CreateOutput(config *config.Configuration, path string) (io.WriteCloser, error) {
+	if config.OutputFile == StandardStream {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(ResolvePath(path, config.OutputFile))
+}
+
+// CreateDeadLetters creates the dead-letter file from the given path, or returns nil
+// when no dead-letter file is configured.
+func CreateDeadLetters(config *config.Configuration, path string) (io.WriteCloser, error) {
+	if config.DeadLetterFile == "" {
+		return nil, nil
+	}
+	if config.DeadLetterFile == StandardStream {
+		return nopWriteCloser{os.Stderr}, nil
+	}
+	return os.Create(ResolvePath(path, config.DeadLetterFile))
+}
+
+// CreateMetricsFile creates the metrics file from the given path, or returns nil when no
+// metrics file is configured.
+func CreateMetricsFile(config *config.Configuration, path string) (io.WriteCloser, error) {
+	if config.MetricsFile == "" {
+		return nil, nil
+	}
+	if config.MetricsFile == StandardStream {
+		return nopWriteCloser{os.Stderr}, nil
+	}
+	return os.Create(ResolvePath(path, config.MetricsFile))
+}
+
+// nopWriteCloser wraps a writer which must not be closed, such as stdout.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close is a no-op.
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Returns beginning of the hour in UTC format.
+func GetBeginningOfTheHour(d time.Time) time.Time {
+	return GetBeginningOfTheHourIn(d, time.UTC)
+}
+
 // Returns beginning of the day in UTC format.
 func GetBeginningOfTheDay(d time.Time) time.Time {
-	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	return GetBeginningOfTheDayIn(d, time.UTC)
 }
 
 // Returns beginning of the week in UTC format. Week starts from Monday.
 func GetBeginningOfTheWeek(d time.Time) time.Time {
-	return time.Date(d.Year(), d.Month(), d.Day()+int(time.Monday-d.Weekday()), 0, 0, 0, 0, time.UTC)
+	return GetBeginningOfTheWeekIn(d, time.UTC, time.Monday)
+}
+
+// Returns beginning of the month in UTC format.
+func GetBeginningOfTheMonth(d time.Time) time.Time {
+	return GetBeginningOfTheMonthIn(d, time.UTC)
+}
+
+// Returns beginning of the hour in the given location. The minutes and seconds are
+// subtracted instead of rebuilding the date so that the repeated hour at the end of
+// daylight saving time isn't mapped to its first occurrence.
+func GetBeginningOfTheHourIn(d time.Time, loc *time.Location) time.Time {
+	local := d.In(loc)
+	return local.Add(-time.Duration(local.Minute())*time.Minute -
+		time.Duration(local.Second())*time.Second -
+		time.Duration(local.Nanosecond()))
+}
+
+// Returns beginning of the day in the given location. Days are counted in calendar
+// days, so they last 23 or 25 hours when daylight saving time starts or ends.
+func GetBeginningOfTheDayIn(d time.Time, loc *time.Location) time.Time {
+	local := d.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// Returns beginning of the week in the given location for weeks starting on weekStart.
+func GetBeginningOfTheWeekIn(d time.Time, loc *time.Location, weekStart time.Weekday) time.Time {
+	local := d.In(loc)
+	daysSinceWeekStart := (int(local.Weekday()) - int(weekStart) + 7) % 7
+	return time.Date(local.Year(), local.Month(), local.Day()-daysSinceWeekStart, 0, 0, 0, 0, loc)
+}
+
+// Returns beginning of the month in the given location.
+func GetBeginningOfTheMonthIn(d time.Time, loc *time.Location) time.Time {
+	local := d.In(loc)
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
 }
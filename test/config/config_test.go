@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), config.FileName)
+	content := "[config]\nINPUT_FILE = \"input.txt\"\nOUTPUT_FORMAT = \"legacy\"\nMAX_LOAD_LIMIT_PER_DAY = 1000\nMAX_LOAD_PER_DAY = 2\nMAX_LOAD_LIMIT_PER_WEEK = 4000\n"
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+
+	t.Run("overrides configs with environment variables and then with options", func(t *testing.T) {
+		t.Setenv("VELOCITY_INPUT_FILE", "env.txt")
+		t.Setenv("VELOCITY_OUTPUT_FORMAT", "detailed")
+		t.Setenv("VELOCITY_LATE_TOLERANCE", "48h")
+		configuration, err := config.LoadConfigFile(file, config.Options{Settings: map[string]string{"INPUT_FILE": "flag.txt"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "flag.txt", configuration.InputFile)
+		assert.Equal(t, config.OutputFormatDetailed, configuration.OutputFormat)
+		assert.Equal(t, "48h0m0s", configuration.LateTolerance.String())
+	})
+
+	t.Run("overrides limit thresholds and the version", func(t *testing.T) {
+		base, err := config.LoadConfigFile(file, config.Options{})
+		assert.NoError(t, err)
+		configuration, err := config.LoadConfigFile(file, config.Options{Limits: []config.LimitOverride{{Name: "weekly_amount", Threshold: "$1,500.00"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(1500, "USD"), configuration.Limits[2].MaxAmount)
+		assert.NotEqual(t, base.Version, configuration.Version)
+	})
+
+	t.Run("returns errors instead of exiting", func(t *testing.T) {
+		_, err := config.LoadConfigFile(file, config.Options{Limits: []config.LimitOverride{{Name: "unknown", Threshold: "1"}}})
+		assert.EqualError(t, err, `invalid limit overrides: override of unknown limit rule "unknown"`)
+		_, err = config.LoadConfigFile(file, config.Options{Settings: map[string]string{"OUTPUT_FORMAT": "xml"}})
+		assert.EqualError(t, err, `unknown output format "xml"`)
+		_, err = config.LoadConfigFile(filepath.Join(t.TempDir(), config.FileName), config.Options{})
+		assert.Error(t, err)
+	})
+}
+
+func TestFindConfigFile(t *testing.T) {
+	t.Run("finds the config directory of the closest parent", func(t *testing.T) {
+		root, err := filepath.Abs("../..")
+		assert.NoError(t, err)
+		file, err := config.FindConfigFile(".")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(root, "config", config.FileName), file)
+	})
+
+	t.Run("returns an error without a config directory", func(t *testing.T) {
+		_, err := config.FindConfigFile(t.TempDir())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchange(t *testing.T) {
+	t.Run("loads the static exchange rates declared in config.toml", func(t *testing.T) {
+		configuration := config.LoadConfig("../../config/")
+		assert.Equal(t, "USD", configuration.BaseCurrency)
+
+		rules, err := configuration.LimitRulesFor("1", config.Profile{})
+		assert.NoError(t, err)
+		converted, err := rules[0].Exchange.Convert(money.FromMajor(100, "EUR"))
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(10850, "USD"), converted)
+	})
+
+	t.Run("evaluates limits in the configured base currency", func(t *testing.T) {
+		path := t.TempDir() + "/"
+		content := "[config]\nBASE_CURRENCY = \"eur\"\nFX_RATES_FILE = \"rates.toml\"\n\n" +
+			"[[config.LIMITS]]\nNAME = \"daily_amount\"\nWINDOW = \"day\"\nMETRIC = \"amount\"\nTHRESHOLD = \"€5,000.00\"\n"
+		assert.NoError(t, os.WriteFile(path+"config.toml", []byte(content), 0o644))
+		assert.NoError(t, os.WriteFile(path+"rates.toml", []byte("BASE = \"USD\"\n[RATES]\nEUR = 1.25\n"), 0o644))
+
+		configuration := config.LoadConfig(path)
+		rules, err := configuration.LimitRulesFor("1", config.Profile{})
+		assert.NoError(t, err)
+		assert.Equal(t, "EUR", rules[0].Exchange.Base)
+		converted, err := rules[0].Exchange.Convert(money.FromMajor(100, "USD"))
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(80, "EUR"), converted)
+	})
+
+	t.Run("returns an error for thresholds which aren't in the base currency", func(t *testing.T) {
+		rule, err := config.ParseLimitRule(config.LimitRule{Name: "daily_amount", Window: config.WindowDay, Metric: config.MetricAmount, Threshold: "$5,000.00"})
+		assert.NoError(t, err)
+		configuration := config.Config{BaseCurrency: "EUR", Limits: []config.LimitRule{rule}}
+		_, err = configuration.LimitRulesFor("1", config.Profile{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimitRule(t *testing.T) {
+	t.Run("parses amount thresholds into money", func(t *testing.T) {
+		rule, err := config.ParseLimitRule(config.LimitRule{Name: "daily_amount", Window: config.WindowDay, Metric: config.MetricAmount, Threshold: "$5,000.00"})
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(5000, "USD"), rule.MaxAmount)
+	})
+
+	t.Run("parses count thresholds into integers", func(t *testing.T) {
+		rule, err := config.ParseLimitRule(config.LimitRule{Name: "rolling_count", Window: config.WindowRolling, Hours: 24, Metric: config.MetricCount, Threshold: "3"})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, rule.MaxCount)
+		assert.True(t, rule.IsRolling())
+	})
+
+	t.Run("applies rules without a type to loads", func(t *testing.T) {
+		load := config.LimitRule{Name: "daily_amount"}
+		withdrawal := config.LimitRule{Name: "daily_withdrawal_amount", Type: config.TypeWithdrawal}
+		assert.True(t, load.AppliesTo(""))
+		assert.True(t, load.AppliesTo(config.TypeLoad))
+		assert.False(t, load.AppliesTo(config.TypeWithdrawal))
+		assert.True(t, withdrawal.AppliesTo(config.TypeWithdrawal))
+		assert.False(t, withdrawal.AppliesTo(config.TypeTransfer))
+	})
+
+	t.Run("returns an error for invalid rules", func(t *testing.T) {
+		invalidRules := []config.LimitRule{
+			{Window: config.WindowDay, Metric: config.MetricCount, Threshold: "3"},
+			{Name: "yearly", Window: "year", Metric: config.MetricCount, Threshold: "3"},
+			{Name: "rolling", Window: config.WindowRolling, Metric: config.MetricCount, Threshold: "3"},
+			{Name: "daily_average", Window: config.WindowDay, Metric: "average", Threshold: "3"},
+			{Name: "daily_count", Window: config.WindowDay, Metric: config.MetricCount, Threshold: "three"},
+			{Name: "daily_amount", Window: config.WindowDay, Metric: config.MetricAmount, Threshold: "-$5"},
+			{Name: "daily_refund", Type: "refund", Window: config.WindowDay, Metric: config.MetricCount, Threshold: "3"},
+		}
+		for _, rule := range invalidRules {
+			_, err := config.ParseLimitRule(rule)
+			assert.Error(t, err, rule.Name)
+		}
+	})
+}
+
+func TestLoadConfigLimits(t *testing.T) {
+	t.Run("loads limit rules declared in config.toml", func(t *testing.T) {
+		configuration := config.LoadConfig("../../config/")
+		assert.Len(t, configuration.Limits, 6)
+		assert.Equal(t, "daily_amount", configuration.Limits[0].Name)
+		assert.Equal(t, money.FromMajor(5000, "USD"), configuration.Limits[0].MaxAmount)
+		assert.Equal(t, 3, configuration.Limits[1].MaxCount)
+		assert.Equal(t, money.FromMajor(20000, "USD"), configuration.Limits[2].MaxAmount)
+		assert.True(t, configuration.Limits[3].AppliesTo(config.TypeWithdrawal))
+		assert.True(t, configuration.Limits[5].AppliesTo(config.TypeTransfer))
+	})
+
+	t.Run("identifies the content of the config files with a version", func(t *testing.T) {
+		path := t.TempDir() + "/"
+		assert.NoError(t, os.WriteFile(path+"config.toml", []byte("[config]\nMAX_LOAD_PER_DAY = 2\n"), 0o644))
+		version := config.LoadConfig(path).Version
+		assert.Len(t, version, 12)
+		assert.Equal(t, version, config.LoadConfig(path).Version)
+
+		assert.NoError(t, os.WriteFile(path+"config.toml", []byte("[config]\nMAX_LOAD_PER_DAY = 3\n"), 0o644))
+		assert.NotEqual(t, version, config.LoadConfig(path).Version)
+	})
+
+	t.Run("builds the default rules from the original limit configs", func(t *testing.T) {
+		path := t.TempDir() + "/"
+		content := "[config]\nMAX_LOAD_LIMIT_PER_DAY = 1000\nMAX_LOAD_LIMIT_PER_WEEK = \"$4,000.50\"\nMAX_LOAD_PER_DAY = 2\n"
+		assert.NoError(t, os.WriteFile(path+"config.toml", []byte(content), 0o644))
+
+		configuration := config.LoadConfig(path)
+		assert.Equal(t, []string{"daily_amount", "daily_count", "weekly_amount"}, []string{
+			configuration.Limits[0].Name, configuration.Limits[1].Name, configuration.Limits[2].Name,
+		})
+		assert.Equal(t, money.FromMajor(1000, "USD"), configuration.Limits[0].MaxAmount)
+		assert.Equal(t, 2, configuration.Limits[1].MaxCount)
+		assert.Equal(t, money.New(400050, "USD"), configuration.Limits[2].MaxAmount)
+	})
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"velocity-limits/config"
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeOverridesConfig writes a config.toml with tiers and customer overrides and
+// an overrides file to a temporary directory and returns the directory path.
+func writeOverridesConfig(t *testing.T) string {
+	path := t.TempDir() + "/"
+	content := `[config]
+OVERRIDES_FILE = "customers.toml"
+TIME_ZONE = "Europe/Paris"
+WEEK_START = "sunday"
+
+[[config.LIMITS]]
+NAME = "daily_amount"
+WINDOW = "day"
+METRIC = "amount"
+THRESHOLD = 5000
+
+[[config.LIMITS]]
+NAME = "daily_count"
+WINDOW = "day"
+METRIC = "count"
+THRESHOLD = 3
+
+[[config.TIERS]]
+NAME = "vip"
+LIMITS = [{ NAME = "daily_amount", THRESHOLD = 10000 }, { NAME = "daily_count", THRESHOLD = 5 }]
+
+[[config.CUSTOMERS]]
+CUSTOMER_ID = "1"
+TIER = "vip"
+LIMITS = [{ NAME = "daily_count", THRESHOLD = 7 }]
+TIME_ZONE = "Asia/Tokyo"
+`
+	customers := `[[CUSTOMERS]]
+CUSTOMER_ID = "2"
+LIMITS = [{ NAME = "daily_amount", THRESHOLD = "$100.00" }]
+`
+	assert.NoError(t, os.WriteFile(path+"config.toml", []byte(content), 0o644))
+	assert.NoError(t, os.WriteFile(path+"customers.toml", []byte(customers), 0o644))
+	return path
+}
+
+func TestLimitRulesFor(t *testing.T) {
+	configuration := config.LoadConfig(writeOverridesConfig(t))
+
+	t.Run("returns the global rules for customers without overrides", func(t *testing.T) {
+		rules, err := configuration.LimitRulesFor("3", config.Profile{})
+		assert.NoError(t, err)
+		assert.Len(t, rules, len(configuration.Limits))
+		for i, rule := range rules {
+			assert.Equal(t, configuration.Limits[i].MaxAmount, rule.MaxAmount)
+			assert.Equal(t, configuration.Limits[i].MaxCount, rule.MaxCount)
+		}
+	})
+
+	t.Run("applies the tier and then the customer overrides from the config", func(t *testing.T) {
+		rules, err := configuration.LimitRulesFor("1", config.Profile{})
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(10000, "USD"), rules[0].MaxAmount)
+		assert.Equal(t, 7, rules[1].MaxCount)
+		// The global rules must not be changed by overrides.
+		assert.Equal(t, money.FromMajor(5000, "USD"), configuration.Limits[0].MaxAmount)
+	})
+
+	t.Run("applies customer overrides from the overrides file", func(t *testing.T) {
+		rules, err := configuration.LimitRulesFor("2", config.Profile{})
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(100, "USD"), rules[0].MaxAmount)
+		assert.Equal(t, 3, rules[1].MaxCount)
+	})
+
+	t.Run("applies the profile tier and overrides last", func(t *testing.T) {
+		rules, err := configuration.LimitRulesFor("2", config.Profile{Tier: "vip", LimitOverrides: []config.LimitOverride{{Name: "daily_count", Threshold: "1"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(100, "USD"), rules[0].MaxAmount)
+		assert.Equal(t, 1, rules[1].MaxCount)
+	})
+
+	t.Run("returns an error for unknown tiers and invalid overrides", func(t *testing.T) {
+		_, err := configuration.LimitRulesFor("3", config.Profile{Tier: "gold"})
+		assert.Error(t, err)
+		_, err = configuration.LimitRulesFor("3", config.Profile{LimitOverrides: []config.LimitOverride{{Name: "weekly_amount", Threshold: "1"}}})
+		assert.Error(t, err)
+		_, err = configuration.LimitRulesFor("3", config.Profile{LimitOverrides: []config.LimitOverride{{Name: "daily_amount", Threshold: "lots"}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("resolves the calendar from the profile, the customer and the config", func(t *testing.T) {
+		rules, err := configuration.LimitRulesFor("3", config.Profile{})
+		assert.NoError(t, err)
+		assert.Equal(t, "Europe/Paris", rules[0].Calendar.Location.String())
+		assert.Equal(t, time.Sunday, rules[0].Calendar.WeekStart)
+
+		rules, err = configuration.LimitRulesFor("1", config.Profile{})
+		assert.NoError(t, err)
+		assert.Equal(t, "Asia/Tokyo", rules[0].Calendar.Location.String())
+
+		rules, err = configuration.LimitRulesFor("1", config.Profile{TimeZone: "America/Toronto"})
+		assert.NoError(t, err)
+		assert.Equal(t, "America/Toronto", rules[0].Calendar.Location.String())
+
+		_, err = configuration.LimitRulesFor("1", config.Profile{TimeZone: "Mars/Olympus"})
+		assert.Error(t, err)
+	})
+
+	t.Run("parses the calendar written by its String method", func(t *testing.T) {
+		rules, err := configuration.LimitRulesFor("3", config.Profile{})
+		assert.NoError(t, err)
+		assert.Equal(t, "Europe/Paris sunday", rules[0].Calendar.String())
+		calendar, err := config.ParseCalendar(rules[0].Calendar.String())
+		assert.NoError(t, err)
+		assert.Equal(t, *rules[0].Calendar, calendar)
+
+		_, err = config.ParseCalendar("Europe/Paris")
+		assert.Error(t, err)
+	})
+
+	t.Run("reports declared tiers", func(t *testing.T) {
+		assert.True(t, configuration.HasTier("vip"))
+		assert.False(t, configuration.HasTier("gold"))
+	})
+}
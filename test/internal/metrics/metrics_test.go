@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"velocity-limits/config"
+	"velocity-limits/internal/metrics"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/service"
+	"velocity-limits/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	loadTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	newStorage := storage.NewStorage()
+	newStorage.AddAccount(models.NewCustomerAccount("528"))
+	newStorage.AddAccount(models.NewCustomerAccount("529"))
+
+	load := &models.Transaction{ID: "1", CustomerID: "528", Amount: "$100.50", Time: loadTime}
+	accepted := &models.Response{ID: "1", CustomerID: "528", Accepted: true}
+	declined := &models.Response{ID: "2", CustomerID: "528", Reason: models.ReasonDailyCountExceeded}
+	replay := &models.Response{ID: "1", CustomerID: "528", Accepted: true, Replay: true}
+	conflict := &models.Response{ID: "1", CustomerID: "528", Reason: models.ReasonIdempotencyConflict}
+	metrics.ObserveDecision(load, accepted, time.Millisecond)
+	metrics.ObserveDecision(load, accepted, time.Millisecond)
+	metrics.ObserveDecision(load, declined, time.Millisecond)
+	metrics.ObserveDecision(load, replay, time.Millisecond)
+	metrics.ObserveDecision(load, conflict, time.Millisecond)
+	metrics.ObserveDecision(load, nil, time.Millisecond)
+	metrics.ObserveParseError(models.ReasonMalformedRecord)
+
+	t.Run("should write the metrics in the text exposition format", func(t *testing.T) {
+		var output bytes.Buffer
+		assert.NoError(t, metrics.Write(metrics.NewRegistry(newStorage), &output))
+		text := output.String()
+		assert.Contains(t, text, `velocity_decisions_total{decision="accepted",reason="",type="load"} 2`)
+		assert.Contains(t, text, `velocity_decisions_total{decision="declined",reason="DAILY_COUNT_EXCEEDED",type="load"} 1`)
+		assert.Contains(t, text, `velocity_duplicates_total{reason="DUPLICATE_TRANSACTION",type="load"} 2`)
+		assert.Contains(t, text, `velocity_duplicates_total{reason="IDEMPOTENCY_CONFLICT",type="load"} 1`)
+		assert.Contains(t, text, `velocity_parse_errors_total{reason="MALFORMED_RECORD"} 1`)
+		assert.Contains(t, text, `velocity_processing_duration_seconds_count{type="load"} 3`)
+		assert.Contains(t, text, `velocity_loaded_amount_total{currency="USD"} 201`)
+		assert.Contains(t, text, "velocity_active_accounts 2\n")
+	})
+
+	t.Run("should count invalid transactions as parse errors instead of decisions", func(t *testing.T) {
+		invalid := &models.Transaction{CustomerID: "529", Amount: "$1", Time: loadTime}
+		configVar := config.LoadConfig("../../../config/")
+		response, err := service.ValidateAndProcessTransaction(invalid, &configVar, storage.NewStorage())
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReasonMissingID, response.Reason)
+
+		var output bytes.Buffer
+		assert.NoError(t, metrics.Write(metrics.NewRegistry(newStorage), &output))
+		text := output.String()
+		assert.Contains(t, text, `velocity_parse_errors_total{reason="MISSING_ID"} 1`)
+		assert.NotContains(t, text, `reason="MISSING_ID",type=`)
+	})
+
+	t.Run("should register the metrics in more than one registry", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			metrics.NewRegistry(newStorage)
+			metrics.NewRegistry(storage.NewStorage())
+		})
+	})
+}
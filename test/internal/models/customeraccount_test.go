@@ -4,133 +4,133 @@ import (
 	"testing"
 	"time"
 
+	"velocity-limits/config"
 	"velocity-limits/internal/models"
+	"velocity-limits/pkg/fx"
+	"velocity-limits/pkg/money"
 	"velocity-limits/pkg/util"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// usd returns whole dollars as a money struct.
+func usd(dollars int64) money.Money {
+	return money.FromMajor(dollars, money.DefaultCurrency)
+}
+
+// defaultRules returns the original daily amount, daily count and weekly amount limits.
+func defaultRules() []config.LimitRule {
+	return []config.LimitRule{
+		{Name: "daily_amount", Window: config.WindowDay, Metric: config.MetricAmount, MaxAmount: usd(5000)},
+		{Name: "daily_count", Window: config.WindowDay, Metric: config.MetricCount, MaxCount: 3},
+		{Name: "weekly_amount", Window: config.WindowWeek, Metric: config.MetricAmount, MaxAmount: usd(20000)},
+	}
+}
+
+// newAccount returns a customer account with limits tracked from the given time.
+func newAccount(now time.Time, rules []config.LimitRule) *models.CustomerAccount {
+	customerAccount := models.NewCustomerAccount("1234")
+	customerAccount.ResetLimits(now, rules, 0)
+	return customerAccount
+}
+
+// remainingAmount returns a pointer to an amount for headroom assertions.
+func remainingAmount(dollars int64) *money.Money {
+	amount := usd(dollars)
+	return &amount
+}
+
+// remainingCount returns a pointer to a count for headroom assertions.
+func remainingCount(count int) *int {
+	return &count
+}
+
 func TestNewCustomerAccount(t *testing.T) {
 	t.Run("returns a new customer account", func(t *testing.T) {
 		expectedCustomerAccount := &models.CustomerAccount{
 			CustomerID: "1234",
+			Balances:   models.Balances{},
+			Limits:     map[string]*models.Limit{},
 		}
 		result := models.NewCustomerAccount("1234")
 		assert.Equal(t, expectedCustomerAccount, result)
 	})
 }
 
-func TestNewDailyLimit(t *testing.T) {
-	t.Run("returns a new velocity limits per day", func(t *testing.T) {
-		expectedDailyLimit := &models.DailyLimit{
-			Date:         util.GetBeginningOfTheDay(time.Now()),
-			MaxLoadLimit: 5000,
-			MaxLoad:      3,
-		}
-		result := models.NewDailyLimit(time.Now(), 5000, 3)
-		assert.Equal(t, expectedDailyLimit, result)
-	})
-}
+func TestClone(t *testing.T) {
+	t.Run("returns a copy which doesn't share limits or history", func(t *testing.T) {
+		now := time.Now()
+		rules := append(defaultRules(), config.LimitRule{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount, MaxAmount: usd(5000)})
+		customerAccount := newAccount(now, rules)
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$100.00", Time: now}, rules, 0)
 
-func TestNewWeeklyLimit(t *testing.T) {
-	t.Run("returns a new velocity limits per week", func(t *testing.T) {
-		expectedWeeklyLimit := &models.WeeklyLimit{
-			Date:         util.GetBeginningOfTheWeek(time.Now()),
-			MaxLoadLimit: 20000,
-		}
-		result := models.NewWeeklyLimit(time.Now(), 20000)
-		assert.Equal(t, expectedWeeklyLimit, result)
-	})
-}
+		clone := customerAccount.Clone()
+		clone.LoadFunds(&models.Transaction{Amount: "$200.00", Time: now}, rules, 0)
 
-func TestValidateDailyLimit(t *testing.T) {
-	t.Run("returns true when loading below max load limit per day", func(t *testing.T) {
-		dailyLimit := models.NewDailyLimit(time.Now(), 5000, 3)
-		valid := dailyLimit.Validate(3000)
-		assert.True(t, valid)
-	})
-	t.Run("returns true when loading exactly same max load limit per day", func(t *testing.T) {
-		dailyLimit := models.NewDailyLimit(time.Now(), 5000, 3)
-		valid := dailyLimit.Validate(5000)
-		assert.True(t, valid)
-	})
-	t.Run("returns false when loading more than allowed max load limit per day", func(t *testing.T) {
-		dailyLimit := models.NewDailyLimit(time.Now(), 5000, 3)
-		valid := dailyLimit.Validate(5001)
-		assert.False(t, valid)
+		assert.Equal(t, usd(100), customerAccount.Balances.Get("USD"))
+		assert.Equal(t, usd(100), customerAccount.Limits["daily_amount"].Amount)
+		assert.Len(t, customerAccount.History, 1)
+		assert.Equal(t, usd(300), clone.Balances.Get("USD"))
+		assert.Len(t, clone.History, 2)
 	})
 }
 
-func TestValidateWeeklyLimit(t *testing.T) {
-	t.Run("returns true when loading below max load limit per week", func(t *testing.T) {
-		WeeklyLimit := models.NewWeeklyLimit(time.Now(), 20000)
-		valid := WeeklyLimit.Validate(2000)
-		assert.True(t, valid)
-	})
-	t.Run("returns true when loading exactly same max load limit per week", func(t *testing.T) {
-		WeeklyLimit := models.NewWeeklyLimit(time.Now(), 20000)
-		valid := WeeklyLimit.Validate(20000)
-		assert.True(t, valid)
-	})
-	t.Run("returns false when loading more than allowed max load limit per week", func(t *testing.T) {
-		WeeklyLimit := models.NewWeeklyLimit(time.Now(), 20000)
-		valid := WeeklyLimit.Validate(21000)
-		assert.False(t, valid)
-	})
-}
-
-func TestDailyUpdateLimits(t *testing.T) {
-	t.Run("updates allocated daily limit and reflecting amount will be reduced", func(t *testing.T) {
-		dailyLimit := models.NewDailyLimit(time.Now(), 5000, 3)
-		dailyLimit.UpdateLimits(2000)
-		assert.Equal(t, float64(3000), dailyLimit.MaxLoadLimit)
-	})
-}
+func TestResetLimits(t *testing.T) {
+	t.Run("creates limits for rules which aren't tracked yet", func(t *testing.T) {
+		now := time.Now()
+		customerAccount := newAccount(now, defaultRules())
 
-func TestWeeklyUpdateLimits(t *testing.T) {
-	t.Run("updates allocated weekly limit and reflecting amount will be reduced", func(t *testing.T) {
-		weeklyLimit := models.NewWeeklyLimit(time.Now(), 20000)
-		weeklyLimit.UpdateLimits(15000)
-		assert.Equal(t, float64(5000), weeklyLimit.MaxLoadLimit)
+		assert.Len(t, customerAccount.Limits, 3)
+		assert.Equal(t, util.GetBeginningOfTheDay(now), customerAccount.Limits["daily_amount"].Start)
+		assert.Equal(t, util.GetBeginningOfTheWeek(now), customerAccount.Limits["weekly_amount"].Start)
 	})
-}
 
-func TestResetLimits(t *testing.T) {
 	t.Run("should not reset velocity limits if load time is within daily/weekly limits", func(t *testing.T) {
-		customerAccount := models.NewCustomerAccount("1234")
 		now := time.Now()
-		customerAccount.DailyLimit = models.NewDailyLimit(now, 5000, 3)
-		customerAccount.WeeklyLimit = models.NewWeeklyLimit(now, 20000)
+		customerAccount := newAccount(now, defaultRules())
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$1000.00", Time: now}, defaultRules(), 0)
 
-		customerAccount.ResetLimits(time.Now(), 1000, 5, 10000)
+		customerAccount.ResetLimits(now, defaultRules(), 0)
 
-		assert.Equal(t, float64(5000), customerAccount.DailyLimit.MaxLoadLimit)
-		assert.Equal(t, 3, customerAccount.DailyLimit.MaxLoad)
-		assert.Equal(t, float64(20000), customerAccount.WeeklyLimit.MaxLoadLimit)
+		assert.Equal(t, usd(1000), customerAccount.Limits["daily_amount"].Amount)
+		assert.Equal(t, 1, customerAccount.Limits["daily_count"].Count)
+		assert.Equal(t, usd(1000), customerAccount.Limits["weekly_amount"].Amount)
 	})
 
-	t.Run("should reset velocity limits if load time is before current day/week", func(t *testing.T) {
-		customerAccount := models.NewCustomerAccount("1234")
+	t.Run("should reset velocity limits if load time is after current day/week", func(t *testing.T) {
 		previousMonth := time.Now().AddDate(0, -1, 0)
-		customerAccount.DailyLimit = models.NewDailyLimit(previousMonth, 5000, 3)
-		customerAccount.WeeklyLimit = models.NewWeeklyLimit(previousMonth, 20000)
+		customerAccount := newAccount(previousMonth, defaultRules())
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$1000.00", Time: previousMonth}, defaultRules(), 0)
 
 		now := time.Now()
-		customerAccount.ResetLimits(now, 1000, 5, 10000)
+		customerAccount.ResetLimits(now, defaultRules(), 0)
 
-		assert.Equal(t, float64(1000), customerAccount.DailyLimit.MaxLoadLimit)
-		assert.Equal(t, 5, customerAccount.DailyLimit.MaxLoad)
-		assert.Equal(t, float64(10000), customerAccount.WeeklyLimit.MaxLoadLimit)
+		assert.Equal(t, usd(0), customerAccount.Limits["daily_amount"].Amount)
+		assert.Equal(t, 0, customerAccount.Limits["daily_count"].Count)
+		assert.Equal(t, usd(0), customerAccount.Limits["weekly_amount"].Amount)
+		assert.Equal(t, util.GetBeginningOfTheDay(now), customerAccount.Limits["daily_amount"].Start)
+	})
+
+	t.Run("should evict history older than the longest rolling window", func(t *testing.T) {
+		rules := []config.LimitRule{{Name: "rolling_count", Window: config.WindowRolling, Hours: 24, Metric: config.MetricCount, MaxCount: 3}}
+		start := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+		customerAccount := newAccount(start, rules)
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$1.00", Time: start}, rules, 0)
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$1.00", Time: start.Add(12 * time.Hour)}, rules, 0)
+		customerAccount.ResetLimits(start.Add(30*time.Hour), rules, 0)
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$1.00", Time: start.Add(30 * time.Hour)}, rules, 0)
+
+		customerAccount.ResetLimits(start.Add(30*time.Hour), rules, 0)
+
+		assert.Len(t, customerAccount.History, 2)
+		assert.Equal(t, start.Add(12*time.Hour), customerAccount.History[0].Time)
 	})
 }
 
 func TestLoadFunds(t *testing.T) {
-
-	t.Run("should return true when max load per day, max load per week and max load limits are not reached", func(t *testing.T) {
-		customerAccount := models.NewCustomerAccount("1234")
+	t.Run("should accept when max load per day, max load per week and max load limits are not reached", func(t *testing.T) {
 		now := time.Now()
-		customerAccount.DailyLimit = models.NewDailyLimit(now, 5000, 3)
-		customerAccount.WeeklyLimit = models.NewWeeklyLimit(now, 20000)
+		customerAccount := newAccount(now, defaultRules())
 
 		txn := models.Transaction{
 			ID:         "123",
@@ -139,19 +139,23 @@ func TestLoadFunds(t *testing.T) {
 			Time:       now,
 		}
 
-		success := customerAccount.LoadFunds(&txn)
-		assert.True(t, success)
-		assert.Equal(t, float64(3000), customerAccount.Balance)
-		assert.Equal(t, float64(2000), customerAccount.DailyLimit.MaxLoadLimit)
-		assert.Equal(t, float64(17000), customerAccount.WeeklyLimit.MaxLoadLimit)
-		assert.Equal(t, 2, customerAccount.DailyLimit.MaxLoad)
+		decision := customerAccount.LoadFunds(&txn, defaultRules(), 0)
+		assert.True(t, decision.Accepted)
+		assert.Equal(t, models.ReasonNone, decision.Reason)
+		assert.Equal(t, models.Headroom{
+			{Limit: "daily_amount", RemainingAmount: remainingAmount(2000)},
+			{Limit: "daily_count", RemainingCount: remainingCount(2)},
+			{Limit: "weekly_amount", RemainingAmount: remainingAmount(17000)},
+		}, decision.Headroom)
+		assert.Equal(t, usd(3000), customerAccount.Balances.Get("USD"))
+		assert.Equal(t, usd(3000), customerAccount.Limits["daily_amount"].Amount)
+		assert.Equal(t, 1, customerAccount.Limits["daily_count"].Count)
+		assert.Equal(t, usd(3000), customerAccount.Limits["weekly_amount"].Amount)
 	})
 
-	t.Run("should return false when max load per day, max load per week and max load limits are reached", func(t *testing.T) {
-		customerAccount := models.NewCustomerAccount("1234")
+	t.Run("should decline without changing limits when max load limits are reached", func(t *testing.T) {
 		now := time.Now()
-		customerAccount.DailyLimit = models.NewDailyLimit(now, 5000, 3)
-		customerAccount.WeeklyLimit = models.NewWeeklyLimit(now, 20000)
+		customerAccount := newAccount(now, defaultRules())
 
 		txn := models.Transaction{
 			ID:         "123",
@@ -160,11 +164,447 @@ func TestLoadFunds(t *testing.T) {
 			Time:       now,
 		}
 
-		result := customerAccount.LoadFunds(&txn)
-		assert.False(t, result)
-		assert.Equal(t, float64(0), customerAccount.Balance)
-		assert.Equal(t, float64(5000), customerAccount.DailyLimit.MaxLoadLimit)
-		assert.Equal(t, float64(20000), customerAccount.WeeklyLimit.MaxLoadLimit)
-		assert.Equal(t, 3, customerAccount.DailyLimit.MaxLoad)
+		decision := customerAccount.LoadFunds(&txn, defaultRules(), 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+		assert.Equal(t, usd(0), customerAccount.Balances.Get("USD"))
+		assert.Equal(t, usd(0), customerAccount.Limits["daily_amount"].Amount)
+		assert.Equal(t, 0, customerAccount.Limits["daily_count"].Count)
+		assert.Equal(t, usd(0), customerAccount.Limits["weekly_amount"].Amount)
+	})
+
+	t.Run("should not accept fractional loads adding up above the daily limit", func(t *testing.T) {
+		now := time.Now()
+		customerAccount := newAccount(now, defaultRules())
+
+		txn := models.Transaction{CustomerID: "1234", Amount: "$1666.67", Time: now}
+		assert.True(t, customerAccount.LoadFunds(&txn, defaultRules(), 0).Accepted)
+		assert.True(t, customerAccount.LoadFunds(&txn, defaultRules(), 0).Accepted)
+		assert.False(t, customerAccount.LoadFunds(&txn, defaultRules(), 0).Accepted)
+		assert.Equal(t, money.New(333334, "USD"), customerAccount.Balances.Get("USD"))
+	})
+
+	t.Run("should return invalid amount when loading a negative amount", func(t *testing.T) {
+		now := time.Now()
+		customerAccount := newAccount(now, defaultRules())
+
+		txn := models.Transaction{CustomerID: "1234", Amount: "-$100.00", Time: now}
+		decision := customerAccount.LoadFunds(&txn, defaultRules(), 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonInvalidAmount, decision.Reason)
+		assert.Equal(t, usd(0), customerAccount.Balances.Get("USD"))
+	})
+
+	t.Run("should return daily count exceeded reason on the fourth load of a day", func(t *testing.T) {
+		now := time.Now()
+		customerAccount := newAccount(now, defaultRules())
+
+		txn := models.Transaction{CustomerID: "1234", Amount: "$400.00", Time: now}
+		for i := 0; i < 3; i++ {
+			assert.True(t, customerAccount.LoadFunds(&txn, defaultRules(), 0).Accepted)
+		}
+		decision := customerAccount.LoadFunds(&txn, defaultRules(), 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonDailyCountExceeded, decision.Reason)
+		assert.Equal(t, 0, *decision.Headroom[1].RemainingCount)
+	})
+
+	t.Run("should return weekly amount exceeded reason across days of a week", func(t *testing.T) {
+		monday := time.Date(2000, 1, 3, 10, 0, 0, 0, time.UTC)
+		customerAccount := newAccount(monday, defaultRules())
+
+		for day := 0; day < 4; day++ {
+			loadTime := monday.AddDate(0, 0, day)
+			customerAccount.ResetLimits(loadTime, defaultRules(), 0)
+			assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$5000.00", Time: loadTime}, defaultRules(), 0).Accepted)
+		}
+		friday := monday.AddDate(0, 0, 4)
+		customerAccount.ResetLimits(friday, defaultRules(), 0)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$0.01", Time: friday}, defaultRules(), 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonWeeklyAmountExceeded, decision.Reason)
+	})
+
+	t.Run("should evaluate rolling window rules over the last hours", func(t *testing.T) {
+		rules := []config.LimitRule{{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount, MaxAmount: usd(5000)}}
+		lateEvening := time.Date(2000, 1, 1, 23, 59, 0, 0, time.UTC)
+		customerAccount := newAccount(lateEvening, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$5000.00", Time: lateEvening}, rules, 0).Accepted)
+
+		// The next calendar day is still within the rolling 24 hours.
+		nextDay := lateEvening.Add(2 * time.Minute)
+		customerAccount.ResetLimits(nextDay, rules, 0)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$5000.00", Time: nextDay}, rules, 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("ROLLING_AMOUNT_EXCEEDED"), decision.Reason)
+
+		// 24 hours after the first load the amount is available again.
+		dayAfter := lateEvening.Add(24 * time.Hour)
+		customerAccount.ResetLimits(dayAfter, rules, 0)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$5000.00", Time: dayAfter}, rules, 0).Accepted)
+	})
+
+	t.Run("should evaluate all rules atomically", func(t *testing.T) {
+		rules := []config.LimitRule{
+			{Name: "hourly_count", Window: config.WindowHour, Metric: config.MetricCount, MaxCount: 5},
+			{Name: "monthly_amount", Window: config.WindowMonth, Metric: config.MetricAmount, MaxAmount: usd(100)},
+		}
+		now := time.Date(2000, 1, 1, 10, 0, 0, 0, time.UTC)
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$60.00", Time: now}, rules, 0).Accepted)
+
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$60.00", Time: now}, rules, 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("MONTHLY_AMOUNT_EXCEEDED"), decision.Reason)
+		// The hourly count passed but must not be consumed by the declined load.
+		assert.Equal(t, 1, customerAccount.Limits["hourly_count"].Count)
+	})
+}
+
+func TestLateLoads(t *testing.T) {
+	monday := time.Date(2000, 1, 3, 10, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	t.Run("should evaluate a late load against the window it belongs to", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$4000.00", Time: monday}, defaultRules(), 48*time.Hour).Accepted)
+		customerAccount.ResetLimits(tuesday, defaultRules(), 48*time.Hour)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$4000.00", Time: tuesday}, defaultRules(), 48*time.Hour).Accepted)
+
+		lateLoad := monday.Add(time.Hour)
+		customerAccount.ResetLimits(lateLoad, defaultRules(), 48*time.Hour)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$1000.00", Time: lateLoad}, defaultRules(), 48*time.Hour)
+		assert.True(t, decision.Accepted)
+		assert.Equal(t, remainingAmount(0), decision.Headroom[0].RemainingAmount)
+		assert.Equal(t, usd(4000), customerAccount.Limits["daily_amount"].Amount)
+		assert.Equal(t, usd(9000), customerAccount.Limits["weekly_amount"].Amount)
+
+		decision = customerAccount.LoadFunds(&models.Transaction{Amount: "$0.01", Time: lateLoad}, defaultRules(), 48*time.Hour)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+	})
+
+	t.Run("should decline loads older than the late tolerance", func(t *testing.T) {
+		customerAccount := newAccount(tuesday, defaultRules())
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: tuesday}, defaultRules(), time.Hour).Accepted)
+
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: monday}, defaultRules(), time.Hour)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonLateTransaction, decision.Reason)
+		assert.Equal(t, usd(10), customerAccount.Balances.Get("USD"))
+		assert.Empty(t, customerAccount.PastLimits)
+	})
+
+	t.Run("should not make later loads late after a declined load far ahead", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: monday}, defaultRules(), time.Hour).Accepted)
+
+		nextYear := monday.AddDate(1, 0, 0)
+		customerAccount.ResetLimits(nextYear, defaultRules(), time.Hour)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$6000.00", Time: nextYear}, defaultRules(), time.Hour)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+		assert.Equal(t, monday, customerAccount.LastTransactionTime)
+
+		customerAccount.ResetLimits(tuesday, defaultRules(), time.Hour)
+		decision = customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: tuesday}, defaultRules(), time.Hour)
+		assert.True(t, decision.Accepted)
+		assert.Equal(t, remainingAmount(19980), decision.Headroom[2].RemainingAmount)
+	})
+
+	t.Run("should drop past windows which late loads can't fall into anymore", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: monday}, defaultRules(), 24*time.Hour)
+
+		customerAccount.ResetLimits(tuesday, defaultRules(), 24*time.Hour)
+		assert.Equal(t, usd(10), customerAccount.PastLimits["daily_amount"]["2000-01-03T00:00:00Z"].Amount)
+
+		// Usage is only dropped once a later transaction is accepted.
+		thursday := tuesday.AddDate(0, 0, 2)
+		customerAccount.ResetLimits(thursday, defaultRules(), 24*time.Hour)
+		assert.Contains(t, customerAccount.PastLimits, "daily_amount")
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: thursday}, defaultRules(), 24*time.Hour)
+		customerAccount.ResetLimits(thursday, defaultRules(), 24*time.Hour)
+		assert.NotContains(t, customerAccount.PastLimits, "daily_amount")
+		assert.Equal(t, usd(20), customerAccount.Limits["weekly_amount"].Amount)
+	})
+
+	t.Run("should decline a late load which exceeds the rolling window of a later load", func(t *testing.T) {
+		rules := []config.LimitRule{{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount, MaxAmount: usd(5000)}}
+		customerAccount := newAccount(monday, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$4000.00", Time: monday}, rules, 48*time.Hour).Accepted)
+		customerAccount.ResetLimits(tuesday, rules, 48*time.Hour)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$4000.00", Time: tuesday}, rules, 48*time.Hour).Accepted)
+
+		// 12 hours before Tuesday only the Tuesday window would be exceeded.
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$2000.00", Time: tuesday.Add(-12 * time.Hour)}, rules, 48*time.Hour)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("ROLLING_AMOUNT_EXCEEDED"), decision.Reason)
+	})
+}
+
+func TestPreCheckLoad(t *testing.T) {
+	monday := time.Date(2000, 1, 3, 10, 0, 0, 0, time.UTC)
+
+	t.Run("should return the decision and what's left without changing the account", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$3000.00", Time: monday}, defaultRules(), 0)
+		before := customerAccount.Clone()
+
+		preCheck := customerAccount.PreCheckLoad(&models.Transaction{ID: "2", CustomerID: "1234", Amount: "$1500.00", Time: monday.Add(time.Hour)}, defaultRules(), 0)
+		assert.True(t, preCheck.Accepted)
+		assert.Equal(t, remainingAmount(2000), preCheck.MaxLoadAmount)
+		assert.Equal(t, remainingCount(2), preCheck.RemainingLoads)
+		assert.Equal(t, remainingAmount(500), preCheck.Headroom[0].RemainingAmount)
+		assert.Equal(t, before, customerAccount)
+
+		preCheck = customerAccount.PreCheckLoad(&models.Transaction{Amount: "$2000.01", Time: monday.Add(time.Hour)}, defaultRules(), 0)
+		assert.False(t, preCheck.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, preCheck.Reason)
+		assert.Equal(t, remainingAmount(2000), preCheck.MaxLoadAmount)
+	})
+
+	t.Run("should evaluate against reset windows and the lowest limit", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		for day := 0; day < 4; day++ {
+			customerAccount.ResetLimits(monday.AddDate(0, 0, day), defaultRules(), 0)
+			customerAccount.LoadFunds(&models.Transaction{Amount: "$4500.00", Time: monday.AddDate(0, 0, day)}, defaultRules(), 0)
+		}
+
+		preCheck := customerAccount.PreCheckLoad(&models.Transaction{Amount: "$1.00", Time: monday.AddDate(0, 0, 4)}, defaultRules(), 0)
+		assert.True(t, preCheck.Accepted)
+		assert.Equal(t, remainingAmount(2000), preCheck.MaxLoadAmount)
+		assert.Equal(t, remainingCount(3), preCheck.RemainingLoads)
+		assert.Equal(t, usd(4500), customerAccount.Limits["daily_amount"].Amount)
+	})
+
+	t.Run("should have no amount left when no more loads are allowed", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		for i := 0; i < 3; i++ {
+			customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: monday}, defaultRules(), 0)
+		}
+
+		preCheck := customerAccount.PreCheckLoad(&models.Transaction{Amount: "$10.00", Time: monday}, defaultRules(), 0)
+		assert.Equal(t, models.ReasonDailyCountExceeded, preCheck.Reason)
+		assert.Equal(t, remainingAmount(0), preCheck.MaxLoadAmount)
+		assert.Equal(t, remainingCount(0), preCheck.RemainingLoads)
+	})
+
+	t.Run("should count the later loads in the rolling windows of a late load", func(t *testing.T) {
+		rules := []config.LimitRule{{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount, MaxAmount: usd(5000)}}
+		customerAccount := newAccount(monday, rules)
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$1000.00", Time: monday}, rules, 48*time.Hour)
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$3000.00", Time: monday.Add(6 * time.Hour)}, rules, 48*time.Hour)
+
+		preCheck := customerAccount.PreCheckLoad(&models.Transaction{Amount: "$500.00", Time: monday.Add(-time.Hour)}, rules, 48*time.Hour)
+		assert.True(t, preCheck.Accepted)
+		assert.Equal(t, remainingAmount(1000), preCheck.MaxLoadAmount)
+		assert.Nil(t, preCheck.RemainingLoads)
+	})
+
+	t.Run("should have nothing left for a load older than the late tolerance", func(t *testing.T) {
+		customerAccount := newAccount(monday, defaultRules())
+		customerAccount.LoadFunds(&models.Transaction{Amount: "$10.00", Time: monday}, defaultRules(), time.Hour)
+		preCheck := customerAccount.PreCheckLoad(&models.Transaction{Amount: "$10.00", Time: monday.Add(-2 * time.Hour)}, defaultRules(), time.Hour)
+		assert.Equal(t, models.ReasonLateTransaction, preCheck.Reason)
+		assert.Equal(t, remainingAmount(0), preCheck.MaxLoadAmount)
+		assert.Equal(t, remainingCount(0), preCheck.RemainingLoads)
+	})
+}
+
+func TestWithdrawFunds(t *testing.T) {
+	now := time.Date(2000, 1, 1, 10, 0, 0, 0, time.UTC)
+	rules := append(defaultRules(),
+		config.LimitRule{Name: "daily_withdrawal_amount", Type: config.TypeWithdrawal, Window: config.WindowDay, Metric: config.MetricAmount, MaxAmount: usd(500)},
+		config.LimitRule{Name: "daily_transfer_count", Type: config.TypeTransfer, Window: config.WindowDay, Metric: config.MetricCount, MaxCount: 1},
+	)
+
+	t.Run("should withdraw within the balance and the withdrawal limits", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$1000.00", Time: now}, rules, 0).Accepted)
+
+		decision := customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "$300.00", Time: now}, rules, 0)
+		assert.True(t, decision.Accepted)
+		assert.Equal(t, models.Headroom{{Limit: "daily_withdrawal_amount", RemainingAmount: remainingAmount(200)}}, decision.Headroom)
+		assert.Equal(t, usd(700), customerAccount.Balances.Get("USD"))
+		// Withdrawals don't use the load limits.
+		assert.Equal(t, usd(1000), customerAccount.Limits["daily_amount"].Amount)
+
+		decision = customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "$300.00", Time: now}, rules, 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("DAILY_WITHDRAWAL_AMOUNT_EXCEEDED"), decision.Reason)
+	})
+
+	t.Run("should decline withdrawals and transfers above the balance", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$100.00", Time: now}, rules, 0).Accepted)
+
+		decision := customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "$100.01", Time: now}, rules, 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonInsufficientFunds, decision.Reason)
+		decision = customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeTransfer, Amount: "$100.01", Time: now}, rules, 0)
+		assert.Equal(t, models.ReasonInsufficientFunds, decision.Reason)
+		assert.Equal(t, usd(100), customerAccount.Balances.Get("USD"))
+	})
+
+	t.Run("should apply the transfer limits to transfers", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$100.00", Time: now}, rules, 0).Accepted)
+
+		assert.True(t, customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeTransfer, Amount: "$10.00", Time: now}, rules, 0).Accepted)
+		decision := customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeTransfer, Amount: "$10.00", Time: now}, rules, 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("DAILY_TRANSFER_COUNT_EXCEEDED"), decision.Reason)
+
+		customerAccount.ReceiveFunds(usd(5))
+		assert.Equal(t, usd(95), customerAccount.Balances.Get("USD"))
+	})
+
+	t.Run("should only count transactions of the rule type in rolling windows", func(t *testing.T) {
+		rollingRules := []config.LimitRule{
+			{Name: "rolling_count", Window: config.WindowRolling, Hours: 24, Metric: config.MetricCount, MaxCount: 1},
+			{Name: "rolling_withdrawal_count", Type: config.TypeWithdrawal, Window: config.WindowRolling, Hours: 24, Metric: config.MetricCount, MaxCount: 1},
+		}
+		customerAccount := newAccount(now, rollingRules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$100.00", Time: now}, rollingRules, 0).Accepted)
+		assert.True(t, customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "$10.00", Time: now}, rollingRules, 0).Accepted)
+		assert.False(t, customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "$10.00", Time: now}, rollingRules, 0).Accepted)
+	})
+}
+
+func TestReverseLoad(t *testing.T) {
+	monday := time.Date(2000, 1, 3, 10, 0, 0, 0, time.UTC)
+	rules := append(defaultRules(), config.LimitRule{Name: "rolling_count", Window: config.WindowRolling, Hours: 48, Metric: config.MetricCount, MaxCount: 2})
+	load := &models.Transaction{ID: "1", CustomerID: "1234", Amount: "$4000.00", Time: monday}
+	ledger := []models.LedgerEntry{models.NewLedgerEntry("1234", load, usd(4000), "")}
+
+	t.Run("should give back the usage of the original load window", func(t *testing.T) {
+		customerAccount := newAccount(monday, rules)
+		assert.True(t, customerAccount.LoadFunds(load, rules, time.Hour*48).Accepted)
+		tuesday := monday.Add(24 * time.Hour)
+		customerAccount.ResetLimits(tuesday, rules, time.Hour*48)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$1000.00", Time: tuesday}, rules, time.Hour*48).Accepted)
+
+		reversal := &models.Transaction{ID: "2", CustomerID: "1234", Type: config.TypeReversal, OriginalID: "1", Time: tuesday}
+		decision := customerAccount.ReverseLoad(reversal, ledger, rules)
+		assert.True(t, decision.Accepted)
+		assert.Equal(t, usd(1000), customerAccount.Balances.Get("USD"))
+		assert.Equal(t, usd(1000), customerAccount.Limits["weekly_amount"].Amount)
+		assert.Equal(t, remainingCount(1), decision.Headroom[3].RemainingCount)
+
+		// Monday is a past window by now and has its headroom back for late loads.
+		late := &models.Transaction{Amount: "$5000.00", Time: monday.Add(time.Hour)}
+		assert.True(t, customerAccount.LoadFunds(late, rules, time.Hour*48).Accepted)
+	})
+
+	t.Run("should decline unknown, reversed and spent loads", func(t *testing.T) {
+		customerAccount := newAccount(monday, rules)
+		assert.True(t, customerAccount.LoadFunds(load, rules, 0).Accepted)
+
+		unknown := &models.Transaction{Type: config.TypeReversal, OriginalID: "9", Time: monday}
+		assert.Equal(t, models.ReasonUnknownOriginal, customerAccount.ReverseLoad(unknown, ledger, rules).Reason)
+
+		mismatch := &models.Transaction{Type: config.TypeReversal, OriginalID: "1", Amount: "$1.00", Time: monday}
+		assert.Equal(t, models.ReasonInvalidAmount, customerAccount.ReverseLoad(mismatch, ledger, rules).Reason)
+
+		reversed := append(ledger, models.NewLedgerEntry("1234", &models.Transaction{ID: "2", Type: config.TypeReversal, OriginalID: "1", Time: monday}, usd(-4000), ""))
+		reversal := &models.Transaction{Type: config.TypeReversal, OriginalID: "1", Time: monday}
+		assert.Equal(t, models.ReasonAlreadyReversed, customerAccount.ReverseLoad(reversal, reversed, rules).Reason)
+
+		assert.True(t, customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "$1.00", Time: monday}, rules, 0).Accepted)
+		assert.Equal(t, models.ReasonInsufficientFunds, customerAccount.ReverseLoad(reversal, ledger, rules).Reason)
+		assert.Equal(t, usd(3999), customerAccount.Balances.Get("USD"))
+		assert.Equal(t, 1, customerAccount.Limits["daily_count"].Count)
+	})
+}
+
+func TestMultiCurrency(t *testing.T) {
+	now := time.Date(2000, 1, 1, 10, 0, 0, 0, time.UTC)
+	rates, _ := fx.NewStaticProvider("USD", map[string]string{"EUR": "1.25"})
+	exchange := &config.Exchange{Base: "USD", Rates: rates}
+	rules := append(defaultRules(), config.LimitRule{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount, MaxAmount: usd(6000)})
+	for i := range rules {
+		rules[i].Exchange = exchange
+	}
+
+	t.Run("should keep balances per currency and evaluate limits in the base currency", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "€2,000.00", Time: now}, rules, 0).Accepted)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$2,500.00", Time: now}, rules, 0)
+		assert.True(t, decision.Accepted)
+		assert.Equal(t, models.Headroom{
+			{Limit: "daily_amount", RemainingAmount: remainingAmount(0)},
+			{Limit: "daily_count", RemainingCount: remainingCount(1)},
+			{Limit: "weekly_amount", RemainingAmount: remainingAmount(15000)},
+			{Limit: "rolling_amount", RemainingAmount: remainingAmount(1000)},
+		}, decision.Headroom)
+		assert.Equal(t, models.Balances{"USD": usd(2500), "EUR": money.FromMajor(2000, "EUR")}, customerAccount.Balances)
+
+		decision = customerAccount.LoadFunds(&models.Transaction{Amount: "EUR 0.01", Time: now}, rules, 0)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+	})
+
+	t.Run("should give back the base amount a load was charged with after the rate changed", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		load := &models.Transaction{ID: "1", CustomerID: "1234", Amount: "€2,000.00", Time: now}
+		decision := customerAccount.LoadFunds(load, rules, 0)
+		assert.Equal(t, usd(2500), decision.BaseAmount)
+		entry := models.NewLedgerEntry("1234", load, money.FromMajor(2000, "EUR"), "")
+		entry.BaseAmount = &decision.BaseAmount
+
+		newRates, _ := fx.NewStaticProvider("USD", map[string]string{"EUR": "1.5"})
+		newRules := append([]config.LimitRule(nil), rules...)
+		for i := range newRules {
+			newRules[i].Exchange = &config.Exchange{Base: "USD", Rates: newRates}
+		}
+		reversal := &models.Transaction{ID: "2", CustomerID: "1234", Type: config.TypeReversal, OriginalID: "1", Time: now}
+		assert.True(t, customerAccount.ReverseLoad(reversal, []models.LedgerEntry{entry}, newRules).Accepted)
+		assert.True(t, customerAccount.Limits["daily_amount"].Amount.IsZero())
+		assert.Empty(t, customerAccount.History)
+	})
+
+	t.Run("should withdraw from the balance of the transaction currency", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$100.00", Time: now}, rules, 0).Accepted)
+		decision := customerAccount.WithdrawFunds(&models.Transaction{Type: config.TypeWithdrawal, Amount: "€1.00", Time: now}, rules, 0)
+		assert.Equal(t, models.ReasonInsufficientFunds, decision.Reason)
+	})
+
+	t.Run("should decline amounts without an exchange rate", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "£100.00", Time: now}, rules, 0)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonNoExchangeRate, decision.Reason)
+		assert.Empty(t, customerAccount.Balances)
+	})
+
+	t.Run("should convert the usage stored in another base currency", func(t *testing.T) {
+		euroRates, _ := fx.NewStaticProvider("EUR", map[string]string{})
+		euroRules := defaultRules()
+		for i := range euroRules {
+			euroRules[i].Exchange = &config.Exchange{Base: "EUR", Rates: euroRates}
+			euroRules[i].MaxAmount.Currency = "EUR"
+		}
+		euroRules = append(euroRules, config.LimitRule{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount,
+			MaxAmount: money.FromMajor(6000, "EUR"), Exchange: euroRules[0].Exchange})
+		customerAccount := newAccount(now, euroRules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "€3,200.00", Time: now}, euroRules, 0).Accepted)
+
+		assert.NoError(t, customerAccount.ConvertUsage(rules))
+		assert.Equal(t, usd(4000), customerAccount.Limits["daily_amount"].Amount)
+		assert.Equal(t, usd(4000), customerAccount.History[0].Amount)
+		decision := customerAccount.LoadFunds(&models.Transaction{Amount: "$1,000.01", Time: now}, rules, 0)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+	})
+
+	t.Run("should keep the usage when it can't be converted", func(t *testing.T) {
+		customerAccount := newAccount(now, rules)
+		assert.True(t, customerAccount.LoadFunds(&models.Transaction{Amount: "$100.00", Time: now}, rules, 0).Accepted)
+		poundRules := defaultRules()
+		for i := range poundRules {
+			poundRules[i].Exchange = &config.Exchange{Base: "GBP"}
+		}
+
+		assert.Error(t, customerAccount.ConvertUsage(poundRules))
+		assert.Equal(t, usd(100), customerAccount.Limits["daily_amount"].Amount)
 	})
 }
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/pkg/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLimit(t *testing.T) {
+	t.Run("returns a new unused limit starting at the rule window", func(t *testing.T) {
+		now := time.Now()
+		expectedLimit := &models.Limit{
+			Start:  util.GetBeginningOfTheWeek(now),
+			Amount: usd(0),
+		}
+		rule := config.LimitRule{Name: "weekly_amount", Window: config.WindowWeek, Metric: config.MetricAmount, MaxAmount: usd(20000)}
+		assert.Equal(t, expectedLimit, models.NewLimit(rule, now))
+	})
+
+	t.Run("starts hourly and monthly windows at the beginning of the hour and month", func(t *testing.T) {
+		now := time.Date(2000, 1, 15, 10, 30, 0, 0, time.UTC)
+		hourly := config.LimitRule{Window: config.WindowHour}
+		monthly := config.LimitRule{Window: config.WindowMonth}
+		assert.Equal(t, time.Date(2000, 1, 15, 10, 0, 0, 0, time.UTC), models.NewLimit(hourly, now).Start)
+		assert.Equal(t, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), models.NewLimit(monthly, now).Start)
+	})
+
+	t.Run("starts weekly windows on Monday for a load on Sunday", func(t *testing.T) {
+		sunday := time.Date(2000, 1, 2, 10, 0, 0, 0, time.UTC)
+		weekly := config.LimitRule{Window: config.WindowWeek}
+		assert.Equal(t, time.Date(1999, 12, 27, 0, 0, 0, 0, time.UTC), models.NewLimit(weekly, sunday).Start)
+	})
+
+	t.Run("starts windows in the time zone and on the week start of the rule calendar", func(t *testing.T) {
+		tokyo, err := config.LoadLocation("Asia/Tokyo")
+		assert.NoError(t, err)
+		calendar := &config.Calendar{Location: tokyo, WeekStart: time.Sunday}
+		// Saturday 23:00 UTC is Sunday 08:00 in Tokyo.
+		load := time.Date(2000, 1, 1, 23, 0, 0, 0, time.UTC)
+		daily := config.LimitRule{Window: config.WindowDay, Calendar: calendar}
+		weekly := config.LimitRule{Window: config.WindowWeek, Calendar: calendar}
+		assert.True(t, time.Date(2000, 1, 2, 0, 0, 0, 0, tokyo).Equal(models.NewLimit(daily, load).Start))
+		assert.True(t, time.Date(2000, 1, 2, 0, 0, 0, 0, tokyo).Equal(models.NewLimit(weekly, load).Start))
+	})
+
+	t.Run("follows local midnight across daylight saving time changes", func(t *testing.T) {
+		toronto, err := config.LoadLocation("America/Toronto")
+		assert.NoError(t, err)
+		daily := config.LimitRule{Window: config.WindowDay, Calendar: &config.Calendar{Location: toronto, WeekStart: time.Monday}}
+		hourly := config.LimitRule{Window: config.WindowHour, Calendar: daily.Calendar}
+
+		// Daylight saving time starts on 2021-03-14 at 02:00, so the day lasts 23 hours.
+		springStart := models.NewLimit(daily, time.Date(2021, 3, 14, 23, 0, 0, 0, toronto)).Start
+		nextDayStart := models.NewLimit(daily, time.Date(2021, 3, 15, 1, 0, 0, 0, toronto)).Start
+		assert.Equal(t, 23*time.Hour, nextDayStart.Sub(springStart))
+
+		// Daylight saving time ends on 2021-11-07 at 02:00, so the day lasts 25 hours
+		// and both 01:30 hours belong to different hourly windows.
+		fallStart := models.NewLimit(daily, time.Date(2021, 11, 7, 12, 0, 0, 0, toronto)).Start
+		assert.True(t, time.Date(2021, 11, 7, 4, 0, 0, 0, time.UTC).Equal(fallStart))
+		firstHour := models.NewLimit(hourly, time.Date(2021, 11, 7, 5, 30, 0, 0, time.UTC)).Start
+		secondHour := models.NewLimit(hourly, time.Date(2021, 11, 7, 6, 30, 0, 0, time.UTC)).Start
+		assert.Equal(t, time.Hour, secondHour.Sub(firstHour))
+	})
+}
+
+func TestValidateLimit(t *testing.T) {
+	dailyAmount := config.LimitRule{Name: "daily_amount", Window: config.WindowDay, Metric: config.MetricAmount, MaxAmount: usd(5000)}
+	dailyCount := config.LimitRule{Name: "daily_count", Window: config.WindowDay, Metric: config.MetricCount, MaxCount: 3}
+
+	t.Run("returns no reason when loading below max load limit per day", func(t *testing.T) {
+		limit := models.NewLimit(dailyAmount, time.Now())
+		assert.Equal(t, models.ReasonNone, limit.Validate(dailyAmount, usd(3000)))
+	})
+	t.Run("returns no reason when loading exactly same max load limit per day", func(t *testing.T) {
+		limit := models.NewLimit(dailyAmount, time.Now())
+		assert.Equal(t, models.ReasonNone, limit.Validate(dailyAmount, usd(5000)))
+	})
+	t.Run("returns daily amount exceeded when loading more than allowed max load limit per day", func(t *testing.T) {
+		limit := models.NewLimit(dailyAmount, time.Now())
+		assert.Equal(t, models.ReasonDailyAmountExceeded, limit.Validate(dailyAmount, usd(5001)))
+	})
+	t.Run("returns daily count exceeded when max loads per day are used", func(t *testing.T) {
+		limit := models.NewLimit(dailyCount, time.Now())
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, models.ReasonNone, limit.Validate(dailyCount, usd(100)))
+			limit.UpdateLimits(usd(100))
+		}
+		assert.Equal(t, models.ReasonDailyCountExceeded, limit.Validate(dailyCount, usd(100)))
+	})
+}
+
+func TestUpdateLimits(t *testing.T) {
+	t.Run("updates used amount and count of the limit", func(t *testing.T) {
+		limit := models.NewLimit(config.LimitRule{Window: config.WindowDay}, time.Now())
+		limit.UpdateLimits(usd(2000))
+		assert.Equal(t, usd(2000), limit.Amount)
+		assert.Equal(t, 1, limit.Count)
+	})
+}
+
+func TestReasonForRule(t *testing.T) {
+	t.Run("returns reason codes from rule window and metric", func(t *testing.T) {
+		assert.Equal(t, models.ReasonWeeklyAmountExceeded, models.ReasonForRule(config.LimitRule{Window: config.WindowWeek, Metric: config.MetricAmount}))
+		assert.Equal(t, models.Reason("HOURLY_COUNT_EXCEEDED"), models.ReasonForRule(config.LimitRule{Window: config.WindowHour, Metric: config.MetricCount}))
+	})
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 
 	"velocity-limits/internal/models"
@@ -19,3 +20,34 @@ func TestNewResponse(t *testing.T) {
 		assert.Equal(t, expectedResponse, actualResponse)
 	})
 }
+
+func TestNewResponseFromDecision(t *testing.T) {
+	t.Run("should return a response with decline reason and headroom", func(t *testing.T) {
+		headroom := models.Headroom{{Limit: "daily_count", RemainingCount: remainingCount(2)}}
+		decision := models.Decision{Accepted: false, Reason: models.ReasonWeeklyAmountExceeded, Headroom: headroom}
+		expectedResponse := &models.Response{
+			ID:         "123",
+			CustomerID: "1234",
+			Accepted:   false,
+			Reason:     models.ReasonWeeklyAmountExceeded,
+			Headroom:   headroom,
+		}
+		actualResponse := models.NewResponseFromDecision("123", "1234", decision)
+		assert.Equal(t, expectedResponse, actualResponse)
+	})
+}
+
+func TestLegacyResponse(t *testing.T) {
+	t.Run("should marshal exactly like the original output format", func(t *testing.T) {
+		response := models.Response{
+			ID:         "123",
+			CustomerID: "1234",
+			Accepted:   false,
+			Reason:     models.ReasonDailyCountExceeded,
+			Headroom:   models.Headroom{{Limit: "daily_count", RemainingCount: remainingCount(0)}},
+		}
+		byteValue, err := json.Marshal(response.Legacy())
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":"123","customer_id":"1234","accepted":false}`, string(byteValue))
+	})
+}
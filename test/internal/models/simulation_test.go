@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"velocity-limits/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareResponses(t *testing.T) {
+	baseline := []models.Response{
+		{ID: "1", CustomerID: "528", Accepted: true},
+		{ID: "2", CustomerID: "528", Accepted: true},
+		{ID: "3", CustomerID: "529", Accepted: false},
+		{ID: "1", CustomerID: "530", Accepted: true},
+	}
+	simulated := []models.Response{
+		{ID: "1", CustomerID: "528", Accepted: true},
+		{ID: "2", CustomerID: "528", Accepted: false, Reason: models.ReasonWeeklyAmountExceeded},
+		{ID: "3", CustomerID: "529", Accepted: true},
+		{ID: "1", CustomerID: "530", Accepted: false, Reason: models.ReasonWeeklyAmountExceeded},
+		{ID: "4", CustomerID: "530", Accepted: false, Reason: models.ReasonDailyCountExceeded},
+	}
+
+	t.Run("reports changed decisions, customer impact and totals by reason", func(t *testing.T) {
+		report := models.CompareResponses(baseline, simulated)
+		assert.Equal(t, 5, report.Transactions)
+		assert.Equal(t, 3, report.BaselineAccepted)
+		assert.Equal(t, 2, report.SimulatedAccepted)
+		assert.Equal(t, 1, report.Unmatched)
+		assert.Equal(t, []models.Response{simulated[1], simulated[3]}, report.NewlyDeclined)
+		assert.Equal(t, []models.Response{simulated[2]}, report.NewlyAccepted)
+		assert.Equal(t, []models.CustomerImpact{
+			{CustomerID: "528", NewlyDeclined: 1},
+			{CustomerID: "529", NewlyAccepted: 1},
+			{CustomerID: "530", NewlyDeclined: 1},
+		}, report.Customers)
+		assert.Equal(t, map[models.Reason]int{models.ReasonWeeklyAmountExceeded: 2, models.ReasonDailyCountExceeded: 1}, report.DeclinedByReason)
+	})
+
+	t.Run("reports no changes for the same responses", func(t *testing.T) {
+		report := models.CompareResponses(baseline, baseline)
+		assert.Empty(t, report.NewlyDeclined)
+		assert.Empty(t, report.NewlyAccepted)
+		assert.Empty(t, report.Customers)
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"velocity-limits/config"
 	"velocity-limits/internal/models"
+	"velocity-limits/pkg/money"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,13 +17,55 @@ func TestGetParsedAmount(t *testing.T) {
 		transaction := &models.Transaction{
 			ID:         "123",
 			CustomerID: "1234",
-			Amount:     "$11000",
+			Amount:     "$11,000.50",
 			Time:       parsedTime,
 		}
-		result := transaction.GetParsedAmount()
-		expected := float64(11000)
+		result, err := transaction.GetParsedAmount()
+		expected := money.New(1100050, "USD")
+		assert.NoError(t, err)
 
 		assert.IsType(t, expected, result)
 		assert.Equal(t, expected, result)
 	})
 }
+
+func TestValidateTransaction(t *testing.T) {
+	parsedTime, _ := time.Parse(time.RFC3339, "2011-01-11T06:08:12Z")
+	valid := models.Transaction{ID: "123", CustomerID: "1234", Amount: "$11,000.50", Time: parsedTime}
+
+	t.Run("returns no reason for a valid transaction", func(t *testing.T) {
+		assert.Equal(t, models.ReasonNone, valid.Validate())
+	})
+
+	t.Run("returns the reason of the invalid field", func(t *testing.T) {
+		cases := map[models.Reason]func(txn *models.Transaction){
+			models.ReasonMissingID:         func(txn *models.Transaction) { txn.ID = " " },
+			models.ReasonMissingCustomerID: func(txn *models.Transaction) { txn.CustomerID = "" },
+			models.ReasonMissingTime:       func(txn *models.Transaction) { txn.Time = time.Time{} },
+			models.ReasonUnknownCurrency:   func(txn *models.Transaction) { txn.Amount = "¥10.00" },
+			models.ReasonInvalidAmount:     func(txn *models.Transaction) { txn.Amount = "1O.00" },
+			models.ReasonUnknownType:       func(txn *models.Transaction) { txn.Type = "refund" },
+			models.ReasonInvalidCounterparty: func(txn *models.Transaction) {
+				txn.Type, txn.ToCustomerID = config.TypeTransfer, txn.CustomerID
+			},
+			models.ReasonMissingOriginalID: func(txn *models.Transaction) { txn.Type = config.TypeReversal },
+		}
+		for reason, change := range cases {
+			txn := valid
+			change(&txn)
+			assert.Equal(t, reason, txn.Validate())
+		}
+
+		for _, amount := range []string{"$0.00", "-$1.00", "$1.001", ""} {
+			txn := valid
+			txn.Amount = amount
+			assert.Equal(t, models.ReasonInvalidAmount, txn.Validate(), amount)
+		}
+	})
+
+	t.Run("allows reversals without an amount", func(t *testing.T) {
+		txn := valid
+		txn.Type, txn.OriginalID, txn.Amount = config.TypeReversal, "122", ""
+		assert.Equal(t, models.ReasonNone, txn.Validate())
+	})
+}
@@ -0,0 +1,434 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	pb "velocity-limits/api/velocitylimits/v1"
+	"velocity-limits/config"
+	"velocity-limits/internal/models"
+	"velocity-limits/internal/server"
+	"velocity-limits/internal/storage"
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var configVar = config.LoadConfig("../../../config/")
+
+// postLoad sends a load payload to the server and returns the recorded response.
+func postLoad(handler http.Handler, payload string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/loads", strings.NewReader(payload))
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestLoads(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+
+	t.Run("should accept a load within velocity limits", func(t *testing.T) {
+		recorder := postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$3318.47","time":"2000-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var response models.Response
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "1", response.ID)
+		assert.Equal(t, "528", response.CustomerID)
+		assert.True(t, response.Accepted)
+	})
+
+	t.Run("should decline a load above the daily limit with a reason", func(t *testing.T) {
+		recorder := postLoad(handler, `{"id":"2","customer_id":"528","load_amount":"$2000.00","time":"2000-01-01T01:00:00Z"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var response models.Response
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.False(t, response.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, response.Reason)
+	})
+
+	t.Run("should return the original response for a retried load", func(t *testing.T) {
+		recorder := postLoad(handler, `{"id":"2","customer_id":"528","load_amount":"$2000.00","time":"2000-01-01T01:00:00Z"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var response models.Response
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.True(t, response.Replay)
+		assert.False(t, response.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, response.Reason)
+	})
+
+	t.Run("should return conflict for a duplicate load id", func(t *testing.T) {
+		recorder := postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$1.00","time":"2000-01-01T02:00:00Z"}`)
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+
+		var response models.Response
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, models.ReasonIdempotencyConflict, response.Reason)
+	})
+
+	t.Run("should return bad request for malformed payloads", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, postLoad(handler, `{"id":`).Code)
+		assert.Equal(t, http.StatusBadRequest, postLoad(handler, `{"customer_id":"528","load_amount":"$1.00"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, postLoad(handler, `{"id":"3","customer_id":"528","load_amount":"$1.001"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, postLoad(handler, `{"id":"4","customer_id":"528","load_amount":"-$1.00","time":"2000-01-01T02:00:00Z"}`).Code)
+	})
+
+	t.Run("should record invalid payloads in the audit log", func(t *testing.T) {
+		memoryStorage := storage.NewStorage()
+		assert.NoError(t, memoryStorage.SetAuditFile(t.TempDir()+"/audit.jsonl"))
+		defer memoryStorage.Close()
+		s := server.NewServer(&configVar, memoryStorage)
+		assert.Equal(t, http.StatusBadRequest, postLoad(s.Handler(), `{"id":"1","customer_id":"528","load_amount":"-$1.00","time":"2000-01-01T00:00:00Z"}`).Code)
+		_, err := dialGRPC(t, s).LoadFunds(context.Background(), &pb.Transaction{Id: "2", CustomerId: "528", LoadAmount: "$1.00"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		records, err := memoryStorage.GetAudit("528", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, models.ReasonInvalidAmount, records[0].Reason)
+		assert.Equal(t, models.ReasonMissingTime, records[1].Reason)
+	})
+
+	t.Run("should only allow POST", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/loads", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
+
+func TestPreCheck(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+	postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$3318.47","time":"2000-01-01T00:00:00Z"}`)
+
+	// postPreCheck sends a load payload to the pre-check endpoint.
+	postPreCheck := func(payload string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/loads/precheck", strings.NewReader(payload)))
+		return recorder
+	}
+
+	t.Run("should return the decision with the maximum amount and loads left", func(t *testing.T) {
+		recorder := postPreCheck(`{"id":"2","customer_id":"528","load_amount":"$2000.00","time":"2000-01-01T01:00:00Z"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var preCheck models.PreCheck
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &preCheck))
+		assert.False(t, preCheck.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, preCheck.Reason)
+		assert.Equal(t, money.New(168153, "USD"), *preCheck.MaxLoadAmount)
+		assert.Equal(t, 2, *preCheck.RemainingLoads)
+	})
+
+	t.Run("should not mark the load ID as seen", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, postPreCheck(`{"id":"2","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T01:00:00Z"}`).Code)
+
+		recorder := postLoad(handler, `{"id":"2","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T01:00:00Z"}`)
+		var response models.Response
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.True(t, response.Accepted)
+		assert.False(t, response.Replay)
+	})
+
+	t.Run("should evaluate at the current time without a time", func(t *testing.T) {
+		recorder := postPreCheck(`{"id":"3","customer_id":"528","load_amount":"$100.00"}`)
+		var preCheck models.PreCheck
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &preCheck))
+		assert.True(t, preCheck.Accepted)
+		assert.Equal(t, money.FromMajor(5000, "USD"), *preCheck.MaxLoadAmount)
+	})
+
+	t.Run("should return bad request for invalid payloads", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, postPreCheck(`{"id":`).Code)
+		assert.Equal(t, http.StatusBadRequest, postPreCheck(`{"customer_id":"528","load_amount":"$1.00"}`).Code)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+	postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T00:00:00Z"}`)
+
+	t.Run("should return a snapshot of the state", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/snapshot", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var snapshot models.Snapshot
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot))
+		assert.Equal(t, models.SnapshotVersion, snapshot.Version)
+		assert.Equal(t, configVar.Version, snapshot.ConfigVersion)
+		assert.Len(t, snapshot.Accounts, 1)
+		assert.Len(t, snapshot.Ledger, 1)
+		assert.Len(t, snapshot.Transactions, 1)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+	postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T00:00:00Z"}`)
+	postLoad(handler, `{"id":`)
+
+	t.Run("should expose decisions, parse errors and accounts in the Prometheus format", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		body := recorder.Body.String()
+		assert.Contains(t, body, `velocity_decisions_total{decision="accepted",reason="",type="load"}`)
+		assert.Contains(t, body, `velocity_parse_errors_total{reason="MALFORMED_RECORD"}`)
+		assert.Contains(t, body, "velocity_active_accounts 1\n")
+		assert.Contains(t, body, `velocity_processing_duration_seconds_count{type="load"}`)
+	})
+}
+
+func TestCustomerLimits(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+	postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$1000.00","time":"2000-01-01T00:00:00Z"}`)
+
+	t.Run("should return current daily and weekly limits of a customer", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/528/limits?at=2000-01-01T12:00:00Z", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var limits server.LimitsResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &limits))
+		assert.Equal(t, "528", limits.CustomerID)
+		assert.Equal(t, money.FromMajor(1000, "USD"), limits.Balances.Get("USD"))
+		assert.Equal(t, money.FromMajor(1000, "USD"), limits.Limits["daily_amount"].Amount)
+		assert.Equal(t, 1, limits.Limits["daily_count"].Count)
+		assert.Equal(t, money.FromMajor(4000, "USD"), *limits.Headroom[0].RemainingAmount)
+		assert.Equal(t, 2, *limits.Headroom[1].RemainingCount)
+		assert.Equal(t, money.FromMajor(19000, "USD"), *limits.Headroom[2].RemainingAmount)
+	})
+
+	t.Run("should return unused daily limits on a later day", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/528/limits?at=2000-01-02T12:00:00Z", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var limits server.LimitsResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &limits))
+		assert.Equal(t, money.FromMajor(5000, "USD"), *limits.Headroom[0].RemainingAmount)
+		assert.Equal(t, 3, *limits.Headroom[1].RemainingCount)
+	})
+
+	t.Run("should return bad request for an invalid time", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/528/limits?at=yesterday", nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("should return not found for an unknown customer", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/999/limits", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("should return not found for unknown routes", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/528", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func TestWithdrawalsAndLedger(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+	post := func(path, payload string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload)))
+		return recorder
+	}
+
+	t.Run("should withdraw and transfer loaded funds", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, postLoad(handler, `{"id":"1","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T00:00:00Z"}`).Code)
+
+		var response models.Response
+		recorder := post("/withdrawals", `{"id":"2","customer_id":"528","load_amount":"$30.00","time":"2000-01-01T01:00:00Z"}`)
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.True(t, response.Accepted)
+
+		recorder = post("/transfers", `{"id":"3","customer_id":"528","to_customer_id":"529","load_amount":"$80.00","time":"2000-01-01T02:00:00Z"}`)
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.False(t, response.Accepted)
+		assert.Equal(t, models.ReasonInsufficientFunds, response.Reason)
+
+		recorder = post("/transfers", `{"id":"4","customer_id":"528","load_amount":"$10.00","time":"2000-01-01T02:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		recorder = post("/reversals", `{"id":"5","customer_id":"528","original_id":"1","time":"2000-01-01T03:00:00Z"}`)
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, models.ReasonInsufficientFunds, response.Reason)
+		recorder = post("/reversals", `{"id":"6","customer_id":"528","time":"2000-01-01T03:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("should return the ledger and the balance derived from it", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/528/ledger", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var ledger server.LedgerResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &ledger))
+		assert.Equal(t, money.FromMajor(70, "USD"), ledger.Balances.Get("USD"))
+		assert.Len(t, ledger.Entries, 2)
+		assert.Equal(t, money.FromMajor(-30, "USD"), ledger.Entries[1].Amount)
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/530/ledger", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func TestCustomerProfile(t *testing.T) {
+	handler := server.NewServer(&configVar, storage.NewStorage()).Handler()
+
+	t.Run("should change the tier and overrides of a customer", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		body := `{"tier":"vip","limit_overrides":[{"name":"daily_count","threshold":"5"}]}`
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/customers/528/profile", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/528/limits?at=2000-01-01T12:00:00Z", nil))
+		var limits server.LimitsResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &limits))
+		assert.Equal(t, "vip", limits.Tier)
+		assert.Equal(t, money.FromMajor(10000, "USD"), *limits.Headroom[0].RemainingAmount)
+		assert.Equal(t, 5, *limits.Headroom[1].RemainingCount)
+	})
+
+	t.Run("should return bad request for an unknown tier", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/customers/528/profile", strings.NewReader(`{"tier":"gold"}`)))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("should evaluate limits in the customer time zone", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/customers/529/profile", strings.NewReader(`{"time_zone":"Asia/Tokyo"}`)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/529/limits?at=2000-01-01T16:00:00Z", nil))
+		var limits server.LimitsResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &limits))
+		assert.Equal(t, "Asia/Tokyo", limits.TimeZone)
+		assert.True(t, limits.Limits["daily_amount"].Start.Equal(time.Date(2000, 1, 1, 15, 0, 0, 0, time.UTC)))
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/customers/529/profile", strings.NewReader(`{"time_zone":"Mars/Olympus"}`)))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+// dialGRPC serves the gRPC service of the server in memory and returns a client for it.
+func dialGRPC(t *testing.T, s *server.Server) pb.VelocityLimitsClient {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := s.GRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewVelocityLimitsClient(conn)
+}
+
+func TestGRPC(t *testing.T) {
+	loadTime := timestamppb.New(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := server.NewServer(&configVar, storage.NewStorage())
+	client := dialGRPC(t, s)
+	ctx := context.Background()
+
+	t.Run("should decide a load with its reason and headroom", func(t *testing.T) {
+		response, err := client.LoadFunds(ctx, &pb.Transaction{Id: "1", CustomerId: "528", LoadAmount: "$3318.47", Time: loadTime})
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+		assert.Equal(t, "daily_amount", response.Headroom[0].Limit)
+		assert.Equal(t, "$1681.53", response.Headroom[0].GetRemainingAmount())
+		assert.Equal(t, int64(2), response.Headroom[1].GetRemainingCount())
+
+		response, err = client.LoadFunds(ctx, &pb.Transaction{Id: "2", CustomerId: "528", LoadAmount: "$2000.00", Time: loadTime})
+		assert.NoError(t, err)
+		assert.False(t, response.Accepted)
+		assert.Equal(t, string(models.ReasonDailyAmountExceeded), response.Reason)
+	})
+
+	t.Run("should return the original response for a retried load", func(t *testing.T) {
+		response, err := client.LoadFunds(ctx, &pb.Transaction{Id: "1", CustomerId: "528", LoadAmount: "$3318.47", Time: loadTime})
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+		assert.True(t, response.Replay)
+	})
+
+	t.Run("should return error codes for conflicts and invalid transactions", func(t *testing.T) {
+		_, err := client.LoadFunds(ctx, &pb.Transaction{Id: "1", CustomerId: "528", LoadAmount: "$1.00", Time: loadTime})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		_, err = client.LoadFunds(ctx, &pb.Transaction{Id: "3", CustomerId: "528", LoadAmount: "$1.00"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("should only accept loads like POST /loads", func(t *testing.T) {
+		_, err := client.LoadFunds(ctx, &pb.Transaction{Id: "5", CustomerId: "528", Type: config.TypeWithdrawal, LoadAmount: "$1.00", Time: loadTime})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = client.LoadFunds(ctx, &pb.Transaction{Id: "6", CustomerId: "528", Type: config.TypeReversal, OriginalId: "1", Time: loadTime})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		response, err := client.LoadFunds(ctx, &pb.Transaction{Id: "7", CustomerId: "528", Type: config.TypeLoad, LoadAmount: "$1.00", Time: timestamppb.New(loadTime.AsTime().Add(24 * time.Hour))})
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+	})
+
+	t.Run("should stream one response per transaction in order", func(t *testing.T) {
+		stream, err := client.StreamLoadFunds(ctx)
+		assert.NoError(t, err)
+		requests := []*pb.Transaction{
+			{Id: "1", CustomerId: "529", LoadAmount: "$100.00", Time: loadTime},
+			{Id: "2", CustomerId: "529", LoadAmount: "$6000.00", Time: loadTime},
+			{Id: "1", CustomerId: "529", LoadAmount: "$1.00", Time: loadTime},
+			{Id: "3", CustomerId: "529", LoadAmount: "$1.00"},
+			{Id: "4", CustomerId: "529", Type: "withdrawal", LoadAmount: "$50.00", Time: loadTime},
+		}
+		for _, request := range requests {
+			assert.NoError(t, stream.Send(request))
+		}
+		assert.NoError(t, stream.CloseSend())
+
+		reasons := []string{}
+		for {
+			response, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			reasons = append(reasons, response.Reason)
+		}
+		assert.Equal(t, []string{"", string(models.ReasonDailyAmountExceeded), string(models.ReasonIdempotencyConflict), string(models.ReasonMissingTime), ""}, reasons)
+	})
+
+	t.Run("should share the storage with the HTTP API", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/customers/529/ledger", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var ledger server.LedgerResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &ledger))
+		assert.Len(t, ledger.Entries, 2)
+		assert.Equal(t, money.FromMajor(50, "USD"), ledger.Balances.Get("USD"))
+	})
+}
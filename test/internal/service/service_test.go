@@ -1,11 +1,21 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 	"velocity-limits/config"
 	"velocity-limits/internal/models"
 	"velocity-limits/internal/service"
 	"velocity-limits/internal/storage"
+	"velocity-limits/pkg/money"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -22,16 +32,82 @@ func TestGetTransactionsFromInputFile(t *testing.T) {
 		assert.NotZero(t, transactions)
 		transactionsVar = transactions
 	})
+
+	t.Run("should return an error instead of a truncated input", func(t *testing.T) {
+		root := t.TempDir()
+		line := `{"id":"1","customer_id":"528","load_amount":"$1.00","time":"2000-01-01T00:00:00Z"}` + "\n"
+		input := line + strings.Repeat(" ", 70*1024) + line
+		assert.NoError(t, os.WriteFile(root+"/"+configVar.InputFile, []byte(input), 0644))
+		_, err := service.GetTransactionsFromInputFile(&configVar, root)
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+	})
 }
 
 func TestValidateAndProcessTransaction(t *testing.T) {
 	t.Run("should validate transactions and process them to create responses", func(t *testing.T) {
-		responses := service.LoadFunds(&configVar, transactionsVar, storageVar)
+		responses, err := service.LoadFunds(&configVar, transactionsVar, storageVar)
+		assert.NoError(t, err)
 		expectedType := []models.Response{}
 		assert.NotZero(t, responses)
 		assert.IsType(t, expectedType, responses)
 		responsesVar = responses
 	})
+
+	t.Run("should store none of the writes of a decision when one of them fails", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+		for _, newStorage := range []storage.Storage{auditedStorage(t), sqliteStorage} {
+			_, err = service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$3000.00", Time: loadTime}, &configVar, newStorage)
+			assert.NoError(t, err)
+			failing := &failingStorage{Storage: newStorage, customerID: "528", audit: true}
+			_, err = service.ValidateAndProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$10.00", Time: loadTime}, &configVar, failing)
+			assert.EqualError(t, err, "storage unavailable")
+			assertUnchanged(t, newStorage)
+
+			response, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$10.00", Time: loadTime}, &configVar, newStorage)
+			assert.NoError(t, err)
+			assert.True(t, response.Accepted)
+		}
+	})
+
+	t.Run("should store none of the writes of a decision when the audit file can't be written", func(t *testing.T) {
+		if _, err := os.Stat("/dev/full"); err != nil {
+			t.Skip("no /dev/full to fail writes")
+		}
+		newStorage := auditedStorage(t)
+		loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+		_, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$3000.00", Time: loadTime}, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.NoError(t, newStorage.SetAuditFile("/dev/full"))
+		_, err = service.ValidateAndProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$1000.00", Time: loadTime}, &configVar, newStorage)
+		assert.Error(t, err)
+		assertUnchanged(t, newStorage)
+
+		// The retry of a smaller load is charged once.
+		assert.NoError(t, newStorage.SetAuditFile(t.TempDir()+"/audit.jsonl"))
+		response, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$100.00", Time: loadTime}, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(3100, "USD"), account.Balances.Get("USD"))
+	})
+}
+
+// assertUnchanged asserts that the storage has only the first load of $3000 of customer 528.
+func assertUnchanged(t *testing.T, store storage.Storage) {
+	account, err := store.GetAccount("528")
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromMajor(3000, "USD"), account.Balances.Get("USD"))
+	assert.Equal(t, 1, account.Limits["daily_count"].Count)
+	ledger, err := store.GetLedger("528")
+	assert.NoError(t, err)
+	assert.Len(t, ledger, 1)
+	processed, err := store.GetProcessedTransaction("2", "528")
+	assert.NoError(t, err)
+	assert.Nil(t, processed)
 }
 
 func TestWriteResponsesToOutputFile(t *testing.T) {
@@ -40,3 +116,882 @@ func TestWriteResponsesToOutputFile(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestWriteDetailedResponsesToOutputFile(t *testing.T) {
+	t.Run("should write decline reasons and headroom in detailed output format", func(t *testing.T) {
+		detailedConfig := configVar
+		detailedConfig.OutputFormat = config.OutputFormatDetailed
+		detailedConfig.OutputFile = t.TempDir() + "/output.txt"
+
+		err := service.WriteResponsesToOutputFile(&detailedConfig, responsesVar, "")
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(detailedConfig.OutputFile)
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), `"reason":"DAILY_AMOUNT_EXCEEDED"`)
+		assert.Contains(t, string(content), `"headroom":[{"limit":"daily_amount","remaining_amount":`)
+		assert.Equal(t, len(responsesVar), strings.Count(string(content), "\n"))
+	})
+}
+
+func TestProcessStream(t *testing.T) {
+	t.Run("should stream the input file into responses matching the expected output", func(t *testing.T) {
+		input, err := os.Open("../../../input.txt")
+		assert.NoError(t, err)
+		defer input.Close()
+		expectedOutput, err := os.ReadFile("../../../output.txt")
+		assert.NoError(t, err)
+
+		var output bytes.Buffer
+		err = service.ProcessStream(&configVar, storage.NewStorage(), input, &output, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expectedOutput), output.String())
+	})
+
+	t.Run("should write each response before the next transaction is read", func(t *testing.T) {
+		inputReader, inputWriter := io.Pipe()
+		outputReader, outputWriter := io.Pipe()
+		done := make(chan error)
+		go func() {
+			done <- service.ProcessStream(&configVar, storage.NewStorage(), inputReader, outputWriter, nil)
+		}()
+
+		_, err := io.WriteString(inputWriter, `{"id":"1","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T00:00:00Z"}`+"\n")
+		assert.NoError(t, err)
+		line, err := bufio.NewReader(outputReader).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":"1","customer_id":"528","accepted":true}`+"\n", line)
+
+		inputWriter.Close()
+		assert.NoError(t, <-done)
+	})
+
+	malformedInput := strings.Join([]string{
+		`{"id":"1","customer_id":"528","load_amount":"$100.00","time":"2000-01-01T00:00:00Z"}`,
+		``,
+		`{bad json}`,
+		`{"id":"2","customer_id":"528","load_amount":"¥100.00","time":"2000-01-01T00:00:00Z"}`,
+		`{"id":"3","customer_id":"","load_amount":"$1.00","time":"2000-01-01T00:00:00Z"}`,
+		`{"id":"4","customer_id":"528","load_amount":"-$1.00","time":"2000-01-01T00:00:00Z"}`,
+		`{"id":"5","customer_id":"528","load_amount":"$1.00"}`,
+		`{"id":"6","customer_id":"528","load_amount":"$200.00","time":"2000-01-01T01:00:00Z"}`,
+	}, "\n")
+
+	t.Run("should decline invalid transactions with a reason and continue", func(t *testing.T) {
+		detailedConfig := configVar
+		detailedConfig.OutputFormat = config.OutputFormatDetailed
+		var output bytes.Buffer
+		err := service.ProcessStream(&detailedConfig, storage.NewStorage(), strings.NewReader(malformedInput), &output, nil)
+		assert.NoError(t, err)
+
+		var reasons []models.Reason
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			var response models.Response
+			assert.NoError(t, json.Unmarshal([]byte(line), &response))
+			reasons = append(reasons, response.Reason)
+		}
+		assert.Equal(t, []models.Reason{
+			models.ReasonNone,
+			models.ReasonUnknownCurrency,
+			models.ReasonMissingCustomerID,
+			models.ReasonInvalidAmount,
+			models.ReasonMissingTime,
+			models.ReasonNone,
+		}, reasons)
+	})
+
+	t.Run("should write malformed lines to the dead-letter writer with their line number", func(t *testing.T) {
+		var output, deadLetters bytes.Buffer
+		err := service.ProcessStream(&configVar, storage.NewStorage(), strings.NewReader(malformedInput), &output, &deadLetters)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":"1","customer_id":"528","accepted":true}`+"\n"+`{"id":"6","customer_id":"528","accepted":true}`+"\n", output.String())
+
+		var lines []int
+		var rejected []models.DeadLetter
+		for _, line := range strings.Split(strings.TrimSpace(deadLetters.String()), "\n") {
+			var deadLetter models.DeadLetter
+			assert.NoError(t, json.Unmarshal([]byte(line), &deadLetter))
+			lines = append(lines, deadLetter.Line)
+			rejected = append(rejected, deadLetter)
+		}
+		assert.Equal(t, []int{3, 4, 5, 6, 7}, lines)
+		assert.Equal(t, models.ReasonMalformedRecord, rejected[0].Reason)
+		assert.Equal(t, "{bad json}", rejected[0].Record)
+		assert.Equal(t, models.ReasonUnknownCurrency, rejected[1].Reason)
+	})
+
+	t.Run("should not record an invalid transaction as processed", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		response, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$1.001", Time: time.Now()}, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReasonInvalidAmount, response.Reason)
+
+		response, err = service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$1.00", Time: time.Now()}, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+	})
+}
+
+func TestSetCustomerProfile(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+
+	t.Run("should apply tier limits to the loads of a customer", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		_, err := service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{Tier: "vip"})
+		assert.NoError(t, err)
+
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$8000.00", Time: loadTime}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+	})
+
+	t.Run("should apply runtime overrides on top of the tier", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		overrides := []config.LimitOverride{{Name: "daily_amount", Threshold: "$50.00"}}
+		_, err := service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{Tier: "vip", LimitOverrides: overrides})
+		assert.NoError(t, err)
+
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$60.00", Time: loadTime}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+	})
+
+	t.Run("should keep the usage when the tier changes", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: loadTime}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+
+		_, err = service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{Tier: "vip"})
+		assert.NoError(t, err)
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$5000.00", Time: loadTime}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "3", CustomerID: "528", Amount: "$0.01", Time: loadTime}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+	})
+
+	t.Run("should keep the usage of the day when the time zone changes", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		// 15:00 and 18:00 of January 5th in Toronto, the first load is on the UTC day.
+		firstLoad, _ := time.Parse(time.RFC3339, "2000-01-05T20:00:00Z")
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: firstLoad}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+
+		_, err = service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{TimeZone: "America/Toronto"})
+		assert.NoError(t, err)
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$5000.00", Time: firstLoad.Add(3 * time.Hour)}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+	})
+
+	t.Run("should keep the usage of the day when the time zone of the config changes", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		firstLoad, _ := time.Parse(time.RFC3339, "2000-01-05T20:00:00Z")
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: firstLoad}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+
+		// Restarted with another TIME_ZONE.
+		torontoConfig := configVar
+		torontoConfig.TimeZone = "America/Toronto"
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$5000.00", Time: firstLoad.Add(3 * time.Hour)}, newStorage, &torontoConfig)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, "America/Toronto monday", account.Calendar)
+	})
+
+	t.Run("should return an error for unknown tiers and invalid overrides", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		_, err := service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{Tier: "gold"})
+		assert.Error(t, err)
+		_, err = service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{LimitOverrides: []config.LimitOverride{{Name: "yearly_amount", Threshold: "1"}}})
+		assert.Error(t, err)
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Nil(t, account)
+	})
+
+	t.Run("should keep the profile of an existing account when the new one is rejected", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		_, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$100.00", Time: loadTime}, &configVar, newStorage)
+		assert.NoError(t, err)
+		_, err = service.SetCustomerProfile(&configVar, newStorage, "528", config.Profile{TimeZone: "Nowhere/Bad"})
+		assert.Error(t, err)
+
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, config.Profile{}, account.Profile)
+		response, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$100.00", Time: loadTime.Add(time.Hour)}, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+	})
+}
+
+func TestWithdrawalsAndTransfers(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+
+	t.Run("should keep the balances derivable from the ledger", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		transactions := []models.Transaction{
+			{ID: "1", CustomerID: "528", Amount: "$1000.00", Time: loadTime},
+			{ID: "2", CustomerID: "528", Type: config.TypeWithdrawal, Amount: "$200.00", Time: loadTime.Add(time.Hour)},
+			{ID: "3", CustomerID: "528", Type: config.TypeTransfer, ToCustomerID: "529", Amount: "$300.00", Time: loadTime.Add(2 * time.Hour)},
+			{ID: "4", CustomerID: "529", Type: config.TypeWithdrawal, Amount: "$300.01", Time: loadTime.Add(3 * time.Hour)},
+		}
+		responses, err := service.LoadFunds(&configVar, transactions, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, responses[2].Accepted)
+		assert.False(t, responses[3].Accepted)
+		assert.Equal(t, models.ReasonInsufficientFunds, responses[3].Reason)
+
+		for customerID, balance := range map[string]money.Money{"528": money.FromMajor(500, "USD"), "529": money.FromMajor(300, "USD")} {
+			account, err := newStorage.GetAccount(customerID)
+			assert.NoError(t, err)
+			assert.Equal(t, balance, account.Balances.Get("USD"))
+			entries, err := newStorage.GetLedger(customerID)
+			assert.NoError(t, err)
+			assert.Equal(t, balance, models.LedgerBalance(entries).Get("USD"))
+		}
+	})
+
+	t.Run("should not record declined transactions in the ledger", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Type: config.TypeTransfer, ToCustomerID: "529", Amount: "$1.00", Time: loadTime}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReasonInsufficientFunds, decision.Reason)
+
+		entries, err := newStorage.GetLedger("528")
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+		receiver, err := newStorage.GetAccount("529")
+		assert.NoError(t, err)
+		assert.Nil(t, receiver)
+	})
+}
+
+func TestReversals(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+
+	t.Run("should restore the headroom of a reversed load", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		transactions := []models.Transaction{
+			{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: loadTime},
+			{ID: "2", CustomerID: "528", Amount: "$1.00", Time: loadTime.Add(time.Hour)},
+			{ID: "3", CustomerID: "528", Type: config.TypeReversal, OriginalID: "1", Time: loadTime.Add(2 * time.Hour)},
+			{ID: "4", CustomerID: "528", Amount: "$4999.00", Time: loadTime.Add(3 * time.Hour)},
+			{ID: "5", CustomerID: "528", Type: config.TypeReversal, OriginalID: "1", Time: loadTime.Add(4 * time.Hour)},
+			{ID: "6", CustomerID: "529", Type: config.TypeReversal, OriginalID: "1", Time: loadTime.Add(4 * time.Hour)},
+		}
+		responses, err := service.LoadFunds(&configVar, transactions, newStorage)
+		assert.NoError(t, err)
+		assert.False(t, responses[1].Accepted)
+		assert.True(t, responses[2].Accepted)
+		assert.True(t, responses[3].Accepted)
+		assert.Equal(t, models.ReasonAlreadyReversed, responses[4].Reason)
+		assert.Equal(t, models.ReasonUnknownOriginal, responses[5].Reason)
+
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(4999, "USD"), account.Balances.Get("USD"))
+		assert.Equal(t, 1, account.Limits["daily_count"].Count)
+		entries, err := newStorage.GetLedger("528")
+		assert.NoError(t, err)
+		assert.Equal(t, account.Balances, models.LedgerBalance(entries))
+		assert.Equal(t, models.LedgerEntry{
+			CustomerID: "528", TransactionID: "3", Type: config.TypeReversal, Amount: money.FromMajor(-5000, "USD"), Time: loadTime.Add(2 * time.Hour), OriginalID: "1",
+		}, entries[1])
+	})
+}
+
+func TestMultiCurrency(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+
+	t.Run("should convert loads into the base currency with the configured rates", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		transactions := []models.Transaction{
+			{ID: "1", CustomerID: "528", Amount: "€4,000.00", Time: loadTime},
+			{ID: "2", CustomerID: "528", Amount: "$660.01", Time: loadTime.Add(time.Hour)},
+			{ID: "3", CustomerID: "528", Amount: "$660.00", Time: loadTime.Add(2 * time.Hour)},
+		}
+		responses, err := service.LoadFunds(&configVar, transactions, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, responses[0].Accepted)
+		assert.False(t, responses[1].Accepted)
+		assert.True(t, responses[2].Accepted)
+
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, models.Balances{"EUR": money.FromMajor(4000, "EUR"), "USD": money.FromMajor(660, "USD")}, account.Balances)
+		entries, err := newStorage.GetLedger("528")
+		assert.NoError(t, err)
+		assert.Equal(t, account.Balances, models.LedgerBalance(entries))
+	})
+
+	t.Run("should convert the usage stored with another base currency", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		account := models.NewCustomerAccount("528")
+		account.Limits["daily_amount"] = &models.Limit{Start: loadTime, Amount: money.FromMajor(4000, "EUR"), Count: 1}
+		account.LastTransactionTime = loadTime
+		_, err := newStorage.AddAccount(account)
+		assert.NoError(t, err)
+
+		responses, err := service.LoadFunds(&configVar, []models.Transaction{
+			{ID: "1", CustomerID: "528", Amount: "$660.01", Time: loadTime.Add(time.Hour)},
+			{ID: "2", CustomerID: "528", Amount: "$660.00", Time: loadTime.Add(2 * time.Hour)},
+		}, newStorage)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, responses[0].Reason)
+		assert.True(t, responses[1].Accepted)
+	})
+
+	t.Run("should return an error for usage without an exchange rate", func(t *testing.T) {
+		account := models.NewCustomerAccount("528")
+		account.Limits["daily_amount"] = &models.Limit{Start: loadTime, Amount: money.FromMajor(4000, "JPY"), Count: 1}
+		newStorage := storage.NewStorage()
+		_, err := newStorage.AddAccount(account)
+		assert.NoError(t, err)
+
+		_, err = service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$1.00", Time: loadTime}, &configVar, newStorage)
+		assert.Error(t, err)
+
+		snapshot, err := json.Marshal(models.Snapshot{Version: models.SnapshotVersion, Accounts: []*models.CustomerAccount{account}})
+		assert.NoError(t, err)
+		restored := storage.NewStorage()
+		assert.Error(t, service.RestoreSnapshot(&configVar, restored, bytes.NewReader(snapshot)))
+		count, err := restored.CountAccounts()
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+	newStorage := auditedStorage(t)
+	transactions := []models.Transaction{
+		{ID: "1", CustomerID: "528", Amount: "$4000.00", Time: loadTime},
+		{ID: "2", CustomerID: "528", Amount: "$1000.01", Time: loadTime.Add(time.Hour)},
+		{ID: "3", CustomerID: "528", Amount: "-$1.00", Time: loadTime.Add(2 * time.Hour)},
+		{ID: "1", CustomerID: "528", Amount: "$1.00", Time: loadTime.Add(3 * time.Hour)},
+		{ID: "4", CustomerID: "529", Amount: "$1.00", Time: loadTime.Add(3 * time.Hour)},
+	}
+	_, err := service.LoadFunds(&configVar, transactions, newStorage)
+	assert.NoError(t, err)
+
+	t.Run("should record every decision with the limit usage before and after it", func(t *testing.T) {
+		records, err := newStorage.GetAudit("528", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 4)
+		for _, record := range records {
+			assert.Equal(t, configVar.Version, record.ConfigVersion)
+		}
+
+		assert.True(t, records[0].Accepted)
+		assert.Equal(t, money.New(0, "USD"), records[0].Before["daily_amount"].Amount)
+		assert.Equal(t, money.FromMajor(4000, "USD"), records[0].After["daily_amount"].Amount)
+		assert.Equal(t, 1, records[0].After["daily_count"].Count)
+
+		assert.False(t, records[1].Accepted)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, records[1].Reason)
+		assert.Equal(t, records[1].Before, records[1].After)
+		assert.Equal(t, "$1000.01", records[1].Transaction.Amount)
+
+		assert.Equal(t, models.ReasonInvalidAmount, records[2].Reason)
+		assert.Nil(t, records[2].Before)
+		assert.Equal(t, models.ReasonIdempotencyConflict, records[3].Reason)
+	})
+
+	t.Run("should write the records of a customer in the time range as JSON lines", func(t *testing.T) {
+		var output bytes.Buffer
+		assert.NoError(t, service.WriteAudit(newStorage, "528", loadTime.Add(time.Hour), loadTime.Add(2*time.Hour), &output))
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		assert.Len(t, lines, 1)
+
+		var record models.AuditRecord
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal(t, "2", record.Transaction.ID)
+		assert.Equal(t, money.FromMajor(4000, "USD"), record.Before["weekly_amount"].Amount)
+	})
+}
+
+func TestRepeatedTransactions(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+	newStorage := auditedStorage(t)
+	original := models.Transaction{ID: "1", CustomerID: "528", Amount: "$4000.00", Time: loadTime}
+	first, err := service.ValidateAndProcessTransaction(&original, &configVar, newStorage)
+	assert.NoError(t, err)
+
+	t.Run("should return the original response flagged as a replay for a retry", func(t *testing.T) {
+		retry := models.Transaction{ID: "1", CustomerID: "528", Amount: "$4,000", Time: loadTime}
+		response, err := service.ValidateAndProcessTransaction(&retry, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Replay)
+		assert.Equal(t, first.Accepted, response.Accepted)
+		assert.True(t, response.IsRepeated())
+		assert.False(t, first.IsRepeated())
+	})
+
+	t.Run("should decline another payload with the same ID as a conflict", func(t *testing.T) {
+		conflict := models.Transaction{ID: "1", CustomerID: "528", Amount: "$1.00", Time: loadTime}
+		response, err := service.ValidateAndProcessTransaction(&conflict, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.False(t, response.Accepted)
+		assert.False(t, response.Replay)
+		assert.Equal(t, models.ReasonIdempotencyConflict, response.Reason)
+	})
+
+	t.Run("should not change the account of the customer", func(t *testing.T) {
+		records, err := newStorage.GetAudit("528", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 3)
+		assert.Equal(t, models.ReasonDuplicateTransaction, records[1].Reason)
+		assert.Nil(t, records[2].After)
+
+		entries, err := newStorage.GetLedger("528")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
+
+func TestPreCheckLoad(t *testing.T) {
+	loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+	newStorage := auditedStorage(t)
+	_, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$4000.00", Time: loadTime}, &configVar, newStorage)
+	assert.NoError(t, err)
+	load := models.Transaction{ID: "2", CustomerID: "528", Amount: "$500.00", Time: loadTime.Add(time.Hour)}
+
+	t.Run("should evaluate a load without storing anything", func(t *testing.T) {
+		preCheck, err := service.PreCheckLoad(&configVar, newStorage, &load)
+		assert.NoError(t, err)
+		assert.True(t, preCheck.Accepted)
+		assert.Equal(t, money.FromMajor(1000, "USD"), *preCheck.MaxLoadAmount)
+		assert.Equal(t, 2, *preCheck.RemainingLoads)
+
+		processed, err := newStorage.GetProcessedTransaction("2", "528")
+		assert.NoError(t, err)
+		assert.Nil(t, processed)
+		entries, err := newStorage.GetLedger("528")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		records, err := newStorage.GetAudit("528", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, account.Limits["daily_count"].Count)
+	})
+
+	t.Run("should process the load afterwards with the same decision", func(t *testing.T) {
+		response, err := service.ValidateAndProcessTransaction(&load, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+		assert.False(t, response.Replay)
+	})
+
+	t.Run("should report the replay or conflict of a processed load ID", func(t *testing.T) {
+		preCheck, err := service.PreCheckLoad(&configVar, newStorage, &load)
+		assert.NoError(t, err)
+		assert.True(t, preCheck.Accepted)
+		assert.True(t, preCheck.Replay)
+		assert.Nil(t, preCheck.MaxLoadAmount)
+		assert.Nil(t, preCheck.RemainingLoads)
+
+		conflict := load
+		conflict.Amount = "$600.00"
+		preCheck, err = service.PreCheckLoad(&configVar, newStorage, &conflict)
+		assert.NoError(t, err)
+		assert.False(t, preCheck.Accepted)
+		assert.Equal(t, models.ReasonIdempotencyConflict, preCheck.Reason)
+
+		records, err := newStorage.GetAudit("528", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+	})
+
+	t.Run("should create no account for a new customer and decline invalid loads", func(t *testing.T) {
+		preCheck, err := service.PreCheckLoad(&configVar, newStorage, &models.Transaction{ID: "1", CustomerID: "529", Amount: "$100.00", Time: loadTime})
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(5000, "USD"), *preCheck.MaxLoadAmount)
+		account, err := newStorage.GetAccount("529")
+		assert.NoError(t, err)
+		assert.Nil(t, account)
+
+		preCheck, err = service.PreCheckLoad(&configVar, newStorage, &models.Transaction{ID: "1", CustomerID: "529", Amount: "$1.001", Time: loadTime})
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReasonInvalidAmount, preCheck.Reason)
+		assert.Nil(t, preCheck.MaxLoadAmount)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	input, err := os.ReadFile("../../../input.txt")
+	assert.NoError(t, err)
+	expectedOutput, err := os.ReadFile("../../../output.txt")
+	assert.NoError(t, err)
+	lines := strings.SplitAfter(string(input), "\n")
+	firstDay, secondDay := strings.Join(lines[:500], ""), strings.Join(lines[500:], "")
+
+	t.Run("should process the input incrementally on top of a restored snapshot", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+
+		for _, restored := range []storage.Storage{storage.NewStorage(), sqliteStorage} {
+			var output, snapshot bytes.Buffer
+			firstStorage := storage.NewStorage()
+			assert.NoError(t, service.ProcessStream(&configVar, firstStorage, strings.NewReader(firstDay), &output, nil))
+			assert.NoError(t, service.WriteSnapshot(&configVar, firstStorage, &snapshot))
+
+			assert.NoError(t, service.RestoreSnapshot(&configVar, restored, &snapshot))
+			assert.NoError(t, service.ProcessStream(&configVar, restored, strings.NewReader(secondDay), &output, nil))
+			assert.Equal(t, string(expectedOutput), output.String())
+		}
+	})
+
+	t.Run("should reject snapshots of unsupported versions", func(t *testing.T) {
+		_, err := service.ReadSnapshot(strings.NewReader(`{"version":2,"accounts":[]}`))
+		assert.EqualError(t, err, "snapshot version 2 is newer than supported version 1")
+		_, err = service.ReadSnapshot(strings.NewReader(`{"accounts":[]}`))
+		assert.EqualError(t, err, "snapshot has no version")
+	})
+
+	t.Run("should not restore into a storage with state", func(t *testing.T) {
+		var snapshot bytes.Buffer
+		assert.NoError(t, service.WriteSnapshot(&configVar, storage.NewStorage(), &snapshot))
+		newStorage := storage.NewStorage()
+		_, err := service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$1.00", Time: time.Now()}, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, service.RestoreSnapshot(&configVar, newStorage, &snapshot), storage.ErrNotEmpty)
+	})
+}
+
+func TestSimulate(t *testing.T) {
+	transactions, err := service.GetTransactionsFromInputFile(&configVar, "../../../")
+	assert.NoError(t, err)
+	file, err := os.Open("../../../output.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+	baseline, err := service.ReadResponses(file)
+	assert.NoError(t, err)
+
+	t.Run("should report no changes when replaying with the same config", func(t *testing.T) {
+		report, err := service.Simulate(&configVar, transactions, baseline)
+		assert.NoError(t, err)
+		assert.Equal(t, len(baseline), report.Transactions)
+		assert.Equal(t, report.BaselineAccepted, report.SimulatedAccepted)
+		assert.Zero(t, report.Unmatched)
+		assert.Empty(t, report.NewlyDeclined)
+		assert.Empty(t, report.NewlyAccepted)
+	})
+
+	t.Run("should report the decisions changed by a lower weekly limit", func(t *testing.T) {
+		simulationConfig := configVar
+		simulationConfig.Limits = append([]config.LimitRule(nil), configVar.Limits...)
+		simulationConfig.Limits[2].MaxAmount = money.FromMajor(15000, "USD")
+		report, err := service.Simulate(&simulationConfig, transactions, baseline)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, report.NewlyDeclined)
+		for _, response := range report.NewlyDeclined {
+			assert.Equal(t, models.ReasonWeeklyAmountExceeded, response.Reason)
+		}
+
+		var output bytes.Buffer
+		assert.NoError(t, service.WriteSimulationReport(report, &output))
+		assert.Contains(t, output.String(), "Newly declined:")
+		assert.Contains(t, output.String(), "WEEKLY_AMOUNT_EXCEEDED")
+	})
+
+	t.Run("should return the line number of malformed responses", func(t *testing.T) {
+		_, err := service.ReadResponses(strings.NewReader("{\"id\":\"1\",\"customer_id\":\"1\",\"accepted\":true}\n\n{\"id\":"))
+		assert.EqualError(t, err, "line 3: unexpected end of JSON input")
+	})
+}
+
+func TestVerify(t *testing.T) {
+	input, err := os.ReadFile("../../../input.txt")
+	assert.NoError(t, err)
+	expected, err := os.ReadFile("../../../output.txt")
+	assert.NoError(t, err)
+
+	t.Run("should find no mismatches with the expected output", func(t *testing.T) {
+		mismatches, err := service.Verify(&configVar, bytes.NewReader(input), bytes.NewReader(expected))
+		assert.NoError(t, err)
+		assert.Empty(t, mismatches)
+	})
+
+	t.Run("should report changed and missing lines with their transaction", func(t *testing.T) {
+		lines := strings.Split(strings.TrimRight(string(expected), "\n"), "\n")
+		changed := strings.Replace(lines[0], `"accepted":true`, `"accepted":false`, 1)
+		modified := strings.Join(append([]string{changed}, lines[1:len(lines)-1]...), "\n") + "\n"
+		mismatches, err := service.Verify(&configVar, bytes.NewReader(input), strings.NewReader(modified))
+		assert.NoError(t, err)
+		assert.Len(t, mismatches, 2)
+
+		assert.Equal(t, 1, mismatches[0].Line)
+		assert.Equal(t, "15887", mismatches[0].ID)
+		assert.Equal(t, "528", mismatches[0].CustomerID)
+		assert.Equal(t, changed, mismatches[0].Expected)
+		assert.Equal(t, lines[0], mismatches[0].Actual)
+		assert.Contains(t, mismatches[0].Input, `"id":"15887"`)
+
+		assert.Equal(t, len(lines), mismatches[1].Line)
+		assert.Empty(t, mismatches[1].Expected)
+		assert.Equal(t, lines[len(lines)-1], mismatches[1].Actual)
+
+		var output bytes.Buffer
+		assert.NoError(t, service.WriteMismatches(mismatches, &output))
+		assert.Contains(t, output.String(), `line 1: id "15887" customer_id "528"`)
+		assert.Contains(t, output.String(), "2 mismatching lines")
+	})
+
+	t.Run("should ignore carriage returns and trailing empty lines", func(t *testing.T) {
+		crlf := strings.ReplaceAll(string(expected), "\n", "\r\n") + "\n\n"
+		mismatches, err := service.Verify(&configVar, bytes.NewReader(input), strings.NewReader(crlf))
+		assert.NoError(t, err)
+		assert.Empty(t, mismatches)
+	})
+
+	t.Run("should report an empty line within the expected output", func(t *testing.T) {
+		lines := strings.SplitAfter(string(expected), "\n")
+		withEmptyLine := strings.Join(lines[:2], "") + "\n" + strings.Join(lines[2:], "")
+		mismatches, err := service.Verify(&configVar, bytes.NewReader(input), strings.NewReader(withEmptyLine))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, mismatches)
+		assert.Equal(t, 3, mismatches[0].Line)
+		assert.Empty(t, mismatches[0].Expected)
+		assert.Contains(t, mismatches[0].Input, mismatches[0].ID)
+	})
+}
+
+func TestProcessor(t *testing.T) {
+	input, err := os.ReadFile("../../../input.txt")
+	assert.NoError(t, err)
+	expected, err := os.ReadFile("../../../output.txt")
+	assert.NoError(t, err)
+
+	t.Run("should write the responses in input order with any number of workers", func(t *testing.T) {
+		for _, workers := range []int{1, 4, 16} {
+			var output bytes.Buffer
+			processor := service.NewProcessor(&configVar, storage.NewStorage(), workers)
+			assert.NoError(t, processor.ProcessStream(bytes.NewReader(input), &output, nil))
+			assert.Equal(t, string(expected), output.String(), "%d workers", workers)
+		}
+	})
+
+	t.Run("should decide like a sequential run with transfers between customers", func(t *testing.T) {
+		loadTime, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+		var input bytes.Buffer
+		encoder := json.NewEncoder(&input)
+		for i := 0; i < 40; i++ {
+			customerID, receiverID := strconv.Itoa(i%5), strconv.Itoa((i+1)%5)
+			transactionTime := loadTime.Add(time.Duration(i) * time.Hour)
+			assert.NoError(t, encoder.Encode(models.Transaction{ID: strconv.Itoa(i), CustomerID: customerID, Amount: "$1,200.00", Time: transactionTime}))
+			if i%3 == 0 {
+				assert.NoError(t, encoder.Encode(models.Transaction{ID: "t" + strconv.Itoa(i), CustomerID: customerID, Type: config.TypeTransfer, ToCustomerID: receiverID, Amount: "$1,500.00", Time: transactionTime}))
+			}
+			if i%4 == 0 {
+				assert.NoError(t, encoder.Encode(models.Transaction{ID: "w" + strconv.Itoa(i), CustomerID: receiverID, Type: config.TypeWithdrawal, Amount: "$2,000.00", Time: transactionTime}))
+			}
+		}
+
+		var sequential, parallel bytes.Buffer
+		sequentialStorage, parallelStorage := storage.NewStorage(), storage.NewStorage()
+		assert.NoError(t, service.ProcessStream(&configVar, sequentialStorage, bytes.NewReader(input.Bytes()), &sequential, nil))
+		assert.NoError(t, service.NewProcessor(&configVar, parallelStorage, 4).ProcessStream(bytes.NewReader(input.Bytes()), &parallel, nil))
+		assert.Equal(t, sequential.String(), parallel.String())
+		for i := 0; i < 5; i++ {
+			sequentialEntries, err := sequentialStorage.GetLedger(strconv.Itoa(i))
+			assert.NoError(t, err)
+			parallelEntries, err := parallelStorage.GetLedger(strconv.Itoa(i))
+			assert.NoError(t, err)
+			assert.Equal(t, sequentialEntries, parallelEntries)
+		}
+	})
+
+	t.Run("should return the line number of the first failing transaction", func(t *testing.T) {
+		err := service.NewProcessor(&configVar, storage.NewStorage(), 4).ProcessStream(strings.NewReader("\n{\"id\":"), io.Discard, nil)
+		assert.NoError(t, err)
+
+		var output bytes.Buffer
+		failing := &failingStorage{Storage: storage.NewStorage(), customerID: "154"}
+		err = service.NewProcessor(&configVar, failing, 4).ProcessStream(bytes.NewReader(input), &output, nil)
+		assert.EqualError(t, err, "line 2: storage unavailable")
+		assert.Equal(t, strings.SplitAfter(string(expected), "\n")[0], output.String())
+	})
+}
+
+// auditedStorage returns an in-memory storage which appends the audit log to a temporary file.
+func auditedStorage(t *testing.T) *storage.MemoryStorage {
+	newStorage := storage.NewStorage()
+	assert.NoError(t, newStorage.SetAuditFile(t.TempDir()+"/audit.jsonl"))
+	t.Cleanup(func() { newStorage.Close() })
+	return newStorage
+}
+
+// failingStorage fails to read the account or to append the audit records of one customer.
+type failingStorage struct {
+	storage.Storage
+	customerID string
+	audit      bool
+}
+
+func (s *failingStorage) GetAccount(customerID string) (*models.CustomerAccount, error) {
+	if customerID == s.customerID && !s.audit {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.Storage.GetAccount(customerID)
+}
+
+func (s *failingStorage) AppendAudit(record models.AuditRecord) error {
+	if record.Transaction.CustomerID == s.customerID && s.audit {
+		return errors.New("storage unavailable")
+	}
+	return s.Storage.AppendAudit(record)
+}
+
+func (s *failingStorage) Atomic(fn func(storage storage.Storage) error) error {
+	return s.Storage.Atomic(func(store storage.Storage) error {
+		return fn(&failingStorage{Storage: store, customerID: s.customerID, audit: s.audit})
+	})
+}
+
+func TestLateTransactions(t *testing.T) {
+	latest, _ := time.Parse(time.RFC3339, "2000-01-03T12:00:00Z")
+
+	t.Run("should charge a late load within the tolerance to its own day", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: latest}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+
+		lateLoad := latest.Add(-configVar.LateTolerance)
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$5000.00", Time: lateLoad}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+	})
+
+	t.Run("should replay a duplicate after a transaction dated far ahead", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		newStorage.SetRetention(storage.Retention{Window: configVar.DuplicateRetention})
+		now := time.Now().UTC()
+		load := models.Transaction{ID: "1", CustomerID: "528", Amount: "$10.00", Time: now}
+		_, err := service.ValidateAndProcessTransaction(&load, &configVar, newStorage)
+		assert.NoError(t, err)
+		ahead := &models.Transaction{ID: "2", CustomerID: "529", Amount: "$10.00", Time: now.Add(365 * 24 * time.Hour)}
+		response, err := service.ValidateAndProcessTransaction(ahead, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+
+		response, err = service.ValidateAndProcessTransaction(&load, &configVar, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Replay)
+		account, err := newStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(10, "USD"), account.Balances.Get("USD"))
+	})
+
+	t.Run("should decline a transaction ahead of the clock without recording it", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		clockConfig := configVar
+		clockConfig.Clock = func() time.Time { return latest }
+		future := &models.Transaction{ID: "1", CustomerID: "528", Amount: "$10.00", Time: latest.Add(configVar.FutureTolerance + time.Hour)}
+		response, err := service.ValidateAndProcessTransaction(future, &clockConfig, newStorage)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReasonFutureTransaction, response.Reason)
+
+		response, err = service.ValidateAndProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$10.00", Time: latest}, &clockConfig, newStorage)
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+	})
+
+	t.Run("should not check transaction times without a clock", func(t *testing.T) {
+		future := &models.Transaction{ID: "1", CustomerID: "528", Amount: "$10.00", Time: time.Now().Add(365 * 24 * time.Hour)}
+		response, err := service.ValidateAndProcessTransaction(future, &configVar, storage.NewStorage())
+		assert.NoError(t, err)
+		assert.True(t, response.Accepted)
+	})
+
+	t.Run("should decline a load older than the tolerance", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		_, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$10.00", Time: latest}, newStorage, &configVar)
+		assert.NoError(t, err)
+
+		tooLate := latest.Add(-configVar.LateTolerance - time.Second)
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$10.00", Time: tooLate}, newStorage, &configVar)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.ReasonLateTransaction, decision.Reason)
+	})
+}
+
+func TestRollingWindowLimits(t *testing.T) {
+	rollingConfig := configVar
+	rollingConfig.Limits = append(append([]config.LimitRule(nil), configVar.Limits...),
+		config.LimitRule{Name: "rolling_amount", Window: config.WindowRolling, Hours: 24, Metric: config.MetricAmount, MaxAmount: money.FromMajor(5000, "USD")},
+		config.LimitRule{Name: "rolling_count", Window: config.WindowRolling, Hours: 24, Metric: config.MetricCount, MaxCount: 3},
+	)
+	beforeMidnight, _ := time.Parse(time.RFC3339, "2000-01-01T23:59:00Z")
+	afterMidnight, _ := time.Parse(time.RFC3339, "2000-01-02T00:01:00Z")
+
+	t.Run("should decline loads around midnight which exceed the rolling amount", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: beforeMidnight}, newStorage, &rollingConfig)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$5000.00", Time: afterMidnight}, newStorage, &rollingConfig)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("ROLLING_AMOUNT_EXCEEDED"), decision.Reason)
+	})
+
+	t.Run("should decline the fourth load within any 24 hours", func(t *testing.T) {
+		newStorage := storage.NewStorage()
+		for i, loadTime := range []time.Time{beforeMidnight.Add(-time.Hour), beforeMidnight, afterMidnight} {
+			decision, err := service.ProcessTransaction(&models.Transaction{ID: strconv.Itoa(i), CustomerID: "528", Amount: "$10.00", Time: loadTime}, newStorage, &rollingConfig)
+			assert.NoError(t, err)
+			assert.True(t, decision.Accepted)
+		}
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "4", CustomerID: "528", Amount: "$10.00", Time: afterMidnight.Add(time.Hour)}, newStorage, &rollingConfig)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+		assert.Equal(t, models.Reason("ROLLING_COUNT_EXCEEDED"), decision.Reason)
+	})
+
+	t.Run("should keep the load history in a persistent storage across restarts", func(t *testing.T) {
+		path := t.TempDir() + "/velocity-limits.db"
+		sqliteStorage, err := storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		decision, err := service.ProcessTransaction(&models.Transaction{ID: "1", CustomerID: "528", Amount: "$5000.00", Time: beforeMidnight}, sqliteStorage, &rollingConfig)
+		assert.NoError(t, err)
+		assert.True(t, decision.Accepted)
+		assert.NoError(t, sqliteStorage.Close())
+
+		sqliteStorage, err = storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		decision, err = service.ProcessTransaction(&models.Transaction{ID: "2", CustomerID: "528", Amount: "$1.00", Time: afterMidnight}, sqliteStorage, &rollingConfig)
+		assert.NoError(t, err)
+		assert.False(t, decision.Accepted)
+
+		// Loads older than the longest rolling window and the late tolerance of the latest
+		// accepted load are evicted from the history by the next transaction.
+		laterLoad := beforeMidnight.Add(rollingConfig.LateTolerance + 25*time.Hour)
+		for _, id := range []string{"3", "4"} {
+			decision, err = service.ProcessTransaction(&models.Transaction{ID: id, CustomerID: "528", Amount: "$1.00", Time: laterLoad}, sqliteStorage, &rollingConfig)
+			assert.NoError(t, err)
+			assert.True(t, decision.Accepted)
+		}
+		account, err := sqliteStorage.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Len(t, account.History, 2)
+		assert.True(t, laterLoad.Equal(account.History[0].Time))
+	})
+}
@@ -1,10 +1,17 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"velocity-limits/config"
 	"velocity-limits/internal/models"
 	"velocity-limits/internal/storage"
+	"velocity-limits/pkg/money"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -14,40 +21,728 @@ func TestNewStorage(t *testing.T) {
 		newStorage := storage.NewStorage()
 		assert.NotNil(t, newStorage)
 	})
+
+	t.Run("should return a new sqlite storage", func(t *testing.T) {
+		newStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, newStorage)
+		assert.NoError(t, newStorage.Close())
+	})
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("should open the storage selected by config", func(t *testing.T) {
+		memoryConfig := &config.Configuration{Config: config.Config{Storage: storage.TypeMemory, AuditFile: "audit.jsonl"}}
+		memoryStorage, err := storage.Open(memoryConfig, t.TempDir()+"/")
+		assert.NoError(t, err)
+		assert.IsType(t, &storage.MemoryStorage{}, memoryStorage)
+		assert.NoError(t, memoryStorage.Close())
+
+		sqliteConfig := &config.Configuration{Config: config.Config{Storage: storage.TypeSQLite, SQLiteFile: "velocity-limits.db"}}
+		sqliteStorage, err := storage.Open(sqliteConfig, t.TempDir()+"/")
+		assert.NoError(t, err)
+		assert.IsType(t, &storage.SQLiteStorage{}, sqliteStorage)
+		assert.NoError(t, sqliteStorage.Close())
+	})
+
+	t.Run("should return an error for the in-memory storage without an audit file", func(t *testing.T) {
+		_, err := storage.Open(&config.Configuration{Config: config.Config{Storage: storage.TypeMemory}}, "")
+		assert.ErrorIs(t, err, storage.ErrNoAuditFile)
+	})
+
+	t.Run("should return an error for an unknown storage type", func(t *testing.T) {
+		_, err := storage.Open(&config.Configuration{Config: config.Config{Storage: "redis"}}, "")
+		assert.Error(t, err)
+	})
 }
 
 func TestStorageFunctions(t *testing.T) {
-	newStorage := storage.NewStorage()
+	t.Run("memory", func(t *testing.T) {
+		testStorageFunctions(t, storage.NewStorage())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		testStorageFunctions(t, sqliteStorage)
+	})
+}
+
+// testStorageFunctions runs the same behaviour checks against any storage implementation.
+func testStorageFunctions(t *testing.T, newStorage storage.Storage) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	rules := config.LoadConfig("../../../config/").Limits
+	customerAccount := models.NewCustomerAccount("1234")
+	customerAccount.ResetLimits(now, rules, 0)
 
 	t.Run("should get a nil when no account is added to the storage", func(t *testing.T) {
-		result := newStorage.GetAccount("1234")
+		result, err := newStorage.GetAccount("1234")
+		assert.NoError(t, err)
 		assert.Nil(t, result)
 	})
 
 	t.Run("should add an account to the storage", func(t *testing.T) {
-		customerAccount := &models.CustomerAccount{CustomerID: "1234"}
-		newStorage.AddAccount(customerAccount)
-		assert.Equal(t, newStorage.GetAccount("1234"), customerAccount)
+		_, err := newStorage.AddAccount(customerAccount)
+		assert.NoError(t, err)
+		result, err := newStorage.GetAccount("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, customerAccount, result)
+	})
+
+	t.Run("should replace an updated account in the storage", func(t *testing.T) {
+		customerAccount.LoadFunds(&models.Transaction{ID: "1", CustomerID: "1234", Amount: "$100.00", Time: now}, rules, 0)
+		_, err := newStorage.AddAccount(customerAccount)
+		assert.NoError(t, err)
+		result, err := newStorage.GetAccount("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(100, "USD"), result.Balances.Get("USD"))
+		assert.Equal(t, 1, result.Limits["daily_count"].Count)
 	})
 
-	t.Run("should get an added account from the storage", func(t *testing.T) {
-		expectedAccount := &models.CustomerAccount{CustomerID: "1234"}
-		assert.Equal(t, newStorage.GetAccount("1234"), expectedAccount)
+	t.Run("should count the accounts in the storage", func(t *testing.T) {
+		count, err := newStorage.CountAccounts()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
 	})
 
 	t.Run("should add a tranasaction to the storage struct", func(t *testing.T) {
-		newStorage.AddTransaction("123", "2345")
-		bool := newStorage.IsDuplicateTransaction("123", "2345")
+		assert.NoError(t, newStorage.AddTransaction(processed("123", "2345", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))))
+		bool, err := newStorage.IsDuplicateTransaction("123", "2345")
+		assert.NoError(t, err)
 		assert.Equal(t, bool, true)
 	})
 
 	t.Run("should return true when adding a duplicate transaction", func(t *testing.T) {
-		bool := newStorage.IsDuplicateTransaction("123", "2345")
+		bool, err := newStorage.IsDuplicateTransaction("123", "2345")
+		assert.NoError(t, err)
 		assert.Equal(t, bool, true)
 	})
 
 	t.Run("should return false when adding a new transaction", func(t *testing.T) {
-		bool := newStorage.IsDuplicateTransaction("123", "3456")
+		bool, err := newStorage.IsDuplicateTransaction("123", "3456")
+		assert.NoError(t, err)
 		assert.Equal(t, bool, false)
 	})
 }
+
+func TestLedger(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testLedger(t, storage.NewStorage())
+
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		testLedger(t, sqliteStorage)
+	})
+}
+
+// testLedger runs the ledger tests against a storage implementation.
+func testLedger(t *testing.T, newStorage storage.Storage) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	load := &models.Transaction{ID: "1", CustomerID: "1234", Amount: "$100.00", Time: now}
+	transfer := &models.Transaction{ID: "2", CustomerID: "1234", Type: config.TypeTransfer, ToCustomerID: "2345", Amount: "$40.00", Time: now.Add(time.Hour)}
+
+	t.Run("should return no entries for an unknown account", func(t *testing.T) {
+		entries, err := newStorage.GetLedger("1234")
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("should return appended entries in order per account", func(t *testing.T) {
+		loadEntry := models.NewLedgerEntry("1234", load, money.FromMajor(100, "USD"), "")
+		baseAmount := money.FromMajor(100, "USD")
+		loadEntry.BaseAmount = &baseAmount
+		assert.NoError(t, newStorage.AppendLedger(loadEntry))
+		assert.NoError(t, newStorage.AppendLedger(
+			models.NewLedgerEntry("1234", transfer, money.FromMajor(-40, "USD"), "2345"),
+			models.NewLedgerEntry("2345", transfer, money.FromMajor(40, "USD"), "1234"),
+		))
+
+		entries, err := newStorage.GetLedger("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, []models.LedgerEntry{
+			{CustomerID: "1234", TransactionID: "1", Type: config.TypeLoad, Amount: money.FromMajor(100, "USD"), Time: now, BaseAmount: &baseAmount},
+			{CustomerID: "1234", TransactionID: "2", Type: config.TypeTransfer, Amount: money.FromMajor(-40, "USD"), Time: now.Add(time.Hour), CounterpartyID: "2345"},
+		}, entries)
+		assert.Equal(t, models.Balances{"USD": money.FromMajor(60, "USD")}, models.LedgerBalance(entries))
+
+		entries, err = newStorage.GetLedger("2345")
+		assert.NoError(t, err)
+		assert.Equal(t, models.Balances{"USD": money.FromMajor(40, "USD")}, models.LedgerBalance(entries))
+	})
+
+	t.Run("should keep the load referenced by a reversal", func(t *testing.T) {
+		reversal := &models.Transaction{ID: "3", CustomerID: "1234", Type: config.TypeReversal, OriginalID: "1", Time: now.Add(2 * time.Hour)}
+		assert.NoError(t, newStorage.AppendLedger(models.NewLedgerEntry("1234", reversal, money.FromMajor(-60, "USD"), "")))
+
+		entries, err := newStorage.GetLedger("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", entries[2].OriginalID)
+		_, reversed := models.FindLoad(entries, "1")
+		assert.True(t, reversed)
+	})
+}
+
+func TestAtomic(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		memoryStorage := storage.NewStorage()
+		assert.NoError(t, memoryStorage.SetAuditFile(t.TempDir()+"/audit.jsonl"))
+		defer memoryStorage.Close()
+		testAtomic(t, memoryStorage)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		testAtomic(t, sqliteStorage)
+	})
+}
+
+// testAtomic runs the Atomic tests against a storage implementation.
+func testAtomic(t *testing.T, newStorage storage.Storage) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	load := &models.Transaction{ID: "1", CustomerID: "1234", Amount: "$100.00", Time: now}
+	write := func(store storage.Storage) {
+		account := models.NewCustomerAccount("1234")
+		account.Balances.Add(money.FromMajor(100, "USD"))
+		_, err := store.AddAccount(account)
+		assert.NoError(t, err)
+		assert.NoError(t, store.AppendLedger(models.NewLedgerEntry("1234", load, money.FromMajor(100, "USD"), "")))
+		assert.NoError(t, store.AppendAudit(models.NewAuditRecord(load, models.Decision{Accepted: true}, nil, nil, "")))
+		assert.NoError(t, store.AddTransaction(processed("1", "1234", now)))
+	}
+	assertWritten := func(store storage.Storage, written bool) {
+		account, err := store.GetAccount("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, written, account != nil)
+		entries, err := store.GetLedger("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, written, len(entries) == 1)
+		records, err := store.GetAudit("1234", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, written, len(records) == 1)
+		duplicate, err := store.IsDuplicateTransaction("1", "1234")
+		assert.NoError(t, err)
+		assert.Equal(t, written, duplicate)
+	}
+
+	t.Run("should discard the writes when fn fails", func(t *testing.T) {
+		err := newStorage.Atomic(func(store storage.Storage) error {
+			write(store)
+			assertWritten(store, true)
+			return errors.New("declined")
+		})
+		assert.EqualError(t, err, "declined")
+		assertWritten(newStorage, false)
+	})
+
+	t.Run("should apply the writes when fn succeeds", func(t *testing.T) {
+		assert.NoError(t, newStorage.Atomic(func(store storage.Storage) error {
+			write(store)
+			return nil
+		}))
+		assertWritten(newStorage, true)
+	})
+}
+
+func TestAudit(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		path := t.TempDir() + "/audit.jsonl"
+		memoryStorage := storage.NewStorage()
+		assert.NoError(t, memoryStorage.SetAuditFile(path))
+		testAudit(t, memoryStorage)
+		assert.NoError(t, memoryStorage.Close())
+
+		t.Run("should append the records to the audit file of an earlier run", func(t *testing.T) {
+			memoryStorage := storage.NewStorage()
+			assert.NoError(t, memoryStorage.SetAuditFile(path))
+			defer memoryStorage.Close()
+			transaction := &models.Transaction{ID: "4", CustomerID: "1234", Amount: "$1.00", Time: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)}
+			assert.NoError(t, memoryStorage.AppendAudit(models.NewAuditRecord(transaction, models.Decision{Accepted: true}, nil, nil, "")))
+
+			records, err := memoryStorage.GetAudit("1234", time.Time{}, time.Time{})
+			assert.NoError(t, err)
+			assert.Len(t, records, 4)
+			assert.Equal(t, "4", records[3].Transaction.ID)
+		})
+
+		t.Run("should keep no records without an audit file", func(t *testing.T) {
+			memoryStorage := storage.NewStorage()
+			transaction := &models.Transaction{ID: "1", CustomerID: "1234", Amount: "$1.00", Time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+			assert.NoError(t, memoryStorage.AppendAudit(models.NewAuditRecord(transaction, models.Decision{Accepted: true}, nil, nil, "")))
+
+			records, err := memoryStorage.GetAudit("1234", time.Time{}, time.Time{})
+			assert.NoError(t, err)
+			assert.Empty(t, records)
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		testAudit(t, sqliteStorage)
+	})
+}
+
+// testAudit runs the audit log tests against a storage implementation.
+func testAudit(t *testing.T, newStorage storage.Storage) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, customerID := range []string{"1234", "2345", "1234", "1234"} {
+		transaction := &models.Transaction{ID: strconv.Itoa(i), CustomerID: customerID, Amount: "$1.00", Time: now.Add(time.Duration(i) * time.Hour)}
+		before := models.LimitSnapshot{"daily_count": {Start: now, Amount: money.New(0, "USD"), Count: i}}
+		record := models.NewAuditRecord(transaction, models.Decision{Accepted: true}, before, nil, "0123456789ab")
+		assert.NoError(t, newStorage.AppendAudit(record))
+	}
+
+	t.Run("should return the records of a customer in order", func(t *testing.T) {
+		records, err := newStorage.GetAudit("1234", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 3)
+		assert.Equal(t, []string{"0", "2", "3"}, []string{records[0].Transaction.ID, records[1].Transaction.ID, records[2].Transaction.ID})
+		assert.Equal(t, 2, records[1].Before["daily_count"].Count)
+		assert.Equal(t, "0123456789ab", records[1].ConfigVersion)
+	})
+
+	t.Run("should return the records within the time range", func(t *testing.T) {
+		records, err := newStorage.GetAudit("1234", now.Add(time.Hour), now.Add(3*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+		assert.Equal(t, "2", records[0].Transaction.ID)
+
+		records, err = newStorage.GetAudit("3456", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Empty(t, records)
+	})
+}
+
+func TestDuplicateRetention(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testDuplicateRetention(t, func(retention storage.Retention) storage.Storage {
+			memoryStorage := storage.NewStorage()
+			memoryStorage.SetRetention(retention)
+			return memoryStorage
+		})
+
+		t.Run("should only keep the responses of the latest IDs", func(t *testing.T) {
+			memoryStorage := storage.NewStorage()
+			memoryStorage.SetRetention(storage.Retention{MaxResponses: 1})
+			now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			for _, id := range []string{"1", "2"} {
+				transaction := &models.Transaction{ID: id, CustomerID: "1234", Amount: "$1.00", Time: now}
+				response := models.NewResponseFromDecision(id, "1234", models.Decision{Accepted: true})
+				assert.NoError(t, memoryStorage.AddTransaction(models.NewProcessedTransaction(transaction, response)))
+			}
+
+			result, err := memoryStorage.GetProcessedTransaction("1", "1234")
+			assert.NoError(t, err)
+			assert.Nil(t, result.Response)
+			assert.NotEmpty(t, result.Fingerprint)
+			result, err = memoryStorage.GetProcessedTransaction("2", "1234")
+			assert.NoError(t, err)
+			assert.NotNil(t, result.Response)
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		testDuplicateRetention(t, func(retention storage.Retention) storage.Storage {
+			sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+			assert.NoError(t, err)
+			t.Cleanup(func() { sqliteStorage.Close() })
+			sqliteStorage.SetRetention(retention)
+			return sqliteStorage
+		})
+	})
+}
+
+// testDuplicateRetention runs the processed transaction ID tests against a storage implementation.
+func testDuplicateRetention(t *testing.T, newStorage func(retention storage.Retention) storage.Storage) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	isDuplicate := func(s storage.Storage, id, customerID string) bool {
+		duplicate, err := s.IsDuplicateTransaction(id, customerID)
+		assert.NoError(t, err)
+		return duplicate
+	}
+
+	t.Run("should not confuse IDs and customer IDs which concatenate the same", func(t *testing.T) {
+		s := newStorage(storage.Retention{})
+		assert.NoError(t, s.AddTransaction(processed("12", "3", now)))
+		assert.True(t, isDuplicate(s, "12", "3"))
+		assert.False(t, isDuplicate(s, "1", "23"))
+	})
+
+	t.Run("should return processed transactions with their fingerprint and response", func(t *testing.T) {
+		s := newStorage(storage.Retention{})
+		transaction := &models.Transaction{ID: "1", CustomerID: "1234", Amount: "$1.00", Time: now}
+		response := models.NewResponseFromDecision("1", "1234", models.Decision{Reason: models.ReasonDailyAmountExceeded})
+		added := models.NewProcessedTransaction(transaction, response)
+		assert.NoError(t, s.AddTransaction(added))
+
+		result, err := s.GetProcessedTransaction("1", "1234")
+		assert.NoError(t, err)
+		assert.Equal(t, added, *result)
+		result, err = s.GetProcessedTransaction("2", "1234")
+		assert.NoError(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("should keep the IDs within the window when a transaction is dated far ahead", func(t *testing.T) {
+		s := newStorage(storage.Retention{Window: 30 * 24 * time.Hour})
+		assert.NoError(t, s.AddTransaction(processed("1", "1234", now)))
+		future := processed("2", "2345", now.Add(365*24*time.Hour))
+		future.ProcessedAt = now.Add(time.Second)
+		assert.NoError(t, s.AddTransaction(future))
+		assert.True(t, isDuplicate(s, "1", "1234"))
+	})
+
+	t.Run("should forget IDs older than the retention window", func(t *testing.T) {
+		s := newStorage(storage.Retention{Window: 30 * 24 * time.Hour})
+		assert.NoError(t, s.AddTransaction(processed("1", "1234", now)))
+		assert.NoError(t, s.AddTransaction(processed("2", "1234", now.Add(30*24*time.Hour))))
+		assert.True(t, isDuplicate(s, "1", "1234"))
+
+		assert.NoError(t, s.AddTransaction(processed("3", "2345", now.Add(30*24*time.Hour+time.Second))))
+		assert.False(t, isDuplicate(s, "1", "1234"))
+		assert.True(t, isDuplicate(s, "2", "1234"))
+		assert.True(t, isDuplicate(s, "3", "2345"))
+	})
+
+	t.Run("should forget the oldest IDs above the maximum", func(t *testing.T) {
+		s := newStorage(storage.Retention{MaxIDs: 2})
+		assert.NoError(t, s.AddTransaction(processed("1", "1234", now.Add(time.Hour))))
+		assert.NoError(t, s.AddTransaction(processed("2", "1234", now)))
+		assert.NoError(t, s.AddTransaction(processed("2", "1234", now)))
+		assert.NoError(t, s.AddTransaction(processed("3", "1234", now.Add(2*time.Hour))))
+		assert.False(t, isDuplicate(s, "2", "1234"))
+		assert.True(t, isDuplicate(s, "1", "1234"))
+		assert.True(t, isDuplicate(s, "3", "1234"))
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		memoryStorage := storage.NewStorage()
+		assert.NoError(t, memoryStorage.SetAuditFile(t.TempDir()+"/audit.jsonl"))
+		defer memoryStorage.Close()
+		testConcurrentUse(t, memoryStorage)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		sqliteStorage, err := storage.NewSQLiteStorage(t.TempDir()+"/velocity-limits.db", nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		testConcurrentUse(t, sqliteStorage)
+	})
+}
+
+// testConcurrentUse changes the accounts of different customers on concurrent goroutines.
+func testConcurrentUse(t *testing.T, newStorage storage.Storage) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(customerID string) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				transaction := &models.Transaction{ID: strconv.Itoa(j), CustomerID: customerID, Amount: "$1.00", Time: now}
+				account, err := newStorage.GetAccount(customerID)
+				assert.NoError(t, err)
+				if account == nil {
+					account = models.NewCustomerAccount(customerID)
+				}
+				account.ReceiveFunds(money.FromMajor(1, "USD"))
+				_, err = newStorage.AddAccount(account)
+				assert.NoError(t, err)
+				assert.NoError(t, newStorage.AddTransaction(processed(transaction.ID, customerID, now)))
+				assert.NoError(t, newStorage.AppendLedger(models.NewLedgerEntry(customerID, transaction, money.FromMajor(1, "USD"), "")))
+				assert.NoError(t, newStorage.AppendAudit(models.NewAuditRecord(transaction, models.Decision{Accepted: true}, nil, nil, "")))
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		customerID := strconv.Itoa(i)
+		account, err := newStorage.GetAccount(customerID)
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(25, "USD"), account.Balances.Get("USD"))
+		entries, err := newStorage.GetLedger(customerID)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 25)
+		records, err := newStorage.GetAudit(customerID, time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, records, 25)
+		duplicate, err := newStorage.IsDuplicateTransaction("24", customerID)
+		assert.NoError(t, err)
+		assert.True(t, duplicate)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testSnapshot(t, storage.NewStorage(), storage.NewStorage())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		source, err := storage.NewSQLiteStorage(t.TempDir()+"/source.db", nil)
+		assert.NoError(t, err)
+		defer source.Close()
+		target, err := storage.NewSQLiteStorage(t.TempDir()+"/target.db", nil)
+		assert.NoError(t, err)
+		defer target.Close()
+		testSnapshot(t, source, target)
+	})
+
+	t.Run("memory to sqlite", func(t *testing.T) {
+		target, err := storage.NewSQLiteStorage(t.TempDir()+"/target.db", nil)
+		assert.NoError(t, err)
+		defer target.Close()
+		testSnapshot(t, storage.NewStorage(), target)
+	})
+}
+
+// testSnapshot fills the source storage, restores its snapshot into the empty target
+// storage and checks the target has the same state.
+func testSnapshot(t *testing.T, source, target storage.Storage) {
+	now := time.Date(2000, 1, 10, 0, 0, 0, 0, time.UTC)
+	rules := config.LoadConfig("../../../config/").Limits
+	for _, customerID := range []string{"529", "528"} {
+		account := models.NewCustomerAccount(customerID)
+		account.ResetLimits(now, rules, 0)
+		account.LoadFunds(&models.Transaction{ID: "1", CustomerID: customerID, Amount: "$100.00", Time: now}, rules, 0)
+		_, err := source.AddAccount(account)
+		assert.NoError(t, err)
+		load := &models.Transaction{ID: "1", CustomerID: customerID, Amount: "$100.00", Time: now}
+		assert.NoError(t, source.AppendLedger(models.NewLedgerEntry(customerID, load, money.FromMajor(100, "USD"), "")))
+	}
+	response := models.NewResponse("1", "528", true)
+	assert.NoError(t, source.AddTransaction(models.ProcessedTransaction{ID: "1", CustomerID: "528", Time: now, Fingerprint: "load|$100.00", Response: response}))
+	assert.NoError(t, source.AddTransaction(processed("1", "529", now.Add(-time.Hour))))
+
+	t.Run("should take a snapshot ordered by customer and time", func(t *testing.T) {
+		snapshot, err := source.Snapshot()
+		assert.NoError(t, err)
+		assert.Equal(t, models.SnapshotVersion, snapshot.Version)
+		assert.Len(t, snapshot.Accounts, 2)
+		assert.Equal(t, "528", snapshot.Accounts[0].CustomerID)
+		assert.Equal(t, []string{"528", "529"}, []string{snapshot.Ledger[0].CustomerID, snapshot.Ledger[1].CustomerID})
+		assert.Equal(t, []string{"529", "528"}, []string{snapshot.Transactions[0].CustomerID, snapshot.Transactions[1].CustomerID})
+	})
+
+	t.Run("should restore the accounts, ledgers and processed transactions", func(t *testing.T) {
+		snapshot, err := source.Snapshot()
+		assert.NoError(t, err)
+		assert.NoError(t, target.Restore(snapshot))
+
+		account, err := target.GetAccount("528")
+		assert.NoError(t, err)
+		assert.Equal(t, money.FromMajor(100, "USD"), account.Balances.Get("USD"))
+		assert.Equal(t, 1, account.Limits["daily_count"].Count)
+		entries, err := target.GetLedger("529")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		restored, err := target.GetProcessedTransaction("1", "528")
+		assert.NoError(t, err)
+		assert.Equal(t, "load|$100.00", restored.Fingerprint)
+		assert.Equal(t, response, restored.Response)
+		assert.True(t, now.Equal(restored.Time))
+	})
+
+	t.Run("should keep the retention of the restored transactions", func(t *testing.T) {
+		retained, ok := target.(interface{ SetRetention(storage.Retention) })
+		assert.True(t, ok)
+		retained.SetRetention(storage.Retention{Window: 30 * time.Minute})
+		duplicate, err := target.IsDuplicateTransaction("1", "529")
+		assert.NoError(t, err)
+		assert.False(t, duplicate)
+
+		snapshot, err := target.Snapshot()
+		assert.NoError(t, err)
+		assert.Len(t, snapshot.Transactions, 1)
+	})
+
+	t.Run("should not restore into a storage with state", func(t *testing.T) {
+		snapshot, err := source.Snapshot()
+		assert.NoError(t, err)
+		assert.ErrorIs(t, target.Restore(snapshot), storage.ErrNotEmpty)
+	})
+}
+
+func TestSQLiteStoragePersistence(t *testing.T) {
+	t.Run("should keep accounts and transactions across restarts", func(t *testing.T) {
+		path := t.TempDir() + "/velocity-limits.db"
+		now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		sqliteStorage, err := storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		rules := config.LoadConfig("../../../config/").Limits
+		customerAccount := models.NewCustomerAccount("1234")
+		customerAccount.ResetLimits(now, rules, 0)
+		customerAccount.LoadFunds(&models.Transaction{ID: "1", CustomerID: "1234", Amount: "$100.00", Time: now}, rules, 0)
+		_, err = sqliteStorage.AddAccount(customerAccount)
+		assert.NoError(t, err)
+		assert.NoError(t, sqliteStorage.AddTransaction(processed("1", "1234", now)))
+		assert.NoError(t, sqliteStorage.Close())
+
+		// Reopening runs migrations again, which must be a no-op for an up to date schema.
+		sqliteStorage, err = storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		result, err := sqliteStorage.GetAccount("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, customerAccount, result)
+		duplicate, err := sqliteStorage.IsDuplicateTransaction("1", "1234")
+		assert.NoError(t, err)
+		assert.True(t, duplicate)
+	})
+	t.Run("should keep the retention of transaction IDs across restarts", func(t *testing.T) {
+		path := t.TempDir() + "/velocity-limits.db"
+		now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		retention := storage.Retention{Window: 24 * time.Hour}
+
+		sqliteStorage, err := storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		sqliteStorage.SetRetention(retention)
+		assert.NoError(t, sqliteStorage.AddTransaction(processed("1", "1234", now)))
+		assert.NoError(t, sqliteStorage.AddTransaction(processed("2", "1234", now.Add(25*time.Hour))))
+		assert.NoError(t, sqliteStorage.Close())
+
+		sqliteStorage, err = storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		sqliteStorage.SetRetention(retention)
+		duplicate, err := sqliteStorage.IsDuplicateTransaction("1", "1234")
+		assert.NoError(t, err)
+		assert.False(t, duplicate)
+		duplicate, err = sqliteStorage.IsDuplicateTransaction("2", "1234")
+		assert.NoError(t, err)
+		assert.True(t, duplicate)
+	})
+}
+
+func TestSQLiteStorageMigrations(t *testing.T) {
+	t.Run("should move the balance of earlier versions to the USD balance", func(t *testing.T) {
+		path := t.TempDir() + "/velocity-limits.db"
+		db, err := sql.Open("sqlite", path)
+		assert.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY);
+			INSERT INTO schema_migrations (version) VALUES (1), (2), (3), (4);
+			CREATE TABLE accounts (customer_id TEXT PRIMARY KEY, state TEXT NOT NULL);
+			CREATE TABLE transactions (id TEXT NOT NULL, customer_id TEXT NOT NULL, PRIMARY KEY (id, customer_id));
+			CREATE TABLE ledger (seq INTEGER PRIMARY KEY AUTOINCREMENT, customer_id TEXT NOT NULL);
+			INSERT INTO accounts (customer_id, state) VALUES ('1234', '{"customer_id":"1234","balance":"$100.00","limits":{}}')`)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Close())
+
+		sqliteStorage, err := storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		account, err := sqliteStorage.GetAccount("1234")
+		assert.NoError(t, err)
+		assert.Equal(t, models.Balances{"USD": money.FromMajor(100, "USD")}, account.Balances)
+	})
+	t.Run("should move the daily and weekly limits of earlier versions to the limits of the rules", func(t *testing.T) {
+		path := t.TempDir() + "/velocity-limits.db"
+		db, err := sql.Open("sqlite", path)
+		assert.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY);
+			INSERT INTO schema_migrations (version) VALUES (1), (2);
+			CREATE TABLE accounts (customer_id TEXT PRIMARY KEY, state TEXT NOT NULL);
+			CREATE TABLE transactions (id TEXT NOT NULL, customer_id TEXT NOT NULL, PRIMARY KEY (id, customer_id));
+			INSERT INTO accounts (customer_id, state) VALUES ('1234', '{"customer_id":"1234","balance":"$5000.00",
+				"daily_limit":{"date":"2000-01-04T00:00:00Z","max_load_limit":"$0.00","max_load":2},
+				"weekly_limit":{"date":"2000-01-03T00:00:00Z","max_load_limit":"$14999.99"}}')`)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Close())
+
+		rules := config.LoadConfig("../../../config/").Limits
+		sqliteStorage, err := storage.NewSQLiteStorage(path, rules)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		account, err := sqliteStorage.GetAccount("1234")
+		assert.NoError(t, err)
+		day := time.Date(2000, 1, 4, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, &models.Limit{Start: day, Amount: money.FromMajor(5000, "USD"), Count: 1}, account.Limits["daily_amount"])
+		assert.Equal(t, &models.Limit{Start: day, Amount: money.FromMajor(5000, "USD"), Count: 1}, account.Limits["daily_count"])
+		assert.Equal(t, money.New(500001, "USD"), account.Limits["weekly_amount"].Amount)
+
+		// The usage of the day before the upgrade still limits loads of the same day.
+		load := &models.Transaction{ID: "2", CustomerID: "1234", Amount: "$5000.00", Time: day.Add(12 * time.Hour)}
+		account.ResetLimits(load.Time, rules, 0)
+		decision := account.LoadFunds(load, rules, 0)
+		assert.Equal(t, models.ReasonDailyAmountExceeded, decision.Reason)
+	})
+	t.Run("should derive the usage of earlier versions from the thresholds of the config", func(t *testing.T) {
+		legacyAccount := `{"customer_id":"1234",
+			"daily_limit":{"date":"2000-01-04T00:00:00Z","max_load_limit":"$500.00","max_load":9},
+			"weekly_limit":{"date":"2000-01-03T00:00:00Z","max_load_limit":"$29500.00"}}`
+		rules := []config.LimitRule{
+			{Name: "daily_amount", MaxAmount: money.FromMajor(1000, "USD")},
+			{Name: "daily_count", MaxCount: 10},
+			{Name: "weekly_amount", MaxAmount: money.FromMajor(30000, "USD")},
+		}
+		sqliteStorage, err := storage.NewSQLiteStorage(legacyDatabase(t, legacyAccount), rules)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		account, err := sqliteStorage.GetAccount("1234")
+		assert.NoError(t, err)
+		day := time.Date(2000, 1, 4, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, &models.Limit{Start: day, Amount: money.FromMajor(500, "USD"), Count: 1}, account.Limits["daily_count"])
+		assert.Equal(t, money.FromMajor(500, "USD"), account.Limits["weekly_amount"].Amount)
+
+		_, err = storage.NewSQLiteStorage(legacyDatabase(t, legacyAccount), rules[1:])
+		assert.EqualError(t, err, "applying migration 9: converting the limits of account 1234: no daily_amount rule in the config")
+	})
+	t.Run("should keep transaction IDs of earlier versions for a full retention window", func(t *testing.T) {
+		path := t.TempDir() + "/velocity-limits.db"
+		db, err := sql.Open("sqlite", path)
+		assert.NoError(t, err)
+		now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY);
+			INSERT INTO schema_migrations (version) VALUES (1), (2), (3), (4), (5), (6);
+			CREATE TABLE accounts (customer_id TEXT PRIMARY KEY, state TEXT NOT NULL);
+			CREATE TABLE transactions (id TEXT NOT NULL, customer_id TEXT NOT NULL, PRIMARY KEY (id, customer_id));
+			CREATE TABLE ledger (seq INTEGER PRIMARY KEY AUTOINCREMENT, customer_id TEXT NOT NULL);
+			INSERT INTO transactions (id, customer_id) VALUES ('1', '1234');
+			CREATE TABLE audit (seq INTEGER PRIMARY KEY AUTOINCREMENT, customer_id TEXT NOT NULL, transaction_time INTEGER NOT NULL, record TEXT NOT NULL);
+			INSERT INTO audit (customer_id, transaction_time, record) VALUES ('1234', ?, '{}')`, now.UnixNano())
+		assert.NoError(t, err)
+		assert.NoError(t, db.Close())
+
+		sqliteStorage, err := storage.NewSQLiteStorage(path, nil)
+		assert.NoError(t, err)
+		defer sqliteStorage.Close()
+		sqliteStorage.SetRetention(storage.Retention{Window: 24 * time.Hour})
+		assert.NoError(t, sqliteStorage.AddTransaction(processed("2", "1234", now.Add(24*time.Hour))))
+		duplicate, err := sqliteStorage.IsDuplicateTransaction("1", "1234")
+		assert.NoError(t, err)
+		assert.True(t, duplicate)
+	})
+}
+
+// legacyDatabase returns the path of a database at migration 8 with the account state of an earlier version.
+func legacyDatabase(t *testing.T, state string) string {
+	path := t.TempDir() + "/velocity-limits.db"
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY);
+		INSERT INTO schema_migrations (version) VALUES (1), (2), (3), (4), (5), (6), (7), (8);
+		CREATE TABLE accounts (customer_id TEXT PRIMARY KEY, state TEXT NOT NULL);
+		CREATE TABLE transactions (id TEXT NOT NULL, customer_id TEXT NOT NULL, time INTEGER NOT NULL DEFAULT 0,
+			fingerprint TEXT NOT NULL DEFAULT '', response TEXT, PRIMARY KEY (id, customer_id));
+		CREATE TABLE ledger (seq INTEGER PRIMARY KEY AUTOINCREMENT, customer_id TEXT NOT NULL);
+		INSERT INTO accounts (customer_id, state) VALUES ('1234', ?)`, state)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	return path
+}
+
+// processed returns a processed transaction without fingerprint and response.
+func processed(id, customerID string, at time.Time) models.ProcessedTransaction {
+	return models.ProcessedTransaction{ID: id, CustomerID: customerID, Time: at, ProcessedAt: at}
+}
@@ -0,0 +1,73 @@
+package fx
+
+import (
+	"math/big"
+	"testing"
+
+	"velocity-limits/pkg/fx"
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticProvider(t *testing.T) {
+	provider, err := fx.NewStaticProvider("usd", map[string]string{"EUR": "1.10", "gbp": "1.25"})
+	assert.NoError(t, err)
+
+	t.Run("returns rates from and to the base currency and across currencies", func(t *testing.T) {
+		rate, err := provider.Rate("EUR", "USD")
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewRat(11, 10), rate)
+
+		rate, err = provider.Rate("USD", "GBP")
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewRat(4, 5), rate)
+
+		rate, err = provider.Rate("EUR", "GBP")
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewRat(22, 25), rate)
+	})
+
+	t.Run("returns an error for currencies without a rate", func(t *testing.T) {
+		_, err := provider.Rate("CAD", "USD")
+		assert.ErrorIs(t, err, fx.ErrNoRate)
+	})
+
+	t.Run("returns an error for invalid tables", func(t *testing.T) {
+		_, err := fx.NewStaticProvider("XYZ", nil)
+		assert.ErrorIs(t, err, money.ErrUnknownCurrency)
+		_, err = fx.NewStaticProvider("USD", map[string]string{"XYZ": "1"})
+		assert.ErrorIs(t, err, money.ErrUnknownCurrency)
+		for _, rate := range []string{"0", "-1.5", "one"} {
+			_, err = fx.NewStaticProvider("USD", map[string]string{"EUR": rate})
+			assert.Error(t, err, rate)
+		}
+	})
+}
+
+func TestConvert(t *testing.T) {
+	provider, _ := fx.NewStaticProvider("USD", map[string]string{"EUR": "1.085", "GBP": "1.2712"})
+
+	t.Run("converts and rounds half away from zero", func(t *testing.T) {
+		cases := map[money.Money]money.Money{
+			money.New(10000, "EUR"): money.New(10850, "USD"),
+			money.New(1, "GBP"):     money.New(1, "USD"),
+			money.New(-50, "EUR"):   money.New(-54, "USD"),
+			money.New(-1, "EUR"):    money.New(-1, "USD"),
+		}
+		for amount, expected := range cases {
+			converted, err := fx.Convert(provider, amount, "USD")
+			assert.NoError(t, err, amount.String())
+			assert.Equal(t, expected, converted, amount.String())
+		}
+	})
+
+	t.Run("returns amounts in the target currency without a provider", func(t *testing.T) {
+		converted, err := fx.Convert(nil, money.New(100, "USD"), "USD")
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(100, "USD"), converted)
+
+		_, err = fx.Convert(nil, money.New(100, "EUR"), "USD")
+		assert.ErrorIs(t, err, fx.ErrNoRate)
+	})
+}
@@ -0,0 +1,124 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"velocity-limits/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("parses amounts with currency symbol, separators and decimals", func(t *testing.T) {
+		cases := map[string]int64{
+			"$123.45":    12345,
+			"$1,234.56":  123456,
+			"$1,234,567": 123456700,
+			"$0.5":       50,
+			"100":        10000,
+			" $3318.47 ": 331847,
+			"-$12.50":    -1250,
+			"$-12.50":    -1250,
+			"$1666.67":   166667,
+			"$4,856.66":  485666,
+			"$20,000.00": 2000000,
+		}
+		for input, expected := range cases {
+			result, err := money.Parse(input)
+			assert.NoError(t, err, input)
+			assert.Equal(t, money.New(expected, "USD"), result, input)
+		}
+	})
+
+	t.Run("returns an error for more than two decimals", func(t *testing.T) {
+		_, err := money.Parse("$12.345")
+		assert.ErrorIs(t, err, money.ErrTooManyDecimals)
+	})
+
+	t.Run("returns an error for malformed amounts", func(t *testing.T) {
+		for _, input := range []string{"", "$", "$abc", "$1,23.45", "$12,3456", "$1.2.3", "$1e5", "--$1", "$.50"} {
+			_, err := money.Parse(input)
+			assert.ErrorIs(t, err, money.ErrInvalidAmount, input)
+		}
+	})
+
+	t.Run("parses ISO 4217 currency symbols and codes", func(t *testing.T) {
+		cases := map[string]money.Money{
+			"€100.00":     money.New(10000, "EUR"),
+			"-£12.50":     money.New(-1250, "GBP"),
+			"EUR 1,000":   money.New(100000, "EUR"),
+			"CHF-3.10":    money.New(-310, "CHF"),
+			"100.00 CAD":  money.New(10000, "CAD"),
+			"12.5aud":     money.New(1250, "AUD"),
+			"$100.00 USD": {},
+		}
+		for input, expected := range cases {
+			result, err := money.Parse(input)
+			if expected.Currency == "" {
+				assert.Error(t, err, input)
+				continue
+			}
+			assert.NoError(t, err, input)
+			assert.Equal(t, expected, result, input)
+		}
+		assert.True(t, money.IsCurrency("EUR"))
+		assert.False(t, money.IsCurrency("XYZ"))
+	})
+
+	t.Run("returns an error for unknown currency symbols and codes", func(t *testing.T) {
+		for _, input := range []string{"¥12.00", "XYZ 12.00", "12.00 EURO", "ten"} {
+			_, err := money.Parse(input)
+			assert.ErrorIs(t, err, money.ErrUnknownCurrency, input)
+		}
+	})
+
+	t.Run("returns an error for amounts out of range", func(t *testing.T) {
+		_, err := money.Parse("$92233720368547758.08")
+		assert.ErrorIs(t, err, money.ErrOverflow)
+	})
+}
+
+func TestArithmetic(t *testing.T) {
+	t.Run("adds, subtracts and compares amounts exactly", func(t *testing.T) {
+		limit := money.FromMajor(5000, "USD")
+		load := money.New(166667, "USD")
+		remaining := limit.Sub(load).Sub(load).Sub(load)
+		assert.Equal(t, money.New(-1, "USD"), remaining)
+		assert.True(t, remaining.IsNegative())
+		assert.Equal(t, 1, limit.Cmp(load.Add(load)))
+		assert.Equal(t, -1, limit.Cmp(load.Add(load).Add(load)))
+		assert.Equal(t, 0, limit.Cmp(money.New(500000, "USD")))
+	})
+
+	t.Run("panics when combining different currencies", func(t *testing.T) {
+		assert.Panics(t, func() {
+			money.New(100, "USD").Add(money.New(100, "EUR"))
+		})
+	})
+}
+
+func TestString(t *testing.T) {
+	t.Run("formats amounts with currency symbol", func(t *testing.T) {
+		assert.Equal(t, "$1234.56", money.New(123456, "USD").String())
+		assert.Equal(t, "-$0.05", money.New(-5, "USD").String())
+	})
+
+	t.Run("returns the amount in major units", func(t *testing.T) {
+		assert.Equal(t, 1234.56, money.New(123456, "USD").Major())
+		assert.Equal(t, -0.05, money.New(-5, "USD").Major())
+	})
+}
+
+func TestJSON(t *testing.T) {
+	t.Run("round trips an amount through JSON", func(t *testing.T) {
+		original := money.New(123456, "USD")
+		data, err := json.Marshal(original)
+		assert.NoError(t, err)
+		assert.Equal(t, `"$1234.56"`, string(data))
+
+		var decoded money.Money
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, original, decoded)
+	})
+}